@@ -0,0 +1,110 @@
+package bunrepo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/uptrace/bun"
+)
+
+// GroupBy groups the rows by the columns in [Aggregate], the columns are selected too.
+func GroupBy(cols ...string) GetOption {
+	return groupByOption(cols)
+}
+
+type groupByOption []string
+
+func (gbo groupByOption) ApplyGet(o *getOption) {
+	o.GroupBy = append(o.GroupBy, gbo...)
+}
+
+// Select adds the column expression to the SELECT clause in [Aggregate],
+// like `count(*) AS n` or `sum(?) AS total` with the args.
+func Select(query string, args ...any) GetOption {
+	return selectOption{A: query, B: args}
+}
+
+type selectOption Tuple[string, []any]
+
+func (so selectOption) ApplyGet(o *getOption) {
+	o.Selects = append(o.Selects, Tuple[string, []any](so))
+}
+
+// Having adds the condition to the HAVING clause in [Aggregate], like `count(*) > ?`.
+func Having(query string, args ...any) GetOption {
+	return havingOption{A: query, B: args}
+}
+
+type havingOption Tuple[string, []any]
+
+func (ho havingOption) ApplyGet(o *getOption) {
+	o.Having = append(o.Having, Tuple[string, []any](ho))
+}
+
+// aggQuery returns the query of the entities matching the query struct p without the columns.
+func (repo *Repo[T]) aggQuery(ctx context.Context, p any, opts []GetOption,
+) (*bun.SelectQuery, *getOption, error) {
+	o := repo.getOption(opts)
+	qb, err := repo.buildQuery(ctx, p)
+	if err != nil {
+		return nil, nil, fmt.Errorf("build: %w", err)
+	}
+	scope, err := repo.scope(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	q := repo.db.NewSelect().Model((*T)(nil)).ApplyQueryBuilder(qb).
+		ApplyQueryBuilder(o.QueryBuilder(false)).ApplyQueryBuilder(scope).
+		ApplyQueryBuilder(o.Deleted.QueryBuilder())
+	return q, &o, nil
+}
+
+// Count returns the number of the entities matching the query struct p, see [BuildQuery].
+func (repo *Repo[T]) Count(ctx context.Context, p any, opts ...GetOption) (int, error) {
+	q, _, err := repo.aggQuery(ctx, p, opts)
+	if err != nil {
+		return 0, err
+	}
+	return q.Count(ctx)
+}
+
+// Exists reports whether any entity matches the query struct p, see [BuildQuery].
+func (repo *Repo[T]) Exists(ctx context.Context, p any, opts ...GetOption) (bool, error) {
+	q, _, err := repo.aggQuery(ctx, p, opts)
+	if err != nil {
+		return false, err
+	}
+	return q.Exists(ctx)
+}
+
+// Aggregate runs the aggregate query of the entities matching the query struct p,
+// see [BuildQuery], and scans the rows into R by the column names.
+// The columns are set by the [GroupBy] and [Select] options.
+//
+// Example:
+//
+//	type StatusCount struct {
+//		Status string
+//		N      int
+//	}
+//
+//	res, err := bunrepo.Aggregate[StatusCount](ctx, repo, &query,
+//		bunrepo.GroupBy("status"), bunrepo.Select("count(*) AS n"))
+func Aggregate[R, T any](ctx context.Context, repo *Repo[T], p any, opts ...GetOption,
+) (res []R, err error) {
+	q, o, err := repo.aggQuery(ctx, p, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(o.GroupBy) != 0 {
+		q.Column(o.GroupBy...).Group(o.GroupBy...)
+	}
+	for _, s := range o.Selects {
+		q.ColumnExpr(s.A, s.B...)
+	}
+	for _, h := range o.Having {
+		q.Having(h.A, h.B...)
+	}
+	err = q.Scan(ctx, &res)
+	return
+}
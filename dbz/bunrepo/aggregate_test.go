@@ -0,0 +1,66 @@
+package bunrepo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+
+	"github.com/adobaai/pkg/dbz/predicate"
+	"github.com/adobaai/pkg/testingz"
+)
+
+type Ticket struct {
+	ID     int `bun:",pk"`
+	Status string
+	Points int
+}
+
+func TestAggregate(t *testing.T) {
+	bdb, err := newDB()
+	require.NoError(t, err)
+	ctx := context.Background()
+	testingz.R(bdb.NewCreateTable().Model((*Ticket)(nil)).Exec(ctx)).NoError(t)
+	repo := New[Ticket](bdb)
+	testingz.R(repo.Addm(ctx, []*Ticket{
+		{ID: 1, Status: "open", Points: 1},
+		{ID: 2, Status: "open", Points: 2},
+		{ID: 3, Status: "done", Points: 3},
+		{ID: 4, Status: "closed", Points: 5},
+	})).NoError(t)
+
+	type Query struct {
+		Status *predicate.Field[string]
+		Points *predicate.Field[int]
+	}
+	testingz.R(repo.Count(ctx, nil)).NoError(t).Equal(4)
+	testingz.R(repo.Count(ctx, &Query{Status: predicate.EQ("open")})).NoError(t).Equal(2)
+	testingz.R(repo.Count(ctx, nil, Where("points > ?", 2))).NoError(t).Equal(2)
+	testingz.R(repo.Exists(ctx, &Query{Points: predicate.GT(4)})).NoError(t).Equal(true)
+	testingz.R(repo.Exists(ctx, &Query{Points: predicate.GT(5)})).NoError(t).Equal(false)
+
+	type StatusSum struct {
+		Status string
+		N      int
+		Total  int
+	}
+	res, err := Aggregate[StatusSum](ctx, repo, &Query{Status: predicate.NEQ("closed")},
+		GroupBy("status"), Select("count(*) AS n"), Select("sum(?) AS total", bun.Ident("points")),
+		Where("points > ?", 0))
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []StatusSum{{"open", 2, 3}, {"done", 1, 3}}, res)
+
+	res, err = Aggregate[StatusSum](ctx, repo, nil, GroupBy("status"),
+		Select("count(*) AS n"), Having("count(*) > ?", 1))
+	require.NoError(t, err)
+	assert.Equal(t, []StatusSum{{Status: "open", N: 2}}, res)
+
+	type Total struct {
+		Total int
+	}
+	totals, err := Aggregate[Total](ctx, repo, nil, Select("sum(points) AS total"))
+	require.NoError(t, err)
+	assert.Equal(t, []Total{{11}}, totals)
+}
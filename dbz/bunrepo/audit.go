@@ -0,0 +1,96 @@
+package bunrepo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// AuditLog is a row of the audit table written by [AuditHooks].
+type AuditLog struct {
+	bun.BaseModel `bun:"table:audit_logs,alias:al"`
+
+	ID int64 `bun:",pk,autoincrement"`
+	// Entity is the table name of the entity.
+	Entity string
+	// EntityID is the primary keys of the entity joined by commas.
+	EntityID string
+	Op       ChangeOp
+	Actor    string
+	// Diff is the JSON of [Change.Diff].
+	Diff      json.RawMessage `bun:"type:jsonb"`
+	CreatedAt time.Time
+}
+
+// AuditOption is the option of [AuditHooks].
+type AuditOption func(o *auditOptions)
+
+type auditOptions struct {
+	table string
+	actor func(ctx context.Context) string
+}
+
+// AuditTable sets the audit table, default to `audit_logs`, see [AuditLog] for the columns.
+func AuditTable(name string) AuditOption {
+	return func(o *auditOptions) {
+		o.table = name
+	}
+}
+
+// AuditActor sets the func getting the actor like the user ID from the context.
+func AuditActor(f func(ctx context.Context) string) AuditOption {
+	return func(o *auditOptions) {
+		o.actor = f
+	}
+}
+
+// AuditHooks returns the hooks writing an [AuditLog] with the JSON diff after each change,
+// in the same transaction as the change.
+//
+// Example:
+//
+//	repo := bunrepo.New(db, bunrepo.WithHooks(bunrepo.AuditHooks[User](
+//		bunrepo.AuditActor(func(ctx context.Context) string { return auth.UserID(ctx) }),
+//	)))
+func AuditHooks[T any](opts ...AuditOption) Hooks[T] {
+	o := auditOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	h := func(ctx context.Context, db bun.IDB, c *Change[T]) error {
+		if len(c.Columns) == 0 {
+			return nil
+		}
+		d, err := json.Marshal(c.Diff)
+		if err != nil {
+			return fmt.Errorf("marshal diff: %w", err)
+		}
+
+		table := db.Dialect().Tables().Get(reflect.TypeFor[T]())
+		log := &AuditLog{
+			Entity:    table.Name,
+			EntityID:  pkString(table, c.Entity),
+			Op:        c.Op,
+			Diff:      d,
+			CreatedAt: time.Now(),
+		}
+		if o.actor != nil {
+			log.Actor = o.actor(ctx)
+		}
+
+		q := db.NewInsert().Model(log)
+		if o.table != "" {
+			q.ModelTableExpr("?", bun.Ident(o.table))
+		}
+		if _, err = q.Exec(ctx); err != nil {
+			return fmt.Errorf("insert audit log: %w", err)
+		}
+		return nil
+	}
+	return Hooks[T]{AfterAdd: h, AfterUpd: h, AfterDel: h}
+}
@@ -0,0 +1,341 @@
+package bunrepo
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+	"github.com/uptrace/bun/dialect/feature"
+	"github.com/uptrace/bun/schema"
+)
+
+// ##################### Upsertm #####################
+
+type UpsertOption interface {
+	ApplyUpsert(o *upsertOption)
+}
+
+type upsertOption struct {
+	Conflict  []string
+	Update    []string
+	ChunkSize int
+}
+
+// ConflictColumns specifies the columns of the unique constraint to check when upserting,
+// default to the primary keys.
+func ConflictColumns(cols ...string) UpsertOption {
+	return conflictColumnsOption(cols)
+}
+
+type conflictColumnsOption []string
+
+func (co conflictColumnsOption) ApplyUpsert(o *upsertOption) {
+	o.Conflict = co
+}
+
+// UpdateColumns specifies the columns to update on conflicts,
+// default to all the columns except the primary keys and the conflict columns.
+// It does nothing on conflicts without columns.
+func UpdateColumns(cols ...string) UpsertOption {
+	return updateColumnsOption(cols)
+}
+
+type updateColumnsOption []string
+
+func (uo updateColumnsOption) ApplyUpsert(o *upsertOption) {
+	o.Update = append([]string{}, uo...)
+}
+
+type GetUpsertOption interface {
+	GetOption
+	UpsertOption
+}
+
+// ChunkSize sets the number of rows in each INSERT of [Repo.Upsertm],
+// default to the max allowed by the parameter limit of the dialect,
+// or in each SELECT or FETCH of [Repo.Iter], default to 1000.
+func ChunkSize(n int) GetUpsertOption {
+	return chunkSizeOption(n)
+}
+
+type chunkSizeOption int
+
+func (co chunkSizeOption) ApplyUpsert(o *upsertOption) {
+	o.ChunkSize = int(co)
+}
+
+func (co chunkSizeOption) ApplyGet(o *getOption) {
+	o.ChunkSize = int(co)
+}
+
+// Upsertm inserts the entities, or updates the existing rows on conflicts with
+// `ON CONFLICT (...) DO UPDATE SET col = EXCLUDED.col`,
+// or `ON DUPLICATE KEY UPDATE col = VALUES(col)` on MySQL.
+//
+// The entities are inserted in chunks to stay under the parameter limit,
+// and the chunks are run in a transaction if there are more than one.
+// The hooks are not called.
+// The tenant-scoped upserts with updates are unsupported on MySQL, see [WithTenant].
+func (repo *Repo[T]) Upsertm(ctx context.Context, entities []*T, opts ...UpsertOption,
+) (sql.Result, error) {
+	o := upsertOption{}
+	for _, opt := range opts {
+		opt.ApplyUpsert(&o)
+	}
+	if err := repo.setTenant(ctx, entities...); err != nil {
+		return nil, err
+	}
+	restore, err := repo.encrypt(ctx, entities...)
+	if err != nil {
+		return nil, err
+	}
+	defer restore()
+	table := repo.db.Dialect().Tables().Get(reflect.TypeFor[T]())
+	if len(o.Conflict) == 0 {
+		o.Conflict = pkNames(table)
+	}
+	if o.Update == nil {
+		for _, f := range table.Fields {
+			if !f.IsPK && !slices.Contains(o.Conflict, f.Name) {
+				o.Update = append(o.Update, f.Name)
+			}
+		}
+	}
+	if repo.tenant != "" && len(o.Update) != 0 && repo.db.Dialect().Name() == dialect.MySQL {
+		// ON DUPLICATE KEY UPDATE has no WHERE clause to keep the rows of other tenants.
+		return nil, fmt.Errorf("tenant-scoped upsert is unsupported on %s", dialect.MySQL)
+	}
+	size := o.ChunkSize
+	if size <= 0 {
+		size = max(maxParams(repo.db.Dialect().Name())/max(len(table.Fields), 1), 1)
+	}
+	if len(entities) <= size {
+		return repo.upsert(ctx, repo.db, entities, &o)
+	}
+
+	var sum int64
+	err = repo.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		for chunk := range slices.Chunk(entities, size) {
+			res, err := repo.upsert(ctx, tx, chunk, &o)
+			if err != nil {
+				return err
+			}
+			n, _ := res.RowsAffected()
+			sum += n
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(sum), nil
+}
+
+func (repo *Repo[T]) upsert(ctx context.Context, db bun.IDB, entities []*T, o *upsertOption,
+) (sql.Result, error) {
+	q := db.NewInsert().Model(&entities)
+	mysql := db.Dialect().Name() == dialect.MySQL
+	switch {
+	case len(o.Update) == 0 && mysql:
+		q.Ignore()
+	case len(o.Update) == 0:
+		q.On("CONFLICT (?) DO NOTHING", bun.In(idents(o.Conflict)))
+	case mysql:
+		q.On("DUPLICATE KEY UPDATE")
+		for _, col := range o.Update {
+			q.Set("? = VALUES(?)", bun.Ident(col), bun.Ident(col))
+		}
+	default:
+		q.On("CONFLICT (?) DO UPDATE", bun.In(idents(o.Conflict)))
+		for _, col := range o.Update {
+			q.Set("? = EXCLUDED.?", bun.Ident(col), bun.Ident(col))
+		}
+		if repo.tenant != "" {
+			table := "?TableName"
+			if db.Dialect().Features().Has(feature.InsertTableAlias) {
+				table = "?TableAlias"
+			}
+			q.Where(table+".? = EXCLUDED.?", bun.Ident(repo.tenant), bun.Ident(repo.tenant))
+		}
+	}
+	if repo.returning != "" {
+		q.Returning(repo.returning)
+	}
+	return q.Exec(ctx)
+}
+
+// maxParams returns the max number of the parameters in a query of the dialect.
+func maxParams(name dialect.Name) int {
+	switch name {
+	case dialect.SQLite:
+		return 32766
+	case dialect.MSSQL:
+		return 2100
+	}
+	return 65535
+}
+
+func pkNames(table *schema.Table) []string {
+	res := make([]string, len(table.PKs))
+	for i, pk := range table.PKs {
+		res[i] = pk.Name
+	}
+	return res
+}
+
+func idents(cols []string) []bun.Ident {
+	res := make([]bun.Ident, len(cols))
+	for i, col := range cols {
+		res[i] = bun.Ident(col)
+	}
+	return res
+}
+
+// ##################### CopyFrom #####################
+
+// ErrCopyUnsupported is returned by [Repo.CopyFrom] if the dialect is not Postgres,
+// or the repo is created with a transaction.
+var ErrCopyUnsupported = errors.New("copy is unsupported")
+
+// CopyFunc runs `COPY ... FROM STDIN` with the rows read from r on the conn,
+// which has the same signature as `pgdriver.CopyFrom`.
+type CopyFunc func(ctx context.Context, conn bun.Conn, r io.Reader, query string, args ...any,
+) (sql.Result, error)
+
+// CopyFrom bulk-loads the entities with `COPY ... FROM STDIN` on Postgres,
+// which is much faster than INSERT for millions of rows.
+// The rows are encoded in the text format and streamed to the copy func.
+//
+// The auto-increment columns and the columns with SQL defaults are skipped
+// unless specified by the [Columns] option, and [ExcludeColumns] excludes more.
+// The hooks are not called.
+//
+// Example:
+//
+//	res, err := repo.CopyFrom(ctx, users, pgdriver.CopyFrom)
+func (repo *Repo[T]) CopyFrom(ctx context.Context, entities []*T, f CopyFunc, opts ...AddOption,
+) (sql.Result, error) {
+	o := addOption{}
+	for _, opt := range opts {
+		opt.ApplyAdd(&o)
+	}
+	if repo.db.Dialect().Name() != dialect.PG {
+		return nil, fmt.Errorf("%w on %s", ErrCopyUnsupported, repo.db.Dialect().Name())
+	}
+	if err := repo.setTenant(ctx, entities...); err != nil {
+		return nil, err
+	}
+	restore, err := repo.encrypt(ctx, entities...)
+	if err != nil {
+		return nil, err
+	}
+	defer restore()
+
+	var conn bun.Conn
+	switch db := repo.db.(type) {
+	case *bun.DB:
+		c, err := db.Conn(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("conn: %w", err)
+		}
+		defer c.Close()
+		conn = c
+	case bun.Conn:
+		conn = db
+	default:
+		return nil, fmt.Errorf("%w with %T", ErrCopyUnsupported, repo.db)
+	}
+
+	table := repo.db.Dialect().Tables().Get(reflect.TypeFor[T]())
+	fields := copyFields(table, &o.Columns)
+	cols := make([]string, len(fields))
+	for i, field := range fields {
+		cols[i] = string(field.SQLName)
+	}
+	query := fmt.Sprintf("COPY %s (%s) FROM STDIN", table.SQLName, strings.Join(cols, ", "))
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := writeCopyRows(pw, schema.NewFormatter(repo.db.Dialect()), fields, entities)
+		pw.CloseWithError(err)
+		done <- err
+	}()
+	res, err := f(ctx, conn, pr, query)
+	// Unblocks the writer if the copy returns early,
+	// and waits for it to stop reading the entities before restoring them.
+	pr.CloseWithError(io.ErrClosedPipe)
+	werr := <-done
+	if err != nil {
+		return nil, fmt.Errorf("copy: %w", err)
+	}
+	if werr != nil {
+		return nil, fmt.Errorf("write rows: %w", werr)
+	}
+	return res, nil
+}
+
+func copyFields(table *schema.Table, o *columnsOption) (res []*schema.Field) {
+	for _, f := range table.Fields {
+		switch {
+		case len(o.Include) != 0:
+			if !slices.Contains(o.Include, f.Name) {
+				continue
+			}
+		case f.AutoIncrement, f.Identity, f.SQLDefault != "":
+			continue
+		}
+		if slices.Contains(o.Exclude, f.Name) {
+			continue
+		}
+		res = append(res, f)
+	}
+	return
+}
+
+// writeCopyRows writes the entities in the text format of COPY.
+//
+// See https://www.postgresql.org/docs/current/sql-copy.html#id-1.9.3.55.9.2
+func writeCopyRows[T any](w io.Writer, fmter schema.Formatter, fields []*schema.Field, entities []*T,
+) error {
+	bw := bufio.NewWriter(w)
+	var b []byte
+	for _, e := range entities {
+		strct := reflect.ValueOf(e).Elem()
+		for i, f := range fields {
+			if i > 0 {
+				bw.WriteByte('\t')
+			}
+			b = f.AppendValue(fmter, b[:0], strct)
+			copyText(bw, string(b))
+		}
+		if err := bw.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// copyText writes the SQL literal in the text format of COPY,
+// NULL is `\N` and the quoted strings are unquoted and escaped.
+func copyText(w *bufio.Writer, lit string) {
+	if lit == "NULL" {
+		w.WriteString(`\N`)
+		return
+	}
+	if len(lit) >= 2 && lit[0] == '\'' && lit[len(lit)-1] == '\'' {
+		lit = strings.ReplaceAll(lit[1:len(lit)-1], "''", "'")
+	}
+	copyEscaper.WriteString(w, lit)
+}
+
+var copyEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
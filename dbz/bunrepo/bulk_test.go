@@ -0,0 +1,113 @@
+package bunrepo
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+	"github.com/uptrace/bun/driver/sqliteshim"
+	"github.com/uptrace/bun/schema"
+
+	"github.com/adobaai/pkg/testingz"
+)
+
+type Stock struct {
+	ID    int    `bun:",pk"`
+	SKU   string `bun:",unique"`
+	Qty   int
+	Note  string
+	Label *string
+}
+
+func TestUpsertm(t *testing.T) {
+	bdb, err := newDB()
+	require.NoError(t, err)
+	ctx := context.Background()
+	testingz.R(bdb.NewCreateTable().Model((*Stock)(nil)).Exec(ctx)).NoError(t)
+	repo := New[Stock](bdb)
+
+	all := func() (res []Stock) {
+		require.NoError(t, bdb.NewSelect().Model(&res).Order("id").Scan(ctx))
+		return
+	}
+
+	ss := []*Stock{{ID: 1, SKU: "a", Qty: 1}, {ID: 2, SKU: "b", Qty: 2}, {ID: 3, SKU: "c", Qty: 3}}
+	testingz.R(repo.Upsertm(ctx, ss, ChunkSize(2))).NoError(t)
+	testingz.R(repo.Upsertm(ctx, []*Stock{{ID: 2, SKU: "b", Qty: 20, Note: "x"}})).NoError(t)
+	assert.Equal(t, []Stock{
+		{ID: 1, SKU: "a", Qty: 1}, {ID: 2, SKU: "b", Qty: 20, Note: "x"}, {ID: 3, SKU: "c", Qty: 3},
+	}, all())
+
+	ss = []*Stock{{ID: 3, SKU: "c", Qty: 30, Note: "y"}, {ID: 4, SKU: "d", Qty: 4}}
+	res, err := repo.Upsertm(ctx, ss, ConflictColumns("sku"), UpdateColumns("qty"), ChunkSize(1))
+	require.NoError(t, err)
+	testingz.R(res.RowsAffected()).NoError(t).Equal(int64(2))
+	assert.Equal(t, []Stock{
+		{ID: 1, SKU: "a", Qty: 1}, {ID: 2, SKU: "b", Qty: 20, Note: "x"},
+		{ID: 3, SKU: "c", Qty: 30}, {ID: 4, SKU: "d", Qty: 4},
+	}, all())
+
+	testingz.R(repo.Upsertm(ctx, []*Stock{{ID: 1, SKU: "a", Qty: 100}}, UpdateColumns())).NoError(t)
+	assert.Equal(t, 1, all()[0].Qty, "do nothing")
+}
+
+func TestCopyFrom(t *testing.T) {
+	bdb, err := newDB()
+	require.NoError(t, err)
+	ctx := context.Background()
+	repo := New[Stock](bdb)
+	_, err = repo.CopyFrom(ctx, []*Stock{{ID: 1}}, nil)
+	require.ErrorIs(t, err, ErrCopyUnsupported)
+
+	t.Run("Early", func(t *testing.T) {
+		sqldb, err := sql.Open(sqliteshim.ShimName, "file::memory:")
+		require.NoError(t, err)
+		db := bun.NewDB(sqldb, pgDialect{sqlitedialect.New()})
+		defer db.Close()
+		repo := New(db, WithEncryption[Patient](StaticKeys("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})))
+
+		ps := []*Patient{{ID: 1, Name: "alice", Phone: "123"}, {ID: 2, Name: "bob"}}
+		stop := errors.New("stop")
+		_, err = repo.CopyFrom(ctx, ps, func(ctx context.Context, conn bun.Conn, r io.Reader, query string,
+			args ...any,
+		) (sql.Result, error) {
+			_, err := r.Read(make([]byte, 1))
+			require.NoError(t, err)
+			return nil, stop
+		})
+		require.ErrorIs(t, err, stop)
+		assert.Equal(t, []*Patient{{ID: 1, Name: "alice", Phone: "123"}, {ID: 2, Name: "bob"}}, ps,
+			"the entities are restored after the writer stops")
+
+		_, err = repo.CopyFrom(ctx, ps, func(context.Context, bun.Conn, io.Reader, string, ...any,
+		) (sql.Result, error) {
+			return nil, nil
+		})
+		require.ErrorIs(t, err, io.ErrClosedPipe, "the rows are not read")
+	})
+
+	t.Run("Rows", func(t *testing.T) {
+		table := bdb.Dialect().Tables().Get(reflect.TypeFor[Stock]())
+		label := "it's"
+		var buf bytes.Buffer
+		require.NoError(t, writeCopyRows(&buf, schema.NewFormatter(bdb.Dialect()), copyFields(table, &columnsOption{}),
+			[]*Stock{{ID: 1, SKU: "a\tb", Qty: 2, Note: "x\\y\nz", Label: &label}, {ID: 2}}))
+		assert.Equal(t, "1\ta\\tb\t2\tx\\\\y\\nz\tit's\n2\t\t0\t\t\\N\n", buf.String())
+	})
+}
+
+// pgDialect is the SQLite dialect named Postgres, which reaches the copy func.
+type pgDialect struct {
+	schema.Dialect
+}
+
+func (pgDialect) Name() dialect.Name { return dialect.PG }
@@ -0,0 +1,384 @@
+package bunrepo
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/schema"
+	"github.com/vmihailenco/msgpack/v5"
+	"golang.org/x/sync/singleflight"
+)
+
+// Cache is the cache used by [CachedRepo], like [LRUCache],
+// or the Redis one in the rediscache package.
+type Cache interface {
+	// Get returns the value of the key, ok is false if the key does not exist or is expired.
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	// Set sets the value of the key, which expires after the ttl, or never if the ttl is 0.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Del deletes the keys.
+	Del(ctx context.Context, keys ...string) error
+}
+
+// ##################### LRUCache #####################
+
+// LRUCache is an in-memory [Cache] evicting the least recently used keys.
+type LRUCache struct {
+	size  int
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type lruEntry struct {
+	Key       string
+	Value     []byte
+	ExpiresAt time.Time
+}
+
+var _ Cache = (*LRUCache)(nil)
+
+// NewLRUCache returns a [LRUCache] holding at most size keys.
+func NewLRUCache(size int) *LRUCache {
+	return &LRUCache{
+		size:  size,
+		ll:    list.New(),
+		items: map[string]*list.Element{},
+	}
+}
+
+func (c *LRUCache) Get(_ context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	e := el.Value.(*lruEntry)
+	if !e.ExpiresAt.IsZero() && time.Now().After(e.ExpiresAt) {
+		c.remove(el)
+		return nil, false, nil
+	}
+	c.ll.MoveToFront(el)
+	return e.Value, true, nil
+}
+
+func (c *LRUCache) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	e := &lruEntry{Key: key, Value: value}
+	if ttl > 0 {
+		e.ExpiresAt = time.Now().Add(ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		el.Value = e
+		c.ll.MoveToFront(el)
+		return nil
+	}
+	c.items[key] = c.ll.PushFront(e)
+	for c.ll.Len() > c.size {
+		c.remove(c.ll.Back())
+	}
+	return nil
+}
+
+func (c *LRUCache) Del(_ context.Context, keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		if el, ok := c.items[key]; ok {
+			c.remove(el)
+		}
+	}
+	return nil
+}
+
+// Len returns the number of the keys including the expired ones.
+func (c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+func (c *LRUCache) remove(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*lruEntry).Key)
+}
+
+// ##################### CachedRepo #####################
+
+// CacheOption is the option of [NewCached].
+type CacheOption func(o *cacheOptions)
+
+type cacheOptions struct {
+	prefix string
+	ttl    time.Duration
+	negTTL time.Duration
+}
+
+// CachePrefix sets the prefix of the cache keys, default to `bunrepo:<table>:`.
+func CachePrefix(prefix string) CacheOption {
+	return func(o *cacheOptions) {
+		o.prefix = prefix
+	}
+}
+
+// CacheTTL sets the ttl of the cached entities, default to 5 minutes, 0 means never expire.
+func CacheTTL(d time.Duration) CacheOption {
+	return func(o *cacheOptions) {
+		o.ttl = d
+	}
+}
+
+// CacheNegativeTTL enables the negative caching, the missing entities are cached
+// for the ttl, so [CachedRepo.Get] returns [sql.ErrNoRows] without querying.
+func CacheNegativeTTL(d time.Duration) CacheOption {
+	return func(o *cacheOptions) {
+		o.negTTL = d
+	}
+}
+
+// notFound is the cached value of the missing entities,
+// which is never a valid msgpack value of a struct.
+var notFound = []byte{0xc1}
+
+// CachedRepo is a [Repo] caching [CachedRepo.Get] by the primary keys.
+//
+// The entities are encoded by msgpack, which encodes all the exported fields
+// regardless of the json tags.
+//
+// The cached entities are deleted after [CachedRepo.Add], [CachedRepo.Addm],
+// [CachedRepo.Upsertm], [CachedRepo.CopyFrom], [CachedRepo.Upd], [CachedRepo.Updm],
+// [CachedRepo.Del], [CachedRepo.Delm] and [CachedRepo.Restore] by the primary keys
+// of the entities, whether they succeed or not.
+// The other methods like [Repo.Updf] do not touch the cache,
+// the stale entities are kept until the ttl in that case.
+//
+// If the repo uses the transaction of [RunInTx], like the one of [FromContext],
+// [CachedRepo.Get] bypasses the cache, and the cached entities are deleted again
+// after the transaction commits, since the concurrent gets outside the transaction
+// may cache the old entities before that. Do not wrap the repo of the other transactions.
+type CachedRepo[T any] struct {
+	*Repo[T]
+	cache Cache
+	table *schema.Table
+	o     cacheOptions
+	group singleflight.Group
+}
+
+// NewCached wraps the repo with the cache.
+//
+// Example:
+//
+//	repo := bunrepo.NewCached(bunrepo.New[User](db), bunrepo.NewLRUCache(1000),
+//		bunrepo.CacheNegativeTTL(time.Minute))
+func NewCached[T any](repo *Repo[T], cache Cache, opts ...CacheOption) *CachedRepo[T] {
+	table := repo.db.Dialect().Tables().Get(reflect.TypeFor[T]())
+	o := cacheOptions{
+		prefix: "bunrepo:" + table.Name + ":",
+		ttl:    5 * time.Minute,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &CachedRepo[T]{Repo: repo, cache: cache, table: table, o: o}
+}
+
+// Get returns the entity by the primary keys from the cache, or from the database on misses.
+// The concurrent misses of the same entity share one query, which is not canceled
+// with the context of any caller, while the caller returns once its context is done.
+//
+// The cache is bypassed if any option is given, since the options change the result.
+// The cache errors on reading are ignored, the entity is got from the database then.
+// The entities of the repo [WithEncryption] are cached encrypted.
+func (repo *CachedRepo[T]) Get(ctx context.Context, entity *T, opts ...GetOption) error {
+	if _, inTx := repo.db.(bun.Tx); inTx || len(opts) != 0 {
+		return repo.Repo.Get(ctx, entity, opts...)
+	}
+
+	key, err := repo.key(ctx, entity)
+	if err != nil {
+		return err
+	}
+	ch := repo.group.DoChan(key, func() (any, error) {
+		ctx := context.WithoutCancel(ctx)
+		if b, ok, err := repo.cache.Get(ctx, key); err == nil && ok {
+			return b, nil
+		}
+
+		e := new(T)
+		*e = *entity
+		switch err := repo.Repo.get(ctx, e); {
+		case errors.Is(err, sql.ErrNoRows):
+			if repo.o.negTTL > 0 {
+				_ = repo.cache.Set(ctx, key, notFound, repo.o.negTTL)
+			}
+			return notFound, nil
+		case err != nil:
+			return nil, err
+		}
+		b, err := msgpack.Marshal(e)
+		if err != nil {
+			return nil, fmt.Errorf("marshal: %w", err)
+		}
+		_ = repo.cache.Set(ctx, key, b, repo.o.ttl)
+		return b, nil
+	})
+	var res singleflight.Result
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case res = <-ch:
+	}
+	if res.Err != nil {
+		return res.Err
+	}
+
+	b := res.Val.([]byte)
+	if string(b) == string(notFound) {
+		return sql.ErrNoRows
+	}
+	if err = msgpack.Unmarshal(b, entity); err != nil {
+		return fmt.Errorf("unmarshal: %w", err)
+	}
+	return repo.decrypt(ctx, entity)
+}
+
+// Add adds the entity and deletes the cached one, which may be a missing one.
+func (repo *CachedRepo[T]) Add(ctx context.Context, entity *T, opts ...AddOption,
+) (sql.Result, error) {
+	res, err := repo.Repo.Add(ctx, entity, opts...)
+	return res, repo.invalidate(ctx, err, entity)
+}
+
+// Addm adds the entities and deletes the cached ones, which may be missing ones.
+func (repo *CachedRepo[T]) Addm(ctx context.Context, entities []*T, opts ...AddOption,
+) (sql.Result, error) {
+	res, err := repo.Repo.Addm(ctx, entities, opts...)
+	return res, repo.invalidate(ctx, err, entities...)
+}
+
+// Upsertm upserts the entities and deletes the cached ones.
+func (repo *CachedRepo[T]) Upsertm(ctx context.Context, entities []*T, opts ...UpsertOption,
+) (sql.Result, error) {
+	res, err := repo.Repo.Upsertm(ctx, entities, opts...)
+	return res, repo.invalidate(ctx, err, entities...)
+}
+
+// CopyFrom copies the entities and deletes the cached ones, which may be missing ones.
+func (repo *CachedRepo[T]) CopyFrom(ctx context.Context, entities []*T, f CopyFunc, opts ...AddOption,
+) (sql.Result, error) {
+	res, err := repo.Repo.CopyFrom(ctx, entities, f, opts...)
+	return res, repo.invalidate(ctx, err, entities...)
+}
+
+// Upd updates the entity and deletes the cached one.
+func (repo *CachedRepo[T]) Upd(ctx context.Context, entity *T, opts ...UpdOption,
+) (sql.Result, error) {
+	res, err := repo.Repo.Upd(ctx, entity, opts...)
+	return res, repo.invalidate(ctx, err, entity)
+}
+
+// Updm updates the entities and deletes the cached ones.
+func (repo *CachedRepo[T]) Updm(ctx context.Context, entities []*T, opts ...UpdOption,
+) (sql.Result, error) {
+	res, err := repo.Repo.Updm(ctx, entities, opts...)
+	return res, repo.invalidate(ctx, err, entities...)
+}
+
+// Del deletes the entity and the cached one.
+func (repo *CachedRepo[T]) Del(ctx context.Context, entity *T, opts ...DelOption,
+) (sql.Result, error) {
+	res, err := repo.Repo.Del(ctx, entity, opts...)
+	return res, repo.invalidate(ctx, err, entity)
+}
+
+// Delm deletes the entities and the cached ones.
+func (repo *CachedRepo[T]) Delm(ctx context.Context, entities []*T, opts ...DelOption,
+) (sql.Result, error) {
+	res, err := repo.Repo.Delm(ctx, entities, opts...)
+	return res, repo.invalidate(ctx, err, entities...)
+}
+
+// Restore restores the entity and deletes the cached one.
+func (repo *CachedRepo[T]) Restore(ctx context.Context, entity *T, opts ...UpdOption,
+) (sql.Result, error) {
+	res, err := repo.Repo.Restore(ctx, entity, opts...)
+	return res, repo.invalidate(ctx, err, entity)
+}
+
+// Invalidate deletes the cached entities by their primary keys.
+func (repo *CachedRepo[T]) Invalidate(ctx context.Context, entities ...*T) error {
+	keys, err := repo.keys(ctx, entities)
+	if err != nil {
+		return err
+	}
+	return repo.del(ctx, keys)
+}
+
+func (repo *CachedRepo[T]) del(ctx context.Context, keys []string) error {
+	if err := repo.cache.Del(ctx, keys...); err != nil {
+		return fmt.Errorf("invalidate cache: %w", err)
+	}
+	return nil
+}
+
+// invalidate deletes the cached entities after a change, and joins the errors.
+// The entities of a transaction are deleted again after it commits,
+// ignoring the errors since the changes have been committed.
+func (repo *CachedRepo[T]) invalidate(ctx context.Context, err error, entities ...*T) error {
+	if errors.Is(err, ErrNoTenant) {
+		return err
+	}
+	keys, kerr := repo.keys(ctx, entities)
+	if kerr != nil {
+		return errors.Join(err, kerr)
+	}
+	if _, inTx := repo.db.(bun.Tx); inTx {
+		onCommit(ctx, func(ctx context.Context) { _ = repo.del(ctx, keys) })
+	}
+	return errors.Join(err, repo.del(ctx, keys))
+}
+
+func (repo *CachedRepo[T]) keys(ctx context.Context, entities []*T) ([]string, error) {
+	res := make([]string, len(entities))
+	for i, e := range entities {
+		key, err := repo.key(ctx, e)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = key
+	}
+	return res, nil
+}
+
+// key returns the cache key of the entity, which contains the tenant if the repo is scoped.
+func (repo *CachedRepo[T]) key(ctx context.Context, entity *T) (string, error) {
+	if repo.tenant == "" {
+		return repo.o.prefix + pkString(repo.table, entity), nil
+	}
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return "", ErrNoTenant
+	}
+	return fmt.Sprintf("%s%v:%s", repo.o.prefix, tenant, pkString(repo.table, entity)), nil
+}
+
+// pkString returns the primary keys of the entity joined by commas.
+func pkString[T any](table *schema.Table, entity *T) string {
+	strct := reflect.ValueOf(entity).Elem()
+	ids := make([]string, len(table.PKs))
+	for i, pk := range table.PKs {
+		ids[i] = fmt.Sprint(pk.Value(strct).Interface())
+	}
+	return strings.Join(ids, ",")
+}
@@ -0,0 +1,156 @@
+package bunrepo
+
+import (
+	"context"
+	"database/sql"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+
+	"github.com/adobaai/pkg/testingz"
+)
+
+type Profile struct {
+	ID     int `bun:",pk"`
+	Name   string
+	Secret string `json:"-"`
+}
+
+type countHook struct {
+	n atomic.Int32
+}
+
+func (h *countHook) BeforeQuery(ctx context.Context, _ *bun.QueryEvent) context.Context {
+	h.n.Add(1)
+	return ctx
+}
+
+func (h *countHook) AfterQuery(context.Context, *bun.QueryEvent) {}
+
+func TestLRUCache(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRUCache(2)
+	require.NoError(t, c.Set(ctx, "a", []byte("1"), 0))
+	require.NoError(t, c.Set(ctx, "b", []byte("2"), 0))
+	_, _, err := c.Get(ctx, "a")
+	require.NoError(t, err)
+	require.NoError(t, c.Set(ctx, "c", []byte("3"), 0))
+	assert.Equal(t, 2, c.Len())
+
+	var ok bool
+	_, ok, err = c.Get(ctx, "b")
+	require.NoError(t, err)
+	assert.False(t, ok, "b is the least recently used")
+	v, ok, err := c.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "1", string(v))
+
+	require.NoError(t, c.Set(ctx, "d", []byte("4"), time.Millisecond))
+	time.Sleep(2 * time.Millisecond)
+	_, ok, err = c.Get(ctx, "d")
+	require.NoError(t, err)
+	assert.False(t, ok, "d is expired")
+
+	require.NoError(t, c.Del(ctx, "a", "x"))
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestCachedRepo(t *testing.T) {
+	bdb, err := newDB()
+	require.NoError(t, err)
+	ctx := context.Background()
+	testingz.R(bdb.NewCreateTable().Model((*Profile)(nil)).Exec(ctx)).NoError(t)
+	hook := &countHook{}
+	bdb.AddQueryHook(hook)
+
+	cache := NewLRUCache(10)
+	repo := NewCached(New[Profile](bdb), cache, CacheNegativeTTL(time.Minute))
+	testingz.R(repo.Addm(ctx, []*Profile{{ID: 1, Name: "a", Secret: "s"}})).NoError(t)
+
+	get := func(id int) (*Profile, error) {
+		p := &Profile{ID: id}
+		return p, repo.Get(ctx, p)
+	}
+
+	n := hook.n.Load()
+	got, err := get(1)
+	require.NoError(t, err)
+	assert.Equal(t, &Profile{ID: 1, Name: "a", Secret: "s"}, got)
+	got, err = get(1)
+	require.NoError(t, err)
+	assert.Equal(t, &Profile{ID: 1, Name: "a", Secret: "s"}, got)
+	assert.Equal(t, n+1, hook.n.Load(), "the second get is cached")
+
+	testingz.R(repo.Updf(ctx, &Profile{ID: 1}, func(q *bun.UpdateQuery) *bun.UpdateQuery {
+		return q.Set("name = ?", "b").WherePK()
+	})).NoError(t)
+	got, err = get(1)
+	require.NoError(t, err)
+	assert.Equal(t, "a", got.Name, "Updf does not invalidate")
+
+	testingz.R(repo.Upd(ctx, &Profile{ID: 1, Name: "c"})).NoError(t)
+	got, err = get(1)
+	require.NoError(t, err)
+	assert.Equal(t, "c", got.Name)
+
+	t.Run("Options", func(t *testing.T) {
+		p := &Profile{ID: 1}
+		require.NoError(t, repo.Get(ctx, p, Columns("id")))
+		assert.Equal(t, &Profile{ID: 1}, p)
+	})
+
+	t.Run("Negative", func(t *testing.T) {
+		_, err := get(2)
+		require.ErrorIs(t, err, sql.ErrNoRows)
+		testingz.R(repo.Addf(ctx, &Profile{ID: 2}, func(q *bun.InsertQuery) *bun.InsertQuery {
+			return q
+		})).NoError(t)
+		_, err = get(2)
+		require.ErrorIs(t, err, sql.ErrNoRows, "the missing one is cached")
+
+		require.NoError(t, repo.Invalidate(ctx, &Profile{ID: 2}))
+		got, err := get(2)
+		require.NoError(t, err)
+		assert.Equal(t, &Profile{ID: 2}, got)
+	})
+
+	t.Run("Del", func(t *testing.T) {
+		testingz.R(repo.Del(ctx, &Profile{ID: 1})).NoError(t)
+		_, err := get(1)
+		require.ErrorIs(t, err, sql.ErrNoRows)
+		testingz.R(repo.Addm(ctx, []*Profile{{ID: 1, Name: "d"}})).NoError(t)
+		got, err := get(1)
+		require.NoError(t, err)
+		assert.Equal(t, "d", got.Name)
+	})
+
+	t.Run("Tx", func(t *testing.T) {
+		cached := func(ctx context.Context) bool {
+			_, ok, err := cache.Get(ctx, "bunrepo:profiles:1")
+			require.NoError(t, err)
+			return ok
+		}
+		err := RunInTx(ctx, bdb, nil, func(ctx context.Context, tx bun.Tx) error {
+			repo := NewCached(FromContext[Profile](ctx, bdb), cache)
+			testingz.R(repo.Upd(ctx, &Profile{ID: 1, Name: "e"})).NoError(t)
+			got := &Profile{ID: 1}
+			require.NoError(t, repo.Get(ctx, got))
+			assert.Equal(t, "e", got.Name)
+			assert.False(t, cached(ctx), "the uncommitted entity is not cached")
+
+			// A concurrent get outside the transaction caches the old entity.
+			require.NoError(t, cache.Set(ctx, "bunrepo:profiles:1", []byte("stale"), 0))
+			return nil
+		})
+		require.NoError(t, err)
+		assert.False(t, cached(ctx), "invalidated after the commit")
+		got, err := get(1)
+		require.NoError(t, err)
+		assert.Equal(t, "e", got.Name)
+	})
+}
@@ -1,38 +1,103 @@
 package bunrepo
 
 import (
+	"errors"
 	"fmt"
-	"reflect"
 	"strings"
 
 	"github.com/uptrace/bun"
 	"github.com/uptrace/bun/dialect"
 
 	"github.com/adobaai/pkg/dbz"
-	"github.com/adobaai/pkg/strz"
+	"github.com/adobaai/pkg/dbz/predicate"
 )
 
-// For sets row locking for Bun ORM.
-func For(q *bun.SelectQuery, f dbz.For) *bun.SelectQuery {
-	if f == dbz.Nothing {
+// For sets row locking for Bun ORM with the modifiers like [dbz.SkipLocked].
+//
+// It renders `FOR ...` on Postgres and MySQL 8, where [dbz.NoKeyUpdate] and [dbz.KeyShare]
+// fall back to the stronger `UPDATE` and `SHARE` on MySQL.
+// It does nothing on SQLite, which locks the whole database in write transactions,
+// and panics on the other dialects or with both [dbz.NoWait] and [dbz.SkipLocked],
+// see [Lock] for the variant returning the error by the query.
+func For(q *bun.SelectQuery, f dbz.For, opts ...dbz.LockOption) *bun.SelectQuery {
+	s, err := forClause(q.DB().Dialect().Name(), dbz.NewLock(f, opts...))
+	if err != nil {
+		panic("bunrepo: " + err.Error())
+	}
+	if s == "" {
+		return q
+	}
+	return q.For(s)
+}
+
+// Lock sets row locking for Bun ORM like [For],
+// but the error of the unsupported lock is returned when the query is executed.
+func Lock(q *bun.SelectQuery, l dbz.Lock) *bun.SelectQuery {
+	s, err := forClause(q.DB().Dialect().Name(), l)
+	if err != nil {
+		return q.Err(fmt.Errorf("lock: %w", err))
+	}
+	if s == "" {
 		return q
 	}
+	return q.For(s)
+}
+
+// forClause returns the clause after `FOR`, empty if there is no locking.
+func forClause(name dialect.Name, l dbz.Lock) (string, error) {
+	if l.For == dbz.Nothing || name == dialect.SQLite {
+		return "", nil
+	}
+	if l.NoWait && l.SkipLocked {
+		return "", errors.New("NOWAIT and SKIP LOCKED are exclusive")
+	}
 
 	s := ""
-	name := q.DB().Dialect().Name()
 	switch name {
 	case dialect.PG:
-		switch f {
+		switch l.For {
 		case dbz.Update:
 			s = "UPDATE"
 		case dbz.Share:
 			s = "SHARE"
+		case dbz.NoKeyUpdate:
+			s = "NO KEY UPDATE"
+		case dbz.KeyShare:
+			s = "KEY SHARE"
+		}
+	case dialect.MySQL:
+		switch l.For {
+		case dbz.Update, dbz.NoKeyUpdate:
+			s = "UPDATE"
+		case dbz.Share, dbz.KeyShare:
+			s = "SHARE"
 		}
 	}
 	if s == "" {
-		panic(fmt.Sprintf("bunrepo: unsupported row locking mode %v for %s", f, name))
+		return "", fmt.Errorf("unsupported row locking mode %v for %s", l.For, name)
 	}
-	return q.For(s)
+
+	if len(l.Of) != 0 {
+		tables := make([]string, len(l.Of))
+		for i, t := range l.Of {
+			tables[i] = string(dialect.AppendIdent(nil, t, identQuote(name)))
+		}
+		s += " OF " + strings.Join(tables, ", ")
+	}
+	switch {
+	case l.NoWait:
+		s += " NOWAIT"
+	case l.SkipLocked:
+		s += " SKIP LOCKED"
+	}
+	return s, nil
+}
+
+func identQuote(name dialect.Name) byte {
+	if name == dialect.MySQL {
+		return '`'
+	}
+	return '"'
 }
 
 // ParseColonOrders parses orders with colons like `name:desc` or `age:asc:nulls:first`.
@@ -73,59 +138,101 @@ func List(q *bun.SelectQuery, p dbz.ListParams) *bun.SelectQuery {
 // BuildQuery builds a [bun.QueryBuilder] func from a query struct,
 // which can be passed to the `ApplyQueryBuilder' func.
 //
-// It will ignore zero value fields and use the `fp` tag as the column name.
-// If no tag, it will generate column names from struct field names
-// by underscoring them.
-// For example, struct field `UserID` gets column name `user_id`.
-// If the `fp` tag is set to "-", the field will be skipped.
+// The query struct is compiled by [predicate.FromStruct], see it for the details,
+// except that the fields implementing `BuildFieldBun(name string, qb bun.QueryBuilder)`
+// but not [predicate.Exprer] build the WHERE clause by themselves.
 func BuildQuery(p any) (func(bun.QueryBuilder) bun.QueryBuilder, error) {
-	if p == nil {
-		return func(qb bun.QueryBuilder) bun.QueryBuilder { return qb }, nil
-	}
-
-	v := reflect.ValueOf(p)
-	if v.Kind() == reflect.Pointer {
-		v = v.Elem()
-	}
-	if v.Kind() != reflect.Struct {
-		return nil,
-			fmt.Errorf("the p should be a struct or struct pointer, got %v", v.Kind())
-	}
-
-	return func(qb bun.QueryBuilder) (res bun.QueryBuilder) {
-		t := v.Type()
-		for i := range v.NumField() {
-			f := v.Field(i)
-			fi := f.Interface()
-			if f.IsZero() {
-				continue
-			}
-
-			if _, ok := fi.(dbz.For); ok {
-				continue
-			}
-			if _, ok := fi.(dbz.ListParams); ok {
-				continue
-			}
-
-			ft := t.Field(i)
-			fName := ft.Tag.Get("fp")
-			if fName == "-" {
-				continue
-			}
-			if fName == "" {
-				fName = strz.Underscore(ft.Name)
-			}
-
-			b, ok := fi.(interface {
-				BuildFieldBun(name string, qb bun.QueryBuilder)
-			})
-			if ok {
-				b.BuildFieldBun(fName, qb)
-			} else {
-				qb.Where(fName+" = ?", fi)
-			}
+	e, builders, err := compileQuery(p)
+	if err != nil {
+		return nil, err
+	}
+	return whereQuery(e, builders), nil
+}
+
+// fieldBuilder builds the WHERE clause of a field of the query struct.
+type fieldBuilder interface {
+	BuildFieldBun(name string, qb bun.QueryBuilder)
+}
+
+type namedBuilder struct {
+	Name string
+	fieldBuilder
+}
+
+// compileQuery compiles the query struct to an expr and the field builders.
+func compileQuery(p any) (e predicate.Expr, builders []namedBuilder, err error) {
+	var es []predicate.Expr
+	err = predicate.WalkStruct(p, func(column string, v any) {
+		switch v := v.(type) {
+		case predicate.Exprer:
+			es = append(es, v.Expr(column))
+		case fieldBuilder:
+			builders = append(builders, namedBuilder{column, v})
+		default:
+			es = append(es, predicate.Cond{Column: column, Op: predicate.OpEQ, Value: v})
 		}
+	})
+	return predicate.All(es...), builders, err
+}
+
+func whereQuery(e predicate.Expr, builders []namedBuilder) func(bun.QueryBuilder) bun.QueryBuilder {
+	return func(qb bun.QueryBuilder) bun.QueryBuilder {
+		qb = WhereExpr(qb, e)
+		for _, b := range builders {
+			b.BuildFieldBun(b.Name, qb)
+		}
+		return qb
+	}
+}
+
+// WhereExpr adds the predicate expr to the WHERE clause.
+func WhereExpr(qb bun.QueryBuilder, e predicate.Expr) bun.QueryBuilder {
+	if e == nil {
 		return qb
-	}, nil
+	}
+	_, isOr := e.(predicate.OrExpr)
+	q, args := bunExpr(e, isOr)
+	return qb.Where(q, args...)
+}
+
+func bunExpr(e predicate.Expr, nested bool) (q string, args []any) {
+	switch e := e.(type) {
+	case predicate.Cond:
+		return bunCond(e)
+	case predicate.NotExpr:
+		q, args = bunExpr(e.X, true)
+		return "NOT " + q, args
+	case predicate.AndExpr:
+		return bunList(e, " AND ", nested)
+	case predicate.OrExpr:
+		return bunList(e, " OR ", nested)
+	}
+	return
+}
+
+func bunList(es []predicate.Expr, sep string, nested bool) (string, []any) {
+	var (
+		qs   = make([]string, len(es))
+		args []any
+	)
+	for i, e := range es {
+		q, a := bunExpr(e, true)
+		qs[i] = q
+		args = append(args, a...)
+	}
+	q := strings.Join(qs, sep)
+	if nested {
+		q = "(" + q + ")"
+	}
+	return q, args
+}
+
+func bunCond(c predicate.Cond) (string, []any) {
+	q, args := c.SQL()
+	for i, arg := range args {
+		if id, ok := arg.(predicate.Ident); ok {
+			args[i] = bun.Ident(id)
+		}
+	}
+	return q, args
 }
@@ -1,9 +1,20 @@
 package bunrepo
 
 import (
+	"context"
+	"database/sql"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+	"github.com/uptrace/bun/driver/sqliteshim"
+	"github.com/uptrace/bun/schema"
+
+	"github.com/adobaai/pkg/dbz"
+	"github.com/adobaai/pkg/dbz/predicate"
 )
 
 type fakeListParams struct {
@@ -86,3 +97,116 @@ func TestColonOrders(t *testing.T) {
 		assert.Equal(t, expected, got.GetOrders())
 	})
 }
+
+func TestWhereExpr(t *testing.T) {
+	db, err := newDB()
+	require.NoError(t, err)
+
+	type Query struct {
+		ProviderID string
+		ID         *predicate.Field[int] `fp:"p.id"`
+	}
+	qb, err := BuildQuery(&Query{
+		ProviderID: "I-1",
+		ID:         predicate.In([]int{1, 2}).Or().Not().Group(func(f *predicate.Field[int]) { f.IsNull() }),
+	})
+	require.NoError(t, err)
+	q := db.NewSelect().Model((*Payment)(nil)).Column("id").ApplyQueryBuilder(qb)
+	assert.Equal(t, `SELECT "p"."id" FROM "payments" AS "p" WHERE ("provider_id" = 'I-1' AND `+
+		`("p"."id" IN (1, 2) OR NOT "p"."id" IS NULL))`, q.String())
+
+	q = db.NewSelect().Model((*Payment)(nil)).Column("id").Where("1 = 1").
+		ApplyQueryBuilder(func(qb bun.QueryBuilder) bun.QueryBuilder {
+			return WhereExpr(qb, predicate.Any(
+				predicate.Cond{Column: "summary", Op: predicate.OpEQ, Value: "x"},
+				predicate.Cond{Column: "id", Op: predicate.OpIn},
+			))
+		})
+	assert.Equal(t, `SELECT "p"."id" FROM "payments" AS "p" WHERE (1 = 1) AND `+
+		`(("summary" = 'x' OR 1 = 0))`, q.String())
+
+	q = db.NewSelect().Model((*Payment)(nil)).Column("id").
+		ApplyQueryBuilder(func(qb bun.QueryBuilder) bun.QueryBuilder {
+			return WhereExpr(qb, predicate.All(
+				predicate.NewField[string]().HasPrefix("I_").Expr("provider_id"),
+				predicate.NewField[int]().Between(1, 5).Expr("id"),
+				predicate.NewField[any]().JSONHasKey("k", "a").Expr("summary"),
+				predicate.NewField[string]().EqAny([]string{"x", `"y"`}).Expr("summary"),
+			))
+		})
+	assert.Equal(t, `SELECT "p"."id" FROM "payments" AS "p" WHERE (`+
+		`"provider_id" LIKE 'I!_%' ESCAPE '!' AND "id" BETWEEN 1 AND 5 AND `+
+		`("summary" #> '{"a"}') ? 'k' AND "summary" = ANY('{"x","\"y\""}'))`, q.String())
+
+	// The fields building the WHERE clause by themselves, and the deprecated BuildFieldBun.
+	qb, err = BuildQuery(&struct {
+		Summary idsOf
+		ID      *predicate.Field[int]
+	}{Summary: idsOf{"x", "y"}, ID: predicate.GT(1)})
+	require.NoError(t, err)
+	q = db.NewSelect().Model((*Payment)(nil)).Column("id").ApplyQueryBuilder(qb).
+		ApplyQueryBuilder(func(qb bun.QueryBuilder) bun.QueryBuilder {
+			predicate.EQ(1).Or().JSONHasKey("k").BuildFieldBun("p.id", qb)
+			return qb
+		})
+	assert.Equal(t, `SELECT "p"."id" FROM "payments" AS "p" WHERE ("id" > 1) AND `+
+		`("summary" IN ('x', 'y')) AND (("p"."id" = 1 OR "p"."id" ? 'k'))`, q.String())
+
+	_, err = BuildQuery(1)
+	require.Error(t, err)
+}
+
+type idsOf []string
+
+func (ids idsOf) BuildFieldBun(name string, qb bun.QueryBuilder) {
+	qb.Where("? IN (?)", bun.Ident(name), bun.In(ids))
+}
+
+func TestForClause(t *testing.T) {
+	cases := []struct {
+		name    dialect.Name
+		lock    dbz.Lock
+		want    string
+		wantErr string
+	}{
+		{dialect.PG, dbz.NewLock(dbz.Nothing), "", ""},
+		{dialect.PG, dbz.NewLock(dbz.Update), "UPDATE", ""},
+		{dialect.PG, dbz.NewLock(dbz.NoKeyUpdate, dbz.SkipLocked()), "NO KEY UPDATE SKIP LOCKED", ""},
+		{dialect.PG, dbz.NewLock(dbz.KeyShare, dbz.NoWait()), "KEY SHARE NOWAIT", ""},
+		{dialect.PG, dbz.NewLock(dbz.Update, dbz.Of("jobs", "s.t")), `UPDATE OF "jobs", "s"."t"`, ""},
+		{dialect.MySQL, dbz.NewLock(dbz.NoKeyUpdate, dbz.Of("jobs"), dbz.SkipLocked()),
+			"UPDATE OF `jobs` SKIP LOCKED", ""},
+		{dialect.MySQL, dbz.NewLock(dbz.KeyShare), "SHARE", ""},
+		{dialect.SQLite, dbz.NewLock(dbz.Update, dbz.SkipLocked()), "", ""},
+		{dialect.PG, dbz.NewLock(dbz.Update, dbz.NoWait(), dbz.SkipLocked()), "", "exclusive"},
+		{dialect.MSSQL, dbz.NewLock(dbz.Update), "", "unsupported"},
+	}
+	for _, c := range cases {
+		got, err := forClause(c.name, c.lock)
+		if c.wantErr != "" {
+			assert.ErrorContains(t, err, c.wantErr)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, c.want, got)
+	}
+}
+
+// mssqlDialect is the SQLite dialect named MSSQL, which does not support the row locking.
+type mssqlDialect struct {
+	schema.Dialect
+}
+
+func (mssqlDialect) Name() dialect.Name { return dialect.MSSQL }
+
+func TestLock(t *testing.T) {
+	sqldb, err := sql.Open(sqliteshim.ShimName, "file::memory:")
+	require.NoError(t, err)
+	db := bun.NewDB(sqldb, mssqlDialect{sqlitedialect.New()})
+	defer db.Close()
+
+	var n int
+	err = Lock(db.NewSelect().ColumnExpr("1"), dbz.NewLock(dbz.Update)).Scan(context.Background(), &n)
+	require.ErrorContains(t, err, "lock: unsupported row locking mode")
+	assert.Panics(t, func() { For(db.NewSelect(), dbz.Update) })
+}
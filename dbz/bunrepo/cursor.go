@@ -0,0 +1,270 @@
+package bunrepo
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+	"github.com/uptrace/bun/schema"
+
+	"github.com/adobaai/pkg/dbz"
+)
+
+type nulls int8
+
+const (
+	nullsDefault nulls = iota
+	nullsFirst
+	nullsLast
+)
+
+// keysetOrder is a parsed order like `name DESC NULLS FIRST`.
+type keysetOrder struct {
+	Column string
+	Field  *schema.Field
+	Desc   bool
+	Nulls  nulls
+}
+
+func (o keysetOrder) String() string {
+	s := o.Column + " ASC"
+	if o.Desc {
+		s = o.Column + " DESC"
+	}
+	switch o.Nulls {
+	case nullsFirst:
+		s += " NULLS FIRST"
+	case nullsLast:
+		s += " NULLS LAST"
+	}
+	return s
+}
+
+func (o keysetOrder) reverse() keysetOrder {
+	o.Desc = !o.Desc
+	switch o.Nulls {
+	case nullsFirst:
+		o.Nulls = nullsLast
+	case nullsLast:
+		o.Nulls = nullsFirst
+	}
+	return o
+}
+
+// isNullsFirst reports whether NULLs come first,
+// NULLs are larger than any value on Postgres and smaller on the others by default.
+func (o keysetOrder) isNullsFirst(nullsLargest bool) bool {
+	switch o.Nulls {
+	case nullsFirst:
+		return true
+	case nullsLast:
+		return false
+	}
+	return nullsLargest == o.Desc
+}
+
+// parseKeysetOrders parses the orders returned by [ParseColonOrders],
+// and appends the primary keys as the tiebreaker.
+func parseKeysetOrders(table *schema.Table, orders []string) (res []keysetOrder, err error) {
+	for _, order := range orders {
+		parts := strings.Fields(order)
+		if len(parts) == 0 {
+			continue
+		}
+
+		o := keysetOrder{Column: parts[0]}
+		name := o.Column
+		if i := strings.LastIndexByte(name, '.'); i >= 0 {
+			name = name[i+1:]
+		}
+		if o.Field = table.FieldMap[name]; o.Field == nil {
+			return nil, fmt.Errorf("unknown order column %q", o.Column)
+		}
+		switch strings.ToUpper(strings.Join(parts[1:], " ")) {
+		case "", "ASC":
+		case "DESC":
+			o.Desc = true
+		case "ASC NULLS FIRST", "NULLS FIRST":
+			o.Nulls = nullsFirst
+		case "ASC NULLS LAST", "NULLS LAST":
+			o.Nulls = nullsLast
+		case "DESC NULLS FIRST":
+			o.Desc, o.Nulls = true, nullsFirst
+		case "DESC NULLS LAST":
+			o.Desc, o.Nulls = true, nullsLast
+		default:
+			return nil, fmt.Errorf("invalid order %q", order)
+		}
+		res = append(res, o)
+	}
+
+	for _, pk := range table.PKs {
+		if !slices.ContainsFunc(res, func(o keysetOrder) bool { return o.Field == pk }) {
+			res = append(res, keysetOrder{Column: pk.Name, Field: pk})
+		}
+	}
+	return
+}
+
+// keysetWhere builds the condition selecting the rows after the values in the orders:
+//
+//	(a > ?) OR (a = ? AND b > ?) OR ...
+func keysetWhere(orders []keysetOrder, values []any, nullsLargest bool) (string, []any) {
+	var (
+		disjuncts []string
+		args      []any
+		eqs       []string
+		eqArgs    []any
+	)
+	for i, o := range orders {
+		col, v := bun.Ident(o.Column), values[i]
+		op := ">"
+		if o.Desc {
+			op = "<"
+		}
+
+		var after string
+		var afterArgs []any
+		switch {
+		case v == nil && o.isNullsFirst(nullsLargest):
+			after, afterArgs = "? IS NOT NULL", []any{col}
+		case v == nil:
+			// Nothing is after NULLs.
+		case o.isNullsFirst(nullsLargest):
+			after, afterArgs = "? "+op+" ?", []any{col, v}
+		default:
+			after, afterArgs = "(? "+op+" ? OR ? IS NULL)", []any{col, v, col}
+		}
+		if after != "" {
+			disjuncts = append(disjuncts, "("+strings.Join(append(slices.Clone(eqs), after), " AND ")+")")
+			args = append(append(args, eqArgs...), afterArgs...)
+		}
+
+		if v == nil {
+			eqs = append(eqs, "? IS NULL")
+			eqArgs = append(eqArgs, col)
+		} else {
+			eqs = append(eqs, "? = ?")
+			eqArgs = append(eqArgs, col, v)
+		}
+	}
+	if len(disjuncts) == 0 {
+		return "1 = 0", nil
+	}
+	return strings.Join(disjuncts, " OR "), args
+}
+
+func keysetValues(orders []keysetOrder, entity any) []any {
+	strct := reflect.Indirect(reflect.ValueOf(entity))
+	res := make([]any, len(orders))
+	for i, o := range orders {
+		if o.Field.NullZero && o.Field.HasZeroValue(strct) {
+			continue
+		}
+		res[i] = o.Field.Value(strct).Interface()
+	}
+	return res
+}
+
+// Getc gets a page of entities with keyset (cursor) pagination.
+//
+// The orders are parsed by [ParseColonOrders], and the primary keys are appended
+// as the tiebreaker, so the orders should only contain the columns of the table.
+// The cursors are signed by [dbz.DefaultCursorCodec] unless the [CursorCodec] option is given.
+func (repo *Repo[T]) Getc(ctx context.Context, cp dbz.CursorParams, p any, opts ...GetOption,
+) (res dbz.Page[T], err error) {
+	o := repo.getOption(opts)
+	cp = repo.cursorParams(cp, &o)
+	codec := o.Codec
+	if codec == nil {
+		codec = dbz.DefaultCursorCodec()
+	}
+
+	qb, err := repo.buildQuery(ctx, p)
+	if err != nil {
+		return res, fmt.Errorf("build: %w", err)
+	}
+	scope, err := repo.scope(ctx)
+	if err != nil {
+		return res, err
+	}
+	table := repo.db.Dialect().Tables().Get(reflect.TypeFor[T]())
+	orders, err := parseKeysetOrders(table, ParseColonOrders(cp.GetOrders()...))
+	if err != nil {
+		return res, err
+	}
+	keys := make([]string, len(orders))
+	for i, o := range orders {
+		keys[i] = o.String()
+	}
+
+	var c dbz.Cursor
+	hasCursor := cp.GetCursor() != ""
+	if hasCursor {
+		if c, err = codec.DecodeFor(cp.GetCursor(), keys); err != nil {
+			return res, err
+		}
+	}
+
+	q := repo.db.NewSelect().Model(&res.Items).ApplyQueryBuilder(qb).
+		ApplyQueryBuilder(o.QueryBuilder(false)).ApplyQueryBuilder(scope)
+	q = applyGet(q, &o)
+
+	qorders := orders
+	if c.Backward {
+		qorders = make([]keysetOrder, len(orders))
+		for i, o := range orders {
+			qorders[i] = o.reverse()
+		}
+	}
+	if hasCursor {
+		where, args := keysetWhere(qorders, c.Values, repo.db.Dialect().Name() == dialect.PG)
+		q.Where(where, args...)
+	}
+	for _, o := range qorders {
+		q.OrderExpr("?"+strings.TrimPrefix(o.String(), o.Column), bun.Ident(o.Column))
+	}
+	limit := int(dbz.SafeCursorLimit(cp))
+	if err = q.Limit(limit + 1).Scan(ctx); err != nil {
+		return
+	}
+	// The cursors are encoded from the values in the database.
+	defer func() {
+		if err == nil {
+			err = repo.decrypt(ctx, res.Items...)
+		}
+	}()
+
+	more := len(res.Items) > limit
+	if more {
+		res.Items = res.Items[:limit]
+	}
+	if c.Backward {
+		slices.Reverse(res.Items)
+	}
+	if len(res.Items) == 0 {
+		return
+	}
+
+	hasNext, hasPrev := more, hasCursor
+	if c.Backward {
+		hasNext, hasPrev = true, more
+	}
+	if hasNext {
+		next := dbz.Cursor{Orders: keys, Values: keysetValues(orders, res.Items[len(res.Items)-1])}
+		if res.Next, err = codec.Encode(next); err != nil {
+			return
+		}
+	}
+	if hasPrev {
+		prev := dbz.Cursor{Orders: keys, Values: keysetValues(orders, res.Items[0]), Backward: true}
+		if res.Prev, err = codec.Encode(prev); err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,130 @@
+package bunrepo
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+
+	"github.com/adobaai/pkg/dbz"
+	"github.com/adobaai/pkg/testingz"
+)
+
+type Article struct {
+	bun.BaseModel `bun:",alias:a"`
+
+	ID        int `bun:",pk"`
+	Author    string
+	Score     *int
+	CreatedAt time.Time `bun:",nullzero"`
+}
+
+func TestGetc(t *testing.T) {
+	bdb, err := newDB()
+	require.NoError(t, err)
+	ctx := context.Background()
+	testingz.R(bdb.NewCreateTable().Model((*Article)(nil)).Exec(ctx)).NoError(t)
+	repo := New[Article](bdb)
+
+	score := func(i int) *int { return &i }
+	now := time.Now().UTC().Truncate(time.Second)
+	as := []*Article{
+		{ID: 1, Author: "bob", Score: score(3), CreatedAt: now},
+		{ID: 2, Author: "alice", Score: nil, CreatedAt: now.Add(time.Hour)},
+		{ID: 3, Author: "bob", Score: score(1)},
+		{ID: 4, Author: "carol", Score: score(3), CreatedAt: now.Add(-time.Hour)},
+		{ID: 5, Author: "alice", Score: score(2), CreatedAt: now},
+		{ID: 6, Author: "bob", Score: nil},
+		{ID: 7, Author: "carol", Score: score(1), CreatedAt: now.Add(time.Minute)},
+	}
+	testingz.R(repo.Addm(ctx, as)).NoError(t)
+
+	cases := [][]string{
+		nil,
+		{"author:asc", "score:desc"},
+		{"score:asc:nulls:last", "created_at:desc"},
+		{"score:desc:nulls:first", "author"},
+		{"a.author:desc", "created_at:asc"},
+		{"score", "id:desc"},
+	}
+	for _, orders := range cases {
+		t.Run(strings.Join(orders, ","), func(t *testing.T) {
+			var want []*Article
+			require.NoError(t, bdb.NewSelect().Model(&want).
+				Order(append(ParseColonOrders(orders...), "id")...).Scan(ctx))
+
+			ids := func(as []*Article) (res []int) {
+				for _, a := range as {
+					res = append(res, a.ID)
+				}
+				return
+			}
+
+			cp := &dbz.BaseCursor{Limit: 3, Orders: orders}
+			var pages [][]int
+			for {
+				page := testingz.R(repo.Getc(ctx, cp, nil)).NoError(t).V()
+				pages = append(pages, ids(page.Items))
+				assert.Equal(t, cp.Cursor == "", page.Prev == "")
+				if page.Next == "" {
+					break
+				}
+				cp.Cursor = page.Next
+			}
+			assert.Equal(t, ids(want), slices.Concat(pages...))
+			assert.Len(t, pages, 3)
+
+			// Back to the first page.
+			page := testingz.R(repo.Getc(ctx, cp, nil)).NoError(t).V()
+			for i := len(pages) - 2; i >= 0; i-- {
+				require.NotEmpty(t, page.Prev)
+				cp.Cursor = page.Prev
+				page = testingz.R(repo.Getc(ctx, cp, nil)).NoError(t).V()
+				assert.Equal(t, pages[i], ids(page.Items))
+				assert.NotEmpty(t, page.Next)
+			}
+			assert.Empty(t, page.Prev)
+		})
+	}
+
+	t.Run("Filter", func(t *testing.T) {
+		type Query struct {
+			Author string
+		}
+		cp := &dbz.BaseCursor{Limit: 2, Orders: []string{"id:desc"}}
+		page := testingz.R(repo.Getc(ctx, cp, &Query{Author: "bob"})).NoError(t).V()
+		assert.Len(t, page.Items, 2)
+		assert.Equal(t, 6, page.Items[0].ID)
+
+		cp.Cursor = page.Next
+		page = testingz.R(repo.Getc(ctx, cp, &Query{Author: "bob"})).NoError(t).V()
+		assert.Len(t, page.Items, 1)
+		assert.Equal(t, 1, page.Items[0].ID)
+		assert.Empty(t, page.Next)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		cp := &dbz.BaseCursor{Limit: 2}
+		page := testingz.R(repo.Getc(ctx, cp, nil)).NoError(t).V()
+
+		cp.Cursor = page.Next
+		cp.Orders = []string{"author"}
+		testingz.R(repo.Getc(ctx, cp, nil)).ErrorIs(t, dbz.ErrInvalidCursor)
+
+		codec := dbz.NewCursorCodec([]byte("other"))
+		cp.Orders = nil
+		testingz.R(repo.Getc(ctx, cp, nil, CursorCodec(codec))).ErrorIs(t, dbz.ErrInvalidCursor)
+
+		cp = &dbz.BaseCursor{Orders: []string{"password"}}
+		testingz.R(repo.Getc(ctx, cp, nil)).ErrorContains(t, "unknown order column")
+		cp = &dbz.BaseCursor{Orders: []string{"id; DROP TABLE articles"}}
+		testingz.R(repo.Getc(ctx, cp, nil)).ErrorContains(t, "unknown order column")
+		cp = &dbz.BaseCursor{Orders: []string{"id:sideways"}}
+		testingz.R(repo.Getc(ctx, cp, nil)).ErrorContains(t, "invalid order")
+	})
+}
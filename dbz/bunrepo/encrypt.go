@@ -0,0 +1,442 @@
+package bunrepo
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/schema"
+
+	"github.com/adobaai/pkg/dbz/predicate"
+)
+
+var (
+	// ErrUnknownKey is returned if an encrypted value has no key of its key ID.
+	ErrUnknownKey = errors.New("bunrepo: unknown encryption key")
+	// ErrEncryptedQuery is returned if an encrypted column is queried by an unsupported operator,
+	// see [WithEncryption].
+	ErrEncryptedQuery = errors.New("bunrepo: unsupported query on encrypted column")
+)
+
+// KeyProvider provides the keys of the field encryption, see [WithEncryption].
+type KeyProvider interface {
+	// Keys returns the AES keys (16, 24 or 32 bytes) by the key IDs,
+	// and the ID of the current key to encrypt with.
+	// The old keys are kept to decrypt the values encrypted before the rotations,
+	// and the key of an ID should never change.
+	Keys(ctx context.Context) (current string, keys map[string][]byte, err error)
+}
+
+// KeyProviderFunc is a function implementing [KeyProvider].
+type KeyProviderFunc func(ctx context.Context) (string, map[string][]byte, error)
+
+func (f KeyProviderFunc) Keys(ctx context.Context) (string, map[string][]byte, error) {
+	return f(ctx)
+}
+
+// StaticKeys returns the key provider of the fixed keys.
+func StaticKeys(current string, keys map[string][]byte) KeyProvider {
+	return KeyProviderFunc(func(context.Context) (string, map[string][]byte, error) {
+		return current, keys, nil
+	})
+}
+
+// WithEncryption encrypts the string and []byte fields tagged with `encrypt:"true"`
+// with AES-GCM when adding and updating the entities, and decrypts them when getting.
+//
+// The encrypted values are like `<key ID>:<base64 of the nonce and the ciphertext>`,
+// so the keys can be rotated by changing the current key of the provider:
+// the new values are encrypted with the current key,
+// and the old values are still decrypted with their keys.
+// The empty values are not encrypted.
+//
+// The fields tagged with `encrypt:"deterministic"` are encrypted with the nonces derived
+// from the values, so the equal values are encrypted equally with a key,
+// which leaks the equality but makes the `=`, `<>`, IN, NOT IN, IS NULL and IS NOT NULL
+// predicates of [BuildQuery] still work, matching the values encrypted with any key.
+// The other predicates on the encrypted columns return [ErrEncryptedQuery].
+//
+// The entities are encrypted in place during the writes and restored after them,
+// so are the values scanned by the RETURNING clause.
+// The relations and the raw queries are not decrypted,
+// and [CachedRepo] caches the encrypted entities and decrypts them after reading.
+// The non-empty values of the encrypted columns in [Change.Diff] are replaced by [Redacted],
+// so are the diffs written by [AuditHooks].
+//
+// Example:
+//
+//	type User struct {
+//		ID    int64
+//		Email string `encrypt:"deterministic"`
+//		Phone string `encrypt:"true"`
+//	}
+//
+//	kp := bunrepo.StaticKeys("k2", map[string][]byte{"k1": oldKey, "k2": newKey})
+//	repo := bunrepo.New(db, bunrepo.WithEncryption[User](kp))
+//	res, _, err := repo.Getm(ctx, nil, &UserQuery{Email: predicate.EQ("a@example.com")})
+func WithEncryption[T any](kp KeyProvider) RepoOption[T] {
+	return func(repo *Repo[T]) {
+		c := &crypter{kp: kp}
+		table := repo.db.Dialect().Tables().Get(reflect.TypeFor[T]())
+		for _, f := range table.Fields {
+			mode := f.StructField.Tag.Get("encrypt")
+			if mode == "" || mode == "false" {
+				continue
+			}
+			if mode != "true" && mode != "deterministic" {
+				c.err = fmt.Errorf("%s.%s: unknown encryption mode %q", table.TypeName, f.GoName, mode)
+				break
+			}
+			switch f.IndirectType.Kind() {
+			case reflect.String:
+			case reflect.Slice:
+				if f.IndirectType.Elem().Kind() == reflect.Uint8 {
+					break
+				}
+				fallthrough
+			default:
+				c.err = fmt.Errorf("%s.%s: only string and []byte can be encrypted", table.TypeName, f.GoName)
+			}
+			c.fields = append(c.fields, encryptedField{Field: f, Deterministic: mode == "deterministic"})
+		}
+		repo.crypter = c
+	}
+}
+
+// Redacted replaces the values of the encrypted columns in [Change.Diff].
+const Redacted = "[redacted]"
+
+type encryptedField struct {
+	*schema.Field
+	Deterministic bool
+}
+
+// crypter encrypts and decrypts the fields of the entities.
+type crypter struct {
+	kp     KeyProvider
+	fields []encryptedField
+	// err is the error of the fields, returned by all the operations.
+	err   error
+	aeads sync.Map // key ID -> cipher.AEAD
+}
+
+func (c *crypter) aead(id string, key []byte) (cipher.AEAD, error) {
+	if v, ok := c.aeads.Load(id); ok {
+		return v.(cipher.AEAD), nil
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", id, err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", id, err)
+	}
+	c.aeads.Store(id, aead)
+	return aead, nil
+}
+
+func (c *crypter) keys(ctx context.Context) (string, map[string][]byte, error) {
+	if c.err != nil {
+		return "", nil, c.err
+	}
+	current, keys, err := c.kp.Keys(ctx)
+	if err != nil {
+		return "", nil, fmt.Errorf("keys: %w", err)
+	}
+	if _, ok := keys[current]; !ok {
+		return "", nil, fmt.Errorf("%w: %s", ErrUnknownKey, current)
+	}
+	return current, keys, nil
+}
+
+func (c *crypter) encrypt(id string, key, plain []byte, deterministic bool) ([]byte, error) {
+	aead, err := c.aead(id, key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if deterministic {
+		// The nonce is the HMAC of the value with a key derived from the key,
+		// so the equal values get the same ciphertext.
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte("bunrepo deterministic nonce"))
+		mac = hmac.New(sha256.New, mac.Sum(nil))
+		mac.Write(plain)
+		copy(nonce, mac.Sum(nil))
+	} else {
+		rand.Read(nonce)
+	}
+	sealed := aead.Seal(nonce, nonce, plain, nil)
+	res := make([]byte, 0, len(id)+1+base64.RawURLEncoding.EncodedLen(len(sealed)))
+	res = append(append(res, id...), ':')
+	return base64.RawURLEncoding.AppendEncode(res, sealed), nil
+}
+
+func (c *crypter) decrypt(keys map[string][]byte, value []byte) ([]byte, error) {
+	id, enc, ok := strings.Cut(string(value), ":")
+	if !ok {
+		return nil, errors.New("no key ID in the encrypted value")
+	}
+	key, ok := keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, id)
+	}
+	aead, err := c.aead(id, key)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(enc)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("the encrypted value is too short")
+	}
+	n := aead.NonceSize()
+	return aead.Open(nil, sealed[:n], sealed[n:], nil)
+}
+
+// encrypt encrypts the fields of the entities in place,
+// and restore restores the original values.
+func (repo *Repo[T]) encrypt(ctx context.Context, entities ...*T) (restore func(), err error) {
+	c := repo.crypter
+	if c == nil || len(c.fields) == 0 && c.err == nil {
+		return func() {}, nil
+	}
+	current, keys, err := c.keys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var originals []func()
+	restore = func() {
+		for _, f := range originals {
+			f()
+		}
+	}
+	for _, e := range entities {
+		strct := reflect.ValueOf(e).Elem()
+		for _, f := range c.fields {
+			v := f.Value(strct)
+			plain := fieldBytes(v)
+			if len(plain) == 0 {
+				continue
+			}
+			enc, err := c.encrypt(current, keys[current], plain, f.Deterministic)
+			if err != nil {
+				restore()
+				return nil, fmt.Errorf("encrypt %s: %w", f.Name, err)
+			}
+			orig := reflect.New(v.Type()).Elem()
+			orig.Set(v)
+			originals = append(originals, func() { v.Set(orig) })
+			if v.Kind() == reflect.Pointer {
+				// The pointee may be shared with the caller, so encrypt into a new one.
+				p := reflect.New(v.Type().Elem())
+				setFieldBytes(p, enc)
+				v.Set(p)
+			} else {
+				setFieldBytes(v, enc)
+			}
+		}
+	}
+	return restore, nil
+}
+
+// decrypt decrypts the fields of the entities in place.
+func (repo *Repo[T]) decrypt(ctx context.Context, entities ...*T) error {
+	c := repo.crypter
+	if c == nil || len(entities) == 0 || len(c.fields) == 0 && c.err == nil {
+		return nil
+	}
+	_, keys, err := c.keys(ctx)
+	if err != nil {
+		return err
+	}
+	for _, e := range entities {
+		strct := reflect.ValueOf(e).Elem()
+		for _, f := range c.fields {
+			v := f.Value(strct)
+			enc := fieldBytes(v)
+			if len(enc) == 0 {
+				continue
+			}
+			plain, err := c.decrypt(keys, enc)
+			if err != nil {
+				return fmt.Errorf("decrypt %s: %w", f.Name, err)
+			}
+			setFieldBytes(v, plain)
+		}
+	}
+	return nil
+}
+
+// redact replaces the values of the encrypted columns in the diffs.
+func (c *crypter) redact(diffs map[string]Diff) {
+	if c == nil {
+		return
+	}
+	redacted := func(v any) any {
+		if v == nil || len(fieldBytes(reflect.ValueOf(v))) == 0 {
+			return v
+		}
+		return Redacted
+	}
+	for _, f := range c.fields {
+		if d, ok := diffs[f.Name]; ok {
+			diffs[f.Name] = Diff{Old: redacted(d.Old), New: redacted(d.New)}
+		}
+	}
+}
+
+func fieldBytes(v reflect.Value) []byte {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.String {
+		return []byte(v.String())
+	}
+	return v.Bytes()
+}
+
+func setFieldBytes(v reflect.Value, b []byte) {
+	if v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.String {
+		v.SetString(string(b))
+	} else {
+		v.SetBytes(b)
+	}
+}
+
+// encryptExpr encrypts the values of the conditions on the deterministic columns,
+// matching the values encrypted with all the keys.
+func (repo *Repo[T]) encryptExpr(ctx context.Context, e predicate.Expr) (predicate.Expr, error) {
+	c := repo.crypter
+	if c == nil || e == nil {
+		return e, nil
+	}
+	_, keys, err := c.keys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.encryptExpr(keys, e)
+}
+
+func (c *crypter) encryptExpr(keys map[string][]byte, e predicate.Expr) (predicate.Expr, error) {
+	switch e := e.(type) {
+	case predicate.Cond:
+		return c.encryptCond(keys, e)
+	case predicate.NotExpr:
+		x, err := c.encryptExpr(keys, e.X)
+		return predicate.NotExpr{X: x}, err
+	case predicate.AndExpr:
+		es := make(predicate.AndExpr, len(e))
+		for i, e := range e {
+			var err error
+			if es[i], err = c.encryptExpr(keys, e); err != nil {
+				return nil, err
+			}
+		}
+		return es, nil
+	case predicate.OrExpr:
+		es := make(predicate.OrExpr, len(e))
+		for i, e := range e {
+			var err error
+			if es[i], err = c.encryptExpr(keys, e); err != nil {
+				return nil, err
+			}
+		}
+		return es, nil
+	}
+	return e, nil
+}
+
+func (c *crypter) encryptCond(keys map[string][]byte, e predicate.Cond) (predicate.Expr, error) {
+	i := -1
+	for j, f := range c.fields {
+		if f.Name == e.Column {
+			i = j
+			break
+		}
+	}
+	switch {
+	case i < 0:
+		return e, nil
+	case e.Op == predicate.OpIsNull || e.Op == predicate.OpNotNull:
+		return e, nil
+	case !c.fields[i].Deterministic:
+		return nil, fmt.Errorf("%w: %s is not deterministic", ErrEncryptedQuery, e.Column)
+	}
+
+	var values []any
+	switch e.Op {
+	case predicate.OpEQ, predicate.OpNEQ:
+		values = []any{e.Value}
+	case predicate.OpIn, predicate.OpNotIn:
+		values = e.Values
+	default:
+		return nil, fmt.Errorf("%w: %s %s", ErrEncryptedQuery, e.Column, e.Op)
+	}
+	var encs []any
+	for _, v := range values {
+		var plain []byte
+		switch v := v.(type) {
+		case string:
+			plain = []byte(v)
+		case []byte:
+			plain = v
+		default:
+			return nil, fmt.Errorf("%w: %s has %T value", ErrEncryptedQuery, e.Column, v)
+		}
+		if len(plain) == 0 {
+			encs = append(encs, v)
+			continue
+		}
+		for id, key := range keys {
+			enc, err := c.encrypt(id, key, plain, true)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := v.(string); ok {
+				encs = append(encs, string(enc))
+			} else {
+				encs = append(encs, enc)
+			}
+		}
+	}
+
+	res := predicate.Cond{Column: e.Column, Op: predicate.OpIn, Values: encs}
+	if e.Op == predicate.OpNEQ || e.Op == predicate.OpNotIn {
+		res.Op = predicate.OpNotIn
+	}
+	return res, nil
+}
+
+// buildQuery is [BuildQuery] with the values of the encrypted columns encrypted.
+func (repo *Repo[T]) buildQuery(ctx context.Context, p any,
+) (func(bun.QueryBuilder) bun.QueryBuilder, error) {
+	e, builders, err := compileQuery(p)
+	if err != nil {
+		return nil, err
+	}
+	if e, err = repo.encryptExpr(ctx, e); err != nil {
+		return nil, err
+	}
+	return whereQuery(e, builders), nil
+}
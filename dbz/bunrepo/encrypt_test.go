@@ -0,0 +1,158 @@
+package bunrepo
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+
+	"github.com/adobaai/pkg/dbz/predicate"
+	"github.com/adobaai/pkg/testingz"
+)
+
+type Patient struct {
+	ID    int    `bun:",pk"`
+	Name  string `encrypt:"deterministic"`
+	Phone string `encrypt:"true"`
+	Age   int
+}
+
+func TestWithEncryption(t *testing.T) {
+	bdb, err := newDB()
+	require.NoError(t, err)
+	ctx := context.Background()
+	testingz.R(bdb.NewCreateTable().Model((*Patient)(nil)).Exec(ctx)).NoError(t)
+	k1, k2 := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 16)
+	repo := New(bdb, WithEncryption[Patient](StaticKeys("k1", map[string][]byte{"k1": k1})))
+	raw := New[Patient](bdb)
+
+	p1 := &Patient{ID: 1, Name: "alice", Phone: "123", Age: 30}
+	testingz.R(repo.Add(ctx, p1)).NoError(t)
+	assert.Equal(t, &Patient{ID: 1, Name: "alice", Phone: "123", Age: 30}, p1,
+		"the entity is restored")
+	testingz.R(repo.Addm(ctx, []*Patient{{ID: 2, Name: "bob", Phone: "123"}, {ID: 3, Name: "alice"}})).
+		NoError(t)
+
+	stored := &Patient{ID: 1}
+	require.NoError(t, raw.Get(ctx, stored))
+	assert.True(t, strings.HasPrefix(stored.Name, "k1:"), stored.Name)
+	assert.NotContains(t, stored.Phone, "123")
+	p3 := &Patient{ID: 3}
+	require.NoError(t, raw.Get(ctx, p3))
+	assert.Equal(t, stored.Name, p3.Name, "deterministic")
+	p2 := &Patient{ID: 2}
+	require.NoError(t, raw.Get(ctx, p2))
+	assert.NotEqual(t, stored.Phone, p2.Phone, "randomized")
+
+	got := &Patient{ID: 1}
+	require.NoError(t, repo.Get(ctx, got))
+	assert.Equal(t, p1, got)
+
+	t.Run("Cached", func(t *testing.T) {
+		cache := NewLRUCache(10)
+		cached := NewCached(repo, cache)
+		for range 2 {
+			got := &Patient{ID: 1}
+			require.NoError(t, cached.Get(ctx, got))
+			assert.Equal(t, p1, got)
+		}
+		b, ok, err := cache.Get(ctx, "bunrepo:patients:1")
+		require.NoError(t, err)
+		require.True(t, ok)
+		assert.NotContains(t, string(b), "alice", "the entity is cached encrypted")
+	})
+
+	type Query struct {
+		Name  *predicate.Field[string]
+		Phone *predicate.Field[string]
+	}
+	ids := func(res []*Patient) (ids []int) {
+		for _, p := range res {
+			ids = append(ids, p.ID)
+		}
+		return
+	}
+	res, _, err := repo.Getm(ctx, nil, &Query{Name: predicate.EQ("alice")})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []int{1, 3}, ids(res))
+	assert.Equal(t, "123", res[0].Phone+res[1].Phone)
+	_, _, err = repo.Getm(ctx, nil, &Query{Phone: predicate.EQ("123")})
+	assert.ErrorIs(t, err, ErrEncryptedQuery)
+	_, _, err = repo.Getm(ctx, nil, &Query{Name: predicate.GT("a")})
+	assert.ErrorIs(t, err, ErrEncryptedQuery)
+
+	// The old values are still decrypted and queried after the rotation.
+	rotated := New(bdb, WithEncryption[Patient](StaticKeys("k2", map[string][]byte{"k1": k1, "k2": k2})))
+	testingz.R(rotated.Upd(ctx, &Patient{ID: 3, Name: "alice", Phone: "456"})).NoError(t)
+	require.NoError(t, raw.Get(ctx, p3))
+	assert.True(t, strings.HasPrefix(p3.Name, "k2:"), p3.Name)
+	res, _, err = rotated.Getm(ctx, nil, &Query{Name: predicate.In([]string{"alice", "bob"})})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []int{1, 2, 3}, ids(res))
+	testingz.R(rotated.Count(ctx, &Query{Name: predicate.NEQ("alice")})).NoError(t).Equal(1)
+
+	assert.ErrorIs(t, repo.Get(ctx, &Patient{ID: 3}), ErrUnknownKey)
+}
+
+type Insured struct {
+	ID     int     `bun:",pk"`
+	Policy *string `encrypt:"true"`
+	Plan   string
+}
+
+func TestEncryptionPointerAndDiff(t *testing.T) {
+	bdb, err := newDB()
+	require.NoError(t, err)
+	ctx := context.Background()
+	testingz.R(bdb.NewCreateTable().Model((*Insured)(nil)).Exec(ctx)).NoError(t)
+	testingz.R(bdb.NewCreateTable().Model((*AuditLog)(nil)).ModelTableExpr("insured_logs").Exec(ctx)).
+		NoError(t)
+
+	var diffs []map[string]Diff
+	repo := New(bdb, WithEncryption[Insured](StaticKeys("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})),
+		WithHooks(Hooks[Insured]{
+			AfterAdd: func(ctx context.Context, db bun.IDB, c *Change[Insured]) error {
+				diffs = append(diffs, c.Diff)
+				return nil
+			},
+			AfterUpd: func(ctx context.Context, db bun.IDB, c *Change[Insured]) error {
+				diffs = append(diffs, c.Diff)
+				return nil
+			},
+		}, AuditHooks[Insured](AuditTable("insured_logs"))))
+
+	policy := "P-1"
+	e := &Insured{ID: 1, Policy: &policy, Plan: "basic"}
+	testingz.R(repo.Add(ctx, e)).NoError(t)
+	assert.Equal(t, "P-1", policy, "the pointee is not encrypted")
+	assert.Same(t, &policy, e.Policy, "the pointer is restored")
+
+	stored := &Insured{ID: 1}
+	require.NoError(t, New[Insured](bdb).Get(ctx, stored))
+	assert.True(t, strings.HasPrefix(*stored.Policy, "k1:"), *stored.Policy)
+	got := &Insured{ID: 1}
+	require.NoError(t, repo.Get(ctx, got))
+	assert.Equal(t, "P-1", *got.Policy)
+
+	other := "P-2"
+	testingz.R(repo.Upd(ctx, &Insured{ID: 1, Policy: &other, Plan: "gold"})).NoError(t)
+	assert.Equal(t, "P-2", other)
+	require.Len(t, diffs, 2)
+	assert.Equal(t, Diff{Old: nil, New: Redacted}, diffs[0]["policy"])
+	assert.Equal(t, map[string]Diff{
+		"policy": {Old: Redacted, New: Redacted},
+		"plan":   {Old: "basic", New: "gold"},
+	}, diffs[1])
+
+	var logs []AuditLog
+	require.NoError(t, bdb.NewSelect().Model(&logs).ModelTableExpr("insured_logs AS al").Scan(ctx))
+	require.Len(t, logs, 2)
+	for _, l := range logs {
+		assert.NotContains(t, string(l.Diff), "P-")
+		assert.Contains(t, string(l.Diff), Redacted)
+	}
+}
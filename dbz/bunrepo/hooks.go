@@ -0,0 +1,243 @@
+package bunrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+	"github.com/uptrace/bun/schema"
+
+	"github.com/adobaai/pkg/dbz"
+)
+
+// ChangeOp is the operation of a [Change].
+type ChangeOp string
+
+const (
+	ChangeAdd ChangeOp = "add"
+	ChangeUpd ChangeOp = "upd"
+	ChangeDel ChangeOp = "del"
+)
+
+// Diff is the values of a column before and after a change.
+type Diff struct {
+	Old any `json:"old"`
+	New any `json:"new"`
+}
+
+// Change is a change of an entity passed to the hooks.
+type Change[T any] struct {
+	Op     ChangeOp
+	Entity *T
+	// Before is the row before the update or deletion, nil for additions
+	// or if the row does not exist.
+	Before *T
+	// Columns are the changed columns.
+	Columns []string
+	// Diff is keyed by the changed columns,
+	// the values of the encrypted columns are redacted, see [WithEncryption].
+	Diff map[string]Diff
+}
+
+// Hook is called with the db running the change, which is a transaction,
+// so the hooks can write in the same transaction.
+// The change is aborted and rolled back if any hook returns an error.
+type Hook[T any] func(ctx context.Context, db bun.IDB, c *Change[T]) error
+
+// Hooks are the hooks called around [Repo.Add], [Repo.Addm], [Repo.Upd], [Repo.Updm],
+// [Repo.Del] and [Repo.Delm], the nil hooks are skipped.
+// The `f` variants like [Repo.Updf], [Repo.Upsertm] and [Repo.CopyFrom] do not call the hooks.
+type Hooks[T any] struct {
+	BeforeAdd Hook[T]
+	AfterAdd  Hook[T]
+	BeforeUpd Hook[T]
+	AfterUpd  Hook[T]
+	BeforeDel Hook[T]
+	AfterDel  Hook[T]
+}
+
+// WithHooks adds the hooks to the repo.
+//
+// With hooks, the changes run in a transaction (or a savepoint if the repo is created with one),
+// and the rows to update or delete are selected first to compute the diffs,
+// which are locked by `FOR UPDATE` on Postgres and MySQL.
+func WithHooks[T any](hs ...Hooks[T]) RepoOption[T] {
+	return func(repo *Repo[T]) {
+		repo.hooks = append(repo.hooks, hs...)
+	}
+}
+
+func (hs Hooks[T]) before(op ChangeOp) Hook[T] {
+	switch op {
+	case ChangeAdd:
+		return hs.BeforeAdd
+	case ChangeUpd:
+		return hs.BeforeUpd
+	}
+	return hs.BeforeDel
+}
+
+func (hs Hooks[T]) after(op ChangeOp) Hook[T] {
+	switch op {
+	case ChangeAdd:
+		return hs.AfterAdd
+	case ChangeUpd:
+		return hs.AfterUpd
+	}
+	return hs.AfterDel
+}
+
+// hookedChange describes how to run a change with hooks.
+type hookedChange[T any] struct {
+	Op       ChangeOp
+	Entities []*T
+	// Where selects the row before the change, nil for additions.
+	Where func(bun.QueryBuilder) bun.QueryBuilder
+	// Fields returns the fields to diff of the entity.
+	Fields func(table *schema.Table, entity *T) []*schema.Field
+	// Exec executes the change with the repo without hooks.
+	Exec func(ctx context.Context, repo *Repo[T]) (sql.Result, error)
+}
+
+func (repo *Repo[T]) runHooked(ctx context.Context, hc hookedChange[T]) (res sql.Result, err error) {
+	table := repo.db.Dialect().Tables().Get(reflect.TypeFor[T]())
+	scope, err := repo.scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = repo.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		r := *repo
+		r.db, r.hooks = tx, nil
+
+		cs := make([]*Change[T], len(hc.Entities))
+		for i, e := range hc.Entities {
+			c := &Change[T]{Op: hc.Op, Entity: e}
+			if hc.Where != nil {
+				before := new(T)
+				*before = *e
+				detachPointers(table, before)
+				q := tx.NewSelect().Model(before).ApplyQueryBuilder(hc.Where).ApplyQueryBuilder(scope)
+				if name := tx.Dialect().Name(); name == dialect.PG || name == dialect.MySQL {
+					For(q, dbz.Update)
+				}
+				switch err := q.Scan(ctx); {
+				case err == nil:
+					if err := repo.decrypt(ctx, before); err != nil {
+						return err
+					}
+					c.Before = before
+				case !errors.Is(err, sql.ErrNoRows):
+					return fmt.Errorf("select before: %w", err)
+				}
+			}
+			cs[i] = c
+		}
+
+		if err := callHooks(ctx, tx, table, repo.crypter, repo.hooks, hc, cs, Hooks[T].before); err != nil {
+			return err
+		}
+		var err error
+		if res, err = hc.Exec(ctx, &r); err != nil {
+			return err
+		}
+		return callHooks(ctx, tx, table, repo.crypter, repo.hooks, hc, cs, Hooks[T].after)
+	})
+	return
+}
+
+// detachPointers copies the pointees of the pointer fields,
+// so scanning into the entity does not change the shared values.
+func detachPointers[T any](table *schema.Table, e *T) {
+	strct := reflect.ValueOf(e).Elem()
+	for _, f := range table.Fields {
+		if v := f.Value(strct); v.Kind() == reflect.Pointer && !v.IsNil() {
+			p := reflect.New(v.Type().Elem())
+			p.Elem().Set(v.Elem())
+			v.Set(p)
+		}
+	}
+}
+
+func callHooks[T any](ctx context.Context, tx bun.Tx, table *schema.Table, c *crypter,
+	all []Hooks[T], hc hookedChange[T], cs []*Change[T], pick func(Hooks[T], ChangeOp) Hook[T],
+) error {
+	var hooks []Hook[T]
+	for _, hs := range all {
+		if h := pick(hs, hc.Op); h != nil {
+			hooks = append(hooks, h)
+		}
+	}
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	for _, ch := range cs {
+		after := ch.Entity
+		if ch.Op == ChangeDel {
+			after = nil
+		}
+		ch.Columns, ch.Diff = diff(hc.Fields(table, ch.Entity), ch.Before, after)
+		c.redact(ch.Diff)
+		for _, h := range hooks {
+			if err := h(ctx, tx, ch); err != nil {
+				return fmt.Errorf("%s hook: %w", ch.Op, err)
+			}
+		}
+	}
+	return nil
+}
+
+// diff returns the changed columns and their diffs, before or after is nil if the row does not exist.
+func diff[T any](fields []*schema.Field, before, after *T) (cols []string, res map[string]Diff) {
+	value := func(f *schema.Field, e *T) any {
+		if e == nil {
+			return nil
+		}
+		return f.Value(reflect.ValueOf(e).Elem()).Interface()
+	}
+
+	res = map[string]Diff{}
+	for _, f := range fields {
+		d := Diff{Old: value(f, before), New: value(f, after)}
+		if before != nil && after != nil && reflect.DeepEqual(d.Old, d.New) {
+			continue
+		}
+		cols = append(cols, f.Name)
+		res[f.Name] = d
+	}
+	return
+}
+
+func wherePK(qb bun.QueryBuilder) bun.QueryBuilder {
+	return qb.WherePK()
+}
+
+func allFields[T any](table *schema.Table, _ *T) []*schema.Field {
+	return table.Fields
+}
+
+// updFields returns the fields updated by [Repo.Upd] with the options.
+func updFields[T any](o *updOption) func(*schema.Table, *T) []*schema.Field {
+	return func(table *schema.Table, e *T) (res []*schema.Field) {
+		strct := reflect.ValueOf(e).Elem()
+		for _, f := range table.Fields {
+			switch {
+			case len(o.Columns.Include) != 0:
+				if !slices.Contains(o.Columns.Include, f.Name) {
+					continue
+				}
+			case f.IsPK, slices.Contains(o.Columns.Exclude, f.Name):
+				continue
+			case !o.IncludeZero && f.HasZeroValue(strct):
+				continue
+			}
+			res = append(res, f)
+		}
+		return
+	}
+}
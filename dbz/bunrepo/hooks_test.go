@@ -0,0 +1,89 @@
+package bunrepo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+
+	"github.com/adobaai/pkg/testingz"
+)
+
+type Account struct {
+	ID      int `bun:",pk"`
+	Name    string
+	Balance int
+}
+
+func TestHooks(t *testing.T) {
+	bdb, err := newDB()
+	require.NoError(t, err)
+	ctx := context.Background()
+	testingz.R(bdb.NewCreateTable().Model((*Account)(nil)).Exec(ctx)).NoError(t)
+	testingz.R(bdb.NewCreateTable().Model((*AuditLog)(nil)).Exec(ctx)).NoError(t)
+
+	var changes []Change[Account]
+	errDenied := errors.New("denied")
+	record := func(ctx context.Context, db bun.IDB, c *Change[Account]) error {
+		changes = append(changes, *c)
+		return nil
+	}
+	repo := New(bdb, WithHooks(Hooks[Account]{
+		BeforeUpd: func(ctx context.Context, db bun.IDB, c *Change[Account]) error {
+			if c.Diff["balance"].New == -1 {
+				return errDenied
+			}
+			return nil
+		},
+		AfterAdd: record,
+		AfterUpd: record,
+		AfterDel: record,
+	}, AuditHooks[Account](AuditActor(func(context.Context) string { return "bob" }))))
+
+	testingz.R(repo.Add(ctx, &Account{ID: 1, Name: "a", Balance: 10})).NoError(t)
+	testingz.R(repo.Upd(ctx, &Account{ID: 1, Balance: 20})).NoError(t)
+	_, err = repo.Upd(ctx, &Account{ID: 1, Balance: -1})
+	require.ErrorIs(t, err, errDenied)
+	testingz.R(repo.Del(ctx, &Account{ID: 1})).NoError(t)
+
+	require.Len(t, changes, 3)
+	assert.Equal(t, ChangeAdd, changes[0].Op)
+	assert.Nil(t, changes[0].Before)
+	assert.Equal(t, []string{"id", "name", "balance"}, changes[0].Columns)
+
+	assert.Equal(t, ChangeUpd, changes[1].Op)
+	assert.Equal(t, &Account{ID: 1, Name: "a", Balance: 10}, changes[1].Before)
+	assert.Equal(t, []string{"balance"}, changes[1].Columns)
+	assert.Equal(t, map[string]Diff{"balance": {Old: 10, New: 20}}, changes[1].Diff)
+
+	assert.Equal(t, ChangeDel, changes[2].Op)
+	assert.Equal(t, &Account{ID: 1, Name: "a", Balance: 20}, changes[2].Before)
+	assert.Equal(t, Diff{Old: "a", New: nil}, changes[2].Diff["name"])
+
+	var logs []AuditLog
+	require.NoError(t, bdb.NewSelect().Model(&logs).Order("id").Scan(ctx))
+	require.Len(t, logs, 3)
+	assert.Equal(t, "accounts", logs[1].Entity)
+	assert.Equal(t, "1", logs[1].EntityID)
+	assert.Equal(t, ChangeUpd, logs[1].Op)
+	assert.Equal(t, "bob", logs[1].Actor)
+	var d map[string]Diff
+	require.NoError(t, json.Unmarshal(logs[1].Diff, &d))
+	assert.Equal(t, map[string]Diff{"balance": {Old: 10.0, New: 20.0}}, d)
+
+	t.Run("Multiple", func(t *testing.T) {
+		changes = nil
+		as := []*Account{{ID: 2, Name: "b"}, {ID: 3, Name: "c"}}
+		testingz.R(repo.Addm(ctx, as)).NoError(t)
+		as[0].Name, as[1].Name = "x", "y"
+		testingz.R(repo.Updm(ctx, as)).NoError(t)
+		testingz.R(repo.Delm(ctx, as)).NoError(t)
+		require.Len(t, changes, 6)
+		assert.Equal(t, map[string]Diff{"name": {Old: "c", New: "y"}}, changes[3].Diff)
+		assert.Equal(t, ChangeDel, changes[5].Op)
+	})
+}
@@ -0,0 +1,165 @@
+package bunrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"reflect"
+	"slices"
+	"sync/atomic"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+)
+
+const defaultChunkSize = 1000
+
+// ServerCursor makes [Repo.Iter] read the rows from a server-side cursor in a transaction
+// instead of the keyset-paged queries, which is only supported on Postgres.
+func ServerCursor() GetOption {
+	return serverCursorOption(true)
+}
+
+type serverCursorOption bool
+
+func (so serverCursorOption) ApplyGet(o *getOption) {
+	o.ServerCursor = bool(so)
+}
+
+// errStopIter is returned in the transaction of the server cursor when the iteration stops.
+var errStopIter = errors.New("stop iteration")
+
+// iterCursorSeq makes the names of the server cursors unique in a transaction.
+var iterCursorSeq atomic.Uint64
+
+// Iter iterates over the entities matching the query struct p, see [BuildQuery],
+// reading at most [ChunkSize] rows into memory at a time.
+//
+// The rows are read in the keyset-paged queries ordered by the primary keys by default,
+// so the rows changed during the iteration may be missed or read twice.
+// With the [ServerCursor] option, the rows are read from a server-side cursor
+// in a transaction (or a savepoint) instead, which is a consistent snapshot.
+//
+// The iteration stops after yielding an error.
+//
+// Example:
+//
+//	for user, err := range repo.Iter(ctx, &query, bunrepo.Columns("id", "email")) {
+//		if err != nil {
+//			return err
+//		}
+//		// ...
+//	}
+func (repo *Repo[T]) Iter(ctx context.Context, p any, opts ...GetOption) iter.Seq2[*T, error] {
+	return func(yield func(*T, error) bool) {
+		o := repo.getOption(opts)
+		qb, err := repo.buildQuery(ctx, p)
+		if err != nil {
+			yield(nil, fmt.Errorf("build: %w", err))
+			return
+		}
+		scope, err := repo.scope(ctx)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		if o.ChunkSize <= 0 {
+			o.ChunkSize = defaultChunkSize
+		}
+
+		table := repo.db.Dialect().Tables().Get(reflect.TypeFor[T]())
+		if len(o.Columns.Include) != 0 {
+			// The primary keys are required by the keyset.
+			o.Columns.Include = slices.Clone(o.Columns.Include)
+			for _, pk := range table.PKs {
+				if !slices.Contains(o.Columns.Include, pk.Name) {
+					o.Columns.Include = append(o.Columns.Include, pk.Name)
+				}
+			}
+		}
+		newQuery := func(db bun.IDB, items *[]*T) *bun.SelectQuery {
+			q := db.NewSelect().Model(items).ApplyQueryBuilder(qb).
+				ApplyQueryBuilder(o.QueryBuilder(false)).ApplyQueryBuilder(scope)
+			return applyGet(q, &o)
+		}
+
+		if o.ServerCursor {
+			repo.iterCursor(ctx, &o, newQuery, yield)
+			return
+		}
+
+		orders, err := parseKeysetOrders(table, nil)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		var last []any
+		for {
+			var items []*T
+			q := newQuery(repo.db, &items)
+			if last != nil {
+				where, args := keysetWhere(orders, last, repo.db.Dialect().Name() == dialect.PG)
+				q.Where(where, args...)
+			}
+			for _, ko := range orders {
+				q.OrderExpr("? ASC", bun.Ident(ko.Column))
+			}
+			if err := q.Limit(o.ChunkSize).Scan(ctx); err != nil {
+				yield(nil, err)
+				return
+			}
+			if err := repo.decrypt(ctx, items...); err != nil {
+				yield(nil, err)
+				return
+			}
+			for _, item := range items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+			if len(items) < o.ChunkSize {
+				return
+			}
+			last = keysetValues(orders, items[len(items)-1])
+		}
+	}
+}
+
+func (repo *Repo[T]) iterCursor(ctx context.Context, o *getOption,
+	newQuery func(bun.IDB, *[]*T) *bun.SelectQuery, yield func(*T, error) bool,
+) {
+	if name := repo.db.Dialect().Name(); name != dialect.PG {
+		yield(nil, fmt.Errorf("server cursor is unsupported on %s", name))
+		return
+	}
+
+	err := repo.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		name := bun.Ident(fmt.Sprintf("bunrepo_iter_%d", iterCursorSeq.Add(1)))
+		var items []*T
+		_, err := tx.NewRaw("DECLARE ? NO SCROLL CURSOR FOR ?", name, newQuery(tx, &items)).Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("declare: %w", err)
+		}
+		for {
+			var items []*T
+			if err := tx.NewRaw("FETCH ? FROM ?", o.ChunkSize, name).Scan(ctx, &items); err != nil {
+				return fmt.Errorf("fetch: %w", err)
+			}
+			if err := repo.decrypt(ctx, items...); err != nil {
+				return err
+			}
+			for _, item := range items {
+				if !yield(item, nil) {
+					return errStopIter
+				}
+			}
+			if len(items) < o.ChunkSize {
+				return nil
+			}
+		}
+	})
+	if err != nil && !errors.Is(err, errStopIter) {
+		yield(nil, err)
+	}
+}
@@ -0,0 +1,80 @@
+package bunrepo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/adobaai/pkg/dbz/predicate"
+	"github.com/adobaai/pkg/testingz"
+)
+
+type Event struct {
+	ID   int `bun:",pk"`
+	Kind string
+	Data string
+}
+
+func TestIter(t *testing.T) {
+	bdb, err := newDB()
+	require.NoError(t, err)
+	ctx := context.Background()
+	testingz.R(bdb.NewCreateTable().Model((*Event)(nil)).Exec(ctx)).NoError(t)
+	repo := New[Event](bdb)
+
+	var es []*Event
+	for i := range 10 {
+		kind := "a"
+		if i%3 == 0 {
+			kind = "b"
+		}
+		es = append(es, &Event{ID: 10 - i, Kind: kind, Data: "x"})
+	}
+	testingz.R(repo.Addm(ctx, es)).NoError(t)
+
+	type Query struct {
+		Kind *predicate.Field[string]
+	}
+	collect := func(p any, opts ...GetOption) (ids []int, res []*Event) {
+		for e, err := range repo.Iter(ctx, p, opts...) {
+			require.NoError(t, err)
+			ids = append(ids, e.ID)
+			res = append(res, e)
+		}
+		return
+	}
+
+	ids, _ := collect(nil, ChunkSize(3))
+	assert.Equal(t, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, ids)
+	ids, _ = collect(&Query{Kind: predicate.EQ("a")}, ChunkSize(2))
+	assert.Equal(t, []int{2, 3, 5, 6, 8, 9}, ids)
+	ids, _ = collect(nil, ChunkSize(5))
+	assert.Len(t, ids, 10)
+
+	ids, got := collect(&Query{Kind: predicate.EQ("b")}, Columns("kind"), ChunkSize(1))
+	assert.Equal(t, []int{1, 4, 7, 10}, ids)
+	assert.Equal(t, &Event{ID: 1, Kind: "b"}, got[0])
+
+	t.Run("Break", func(t *testing.T) {
+		var ids []int
+		for e, err := range repo.Iter(ctx, nil, ChunkSize(4)) {
+			require.NoError(t, err)
+			if e.ID > 5 {
+				break
+			}
+			ids = append(ids, e.ID)
+		}
+		assert.Equal(t, []int{1, 2, 3, 4, 5}, ids)
+	})
+
+	t.Run("ServerCursor", func(t *testing.T) {
+		n := 0
+		for _, err := range repo.Iter(ctx, nil, ServerCursor()) {
+			require.ErrorContains(t, err, "server cursor is unsupported")
+			n++
+		}
+		assert.Equal(t, 1, n)
+	})
+}
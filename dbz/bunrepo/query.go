@@ -0,0 +1,256 @@
+package bunrepo
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/adobaai/pkg/dbz"
+	"github.com/adobaai/pkg/dbz/predicate"
+	"github.com/adobaai/pkg/strz"
+)
+
+// ErrUnknownField is returned when the query has a key without the corresponding field.
+var ErrUnknownField = errors.New("unknown field")
+
+// QueryError is the error of a query key returned by [DecodeQuery].
+type QueryError struct {
+	// Key is the query key, like `age`.
+	Key string
+	// Field is the struct field of the key, like `Age`, empty for unknown keys.
+	Field string
+	Err   error
+}
+
+func (e *QueryError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("query %q: %v", e.Key, e.Err)
+	}
+	return fmt.Sprintf("query %q (%s): %v", e.Key, e.Field, e.Err)
+}
+
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	parserType     = reflect.TypeFor[predicate.Parser]()
+	baseListType   = reflect.TypeFor[dbz.BaseList]()
+	baseCursorType = reflect.TypeFor[dbz.BaseCursor]()
+
+	colonOrderRe = regexp.MustCompile(`^[A-Za-z_]\w*(\.[A-Za-z_]\w*)?(?i:(:asc|:desc)?(:nulls:(first|last))?)$`)
+)
+
+type queryField struct {
+	Name  string
+	Value reflect.Value
+}
+
+// DecodeOption is the option of [DecodeQuery].
+type DecodeOption func(o *decodeOption)
+
+type decodeOption struct {
+	// orderable reports whether the column can be ordered by.
+	orderable func(col string) bool
+}
+
+// OrderColumns sets the columns which can be ordered by, like `name` or `p.id`,
+// which overrides the default columns of [DecodeQuery] and [Repo.DecodeQuery].
+func OrderColumns(cols ...string) DecodeOption {
+	return func(o *decodeOption) {
+		o.orderable = func(col string) bool { return slices.Contains(cols, col) }
+	}
+}
+
+// DecodeQuery decodes the query string like `status=in.(a,b)&age=gte.18&order=name:desc`
+// into the query struct p, which is then passed to [Repo.Getm] or [BuildQuery].
+//
+// The pointer fields implementing [predicate.Parser] like `*predicate.Field[T]` are parsed by it,
+// the keys are the column names as in [predicate.FromStruct].
+// The keys `limit`, `offset`, `cursor` and `order` fill the [dbz.BaseList] or
+// [dbz.BaseCursor] field if any, the orders are in the form of [ParseColonOrders]
+// and separated by commas.
+// The orders are only allowed on the columns of the keys by default,
+// so the clients can not infer the hidden columns by sorting,
+// see [OrderColumns] and [Repo.DecodeQuery] for the other columns.
+//
+// The errors of all the keys are joined, each of which is a [*QueryError].
+//
+// Example:
+//
+//	type Query struct {
+//		dbz.BaseList
+//		Status *predicate.Field[string]
+//		Age    *predicate.Field[int]
+//	}
+//
+//	var q Query
+//	if err := bunrepo.DecodeQuery(r.URL.Query(), &q); err != nil {
+//		return err
+//	}
+//	res, _, err := repo.Getm(ctx, &q.BaseList, &q)
+func DecodeQuery(vs url.Values, p any, opts ...DecodeOption) error {
+	var o decodeOption
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	v := reflect.ValueOf(p)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("the p should be a struct pointer, got %T", p)
+	}
+	v = v.Elem()
+	t := v.Type()
+
+	var (
+		list   *dbz.BaseList
+		cursor *dbz.BaseCursor
+		fields = map[string]queryField{}
+	)
+	for i := range t.NumField() {
+		ft := t.Field(i)
+		if !ft.IsExported() {
+			continue
+		}
+		f := v.Field(i)
+		switch ft.Type {
+		case baseListType:
+			list = f.Addr().Interface().(*dbz.BaseList)
+			continue
+		case reflect.PointerTo(baseListType):
+			if f.IsNil() {
+				f.Set(reflect.New(baseListType))
+			}
+			list = f.Interface().(*dbz.BaseList)
+			continue
+		case baseCursorType:
+			cursor = f.Addr().Interface().(*dbz.BaseCursor)
+			continue
+		case reflect.PointerTo(baseCursorType):
+			if f.IsNil() {
+				f.Set(reflect.New(baseCursorType))
+			}
+			cursor = f.Interface().(*dbz.BaseCursor)
+			continue
+		}
+
+		if ft.Type.Kind() != reflect.Pointer || !ft.Type.Implements(parserType) {
+			continue
+		}
+		key := ft.Tag.Get("fp")
+		if key == "-" {
+			continue
+		}
+		if key == "" {
+			key = strz.Underscore(ft.Name)
+		}
+		fields[key] = queryField{Name: ft.Name, Value: f}
+	}
+
+	if o.orderable == nil {
+		o.orderable = func(col string) bool {
+			_, ok := fields[col]
+			return ok
+		}
+	}
+
+	var errs []error
+	for _, key := range slices.Sorted(maps.Keys(vs)) {
+		var err error
+		f, ok := fields[key]
+		switch {
+		case ok:
+			err = parseQueryField(f.Value, vs[key])
+		case key == "limit" && (list != nil || cursor != nil):
+			var n uint32
+			if n, err = parseUint32(vs[key]); list != nil {
+				list.Limit = n
+			} else {
+				cursor.Limit = n
+			}
+		case key == "offset" && list != nil:
+			list.Offset, err = parseUint32(vs[key])
+		case key == "cursor" && cursor != nil:
+			if len(vs[key]) != 1 {
+				err = errors.New("duplicated")
+			} else {
+				cursor.Cursor = vs[key][0]
+			}
+		case key == "order" && (list != nil || cursor != nil):
+			var orders []string
+			if orders, err = parseQueryOrders(vs[key], o.orderable); list != nil {
+				list.Orders = orders
+			} else {
+				cursor.Orders = orders
+			}
+		default:
+			err = ErrUnknownField
+		}
+		if err != nil {
+			errs = append(errs, &QueryError{Key: key, Field: f.Name, Err: err})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func parseQueryField(f reflect.Value, ss []string) error {
+	if f.IsNil() {
+		f.Set(reflect.New(f.Type().Elem()))
+	}
+	p := f.Interface().(predicate.Parser)
+	for _, s := range ss {
+		if err := p.Parse(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseUint32(ss []string) (uint32, error) {
+	if len(ss) != 1 {
+		return 0, errors.New("duplicated")
+	}
+	n, err := strconv.ParseUint(ss[0], 10, 32)
+	return uint32(n), err
+}
+
+// parseQueryOrders parses and validates the orders, since they are not escaped in the query.
+func parseQueryOrders(ss []string, orderable func(col string) bool) (res []string, err error) {
+	for _, s := range ss {
+		for _, order := range strings.Split(s, ",") {
+			if !colonOrderRe.MatchString(order) {
+				return nil, fmt.Errorf("invalid order %q", order)
+			}
+			if col, _, _ := strings.Cut(order, ":"); !orderable(col) {
+				return nil, fmt.Errorf("order %q is not allowed", col)
+			}
+			res = append(res, ParseColonOrders(order)...)
+		}
+	}
+	return
+}
+
+// DecodeQuery is [DecodeQuery] allowing the orders on the columns of the model,
+// with or without the table alias, except the columns of [WithExcludeColumns].
+func (repo *Repo[T]) DecodeQuery(vs url.Values, p any, opts ...DecodeOption) error {
+	table := repo.db.Dialect().Tables().Get(reflect.TypeFor[T]())
+	orderable := func(col string) bool {
+		if alias, name, ok := strings.Cut(col, "."); ok {
+			if alias != table.Alias {
+				return false
+			}
+			col = name
+		}
+		_, ok := table.FieldMap[col]
+		return ok && !slices.Contains(repo.defaults.Exclude, col)
+	}
+	return DecodeQuery(vs, p, append([]DecodeOption{func(o *decodeOption) {
+		o.orderable = orderable
+	}}, opts...)...)
+}
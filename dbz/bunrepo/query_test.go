@@ -0,0 +1,97 @@
+package bunrepo
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/adobaai/pkg/dbz"
+	"github.com/adobaai/pkg/dbz/predicate"
+)
+
+func TestDecodeQuery(t *testing.T) {
+	type Query struct {
+		dbz.BaseList
+		ID       *predicate.Field[int] `fp:"p.id"`
+		Summary  *predicate.Field[string]
+		Provider *predicate.Field[string] `fp:"provider_id"`
+		Ignored  *predicate.Field[int]    `fp:"-"`
+	}
+
+	vs, err := url.ParseQuery(`p.id=gte.0&p.id=not.in.(1,2)&summary=ilike.*x*&provider_id=is.null` +
+		`&limit=10&offset=20&order=summary:desc,p.id`)
+	require.NoError(t, err)
+	var q Query
+	require.NoError(t, DecodeQuery(vs, &q))
+	assert.Equal(t, dbz.BaseList{Limit: 10, Offset: 20, Orders: []string{"summary DESC", "p.id"}}, q.BaseList)
+	assert.Nil(t, q.Ignored)
+
+	db, err := newDB()
+	require.NoError(t, err)
+	qb, err := BuildQuery(&q)
+	require.NoError(t, err)
+	sq := db.NewSelect().Model((*Payment)(nil)).Column("id").ApplyQueryBuilder(qb)
+	assert.Equal(t, `SELECT "p"."id" FROM "payments" AS "p" WHERE (`+
+		`"p"."id" >= 0 AND NOT "p"."id" IN (1, 2) AND "summary" ILIKE '%x%' AND "provider_id" IS NULL)`,
+		sq.String())
+
+	t.Run("Errors", func(t *testing.T) {
+		vs := url.Values{
+			"p.id":    {"in.(1,x)"},
+			"summary": {"foo"},
+			"unknown": {"eq.1"},
+			"limit":   {"-1"},
+			"order":   {"id;drop table p"},
+			"ignored": {"eq.1"},
+		}
+		err := DecodeQuery(vs, &Query{})
+		require.Error(t, err)
+		assert.ErrorIs(t, err, ErrUnknownField)
+		assert.Equal(t, `query "ignored": unknown field
+query "limit": strconv.ParseUint: parsing "-1": invalid syntax
+query "order": invalid order "id;drop table p"
+query "p.id" (ID): item 1: strconv.ParseInt: parsing "x": invalid syntax
+query "summary" (Summary): missing operator in "foo"
+query "unknown": unknown field`, err.Error())
+
+		var qe *QueryError
+		require.ErrorAs(t, err, &qe)
+		assert.Equal(t, "ignored", qe.Key)
+	})
+
+	t.Run("Cursor", func(t *testing.T) {
+		var q struct {
+			*dbz.BaseCursor
+			Author *predicate.Field[string]
+		}
+		vs := url.Values{"cursor": {"abc"}, "limit": {"5"}, "order": {"author:asc:nulls:last"}}
+		require.NoError(t, DecodeQuery(vs, &q))
+		assert.Equal(t, &dbz.BaseCursor{Limit: 5, Cursor: "abc", Orders: []string{"author ASC NULLS LAST"}},
+			q.BaseCursor)
+		assert.Nil(t, q.Author)
+
+		require.ErrorIs(t, DecodeQuery(url.Values{"offset": {"1"}}, &q), ErrUnknownField)
+		require.Error(t, DecodeQuery(url.Values{}, q))
+	})
+
+	t.Run("Orders", func(t *testing.T) {
+		var q struct {
+			dbz.BaseList
+			Name *predicate.Field[string]
+		}
+		err := DecodeQuery(url.Values{"order": {"name,password_hash:desc"}}, &q)
+		assert.EqualError(t, err, `query "order": order "password_hash" is not allowed`)
+		require.NoError(t, DecodeQuery(url.Values{"order": {"created_at:desc"}}, &q, OrderColumns("created_at")))
+		assert.Equal(t, []string{"created_at DESC"}, q.Orders)
+
+		repo := New(db, WithExcludeColumns[Member]("password_hash"))
+		require.NoError(t, repo.DecodeQuery(url.Values{"order": {"member.id:desc,created_at"}}, &q))
+		assert.Equal(t, []string{"member.id DESC", "created_at"}, q.Orders)
+		for _, order := range []string{"password_hash", "p.id", "unknown"} {
+			assert.Error(t, repo.DecodeQuery(url.Values{"order": {order}}, &q), order)
+		}
+		require.NoError(t, repo.DecodeQuery(url.Values{"order": {"password_hash"}}, &q, OrderColumns("password_hash")))
+	})
+}
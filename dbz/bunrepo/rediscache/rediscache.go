@@ -0,0 +1,47 @@
+// Package rediscache provides the [bunrepo.Cache] backed by Redis,
+// which is a separate module so the repos without it do not depend on Redis.
+//
+// Example:
+//
+//	repo := bunrepo.NewCached(bunrepo.New[User](db), rediscache.New(rdb))
+package rediscache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/adobaai/pkg/dbz/bunrepo"
+)
+
+// Cache is a [bunrepo.Cache] backed by Redis.
+type Cache struct {
+	rdb redis.UniversalClient
+}
+
+var _ bunrepo.Cache = (*Cache)(nil)
+
+func New(rdb redis.UniversalClient) *Cache {
+	return &Cache{rdb: rdb}
+}
+
+func (c *Cache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	b, err := c.rdb.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	return b, err == nil, err
+}
+
+func (c *Cache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return c.rdb.Set(ctx, key, value, ttl).Err()
+}
+
+func (c *Cache) Del(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return c.rdb.Del(ctx, keys...).Err()
+}
@@ -0,0 +1,165 @@
+package bunrepo
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/schema"
+
+	"github.com/adobaai/pkg/dbz/predicate"
+)
+
+// RelationOption is the option of [Relation].
+type RelationOption func(o *relationOption)
+
+type relationOption struct {
+	Name    string
+	Query   any
+	Columns []string
+	Orders  []string
+	Limit   int
+}
+
+// RelQuery filters the related rows by the query struct p, see [BuildQuery].
+func RelQuery(p any) RelationOption {
+	return func(o *relationOption) {
+		o.Query = p
+	}
+}
+
+// RelColumns specifies the columns of the related rows.
+func RelColumns(cols ...string) RelationOption {
+	return func(o *relationOption) {
+		o.Columns = cols
+	}
+}
+
+// RelOrders sorts the related rows of the has-many and many-to-many relations.
+func RelOrders(orders ...string) RelationOption {
+	return func(o *relationOption) {
+		o.Orders = orders
+	}
+}
+
+// RelLimit limits the related rows of the has-many and many-to-many relations.
+//
+// The related rows of all the entities are selected in one query,
+// so it is supported only by [Repo.Get], and the queries getting multiple entities
+// like [Repo.Getm] return an error.
+func RelLimit(n int) RelationOption {
+	return func(o *relationOption) {
+		o.Limit = n
+	}
+}
+
+// Relation loads the relation like `Author` or `Author.Profile` with the options
+// when getting the entities.
+//
+// The filters of the has-one and belongs-to relations are added to the JOIN ON clause,
+// so the entities are never filtered by the relations, and [Count] counts the entities only.
+//
+// Example:
+//
+//	type CommentQuery struct {
+//		Status *predicate.Field[string]
+//	}
+//
+//	repo.Getm(ctx, lp, &query, bunrepo.Relation("Author", bunrepo.RelColumns("id", "name")),
+//		bunrepo.Relation("Comments", bunrepo.RelQuery(&CommentQuery{Status: predicate.EQ("approved")}),
+//			bunrepo.RelOrders("id DESC"), bunrepo.RelLimit(10)))
+func Relation(name string, opts ...RelationOption) GetOption {
+	o := relationOption{Name: name}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func (ro relationOption) ApplyGet(o *getOption) {
+	o.Relations = append(o.Relations, ro)
+}
+
+func (ro *relationOption) apply(q *bun.SelectQuery) {
+	tm, ok := q.GetModel().(bun.TableModel)
+	if !ok {
+		q.Err(fmt.Errorf("relation %s: the model is not a table", ro.Name))
+		return
+	}
+	var (
+		table   = tm.Table()
+		rel     *schema.Relation
+		aliases []string
+	)
+	for _, part := range strings.Split(ro.Name, ".") {
+		if rel = table.Relations[part]; rel == nil {
+			q.Err(fmt.Errorf("%s does not have relation %q", table.TypeName, part))
+			return
+		}
+		aliases = append(aliases, rel.Field.Name)
+		table = rel.JoinTable
+	}
+
+	var e predicate.Expr
+	if ro.Query != nil {
+		var err error
+		if e, err = predicate.FromStruct(ro.Query); err != nil {
+			q.Err(fmt.Errorf("relation %s: %w", ro.Name, err))
+			return
+		}
+	}
+
+	switch rel.Type {
+	case schema.HasOneRelation, schema.BelongsToRelation:
+		opts := bun.RelationOpts{}
+		if e != nil {
+			query, args := bunExpr(qualify(e, strings.Join(aliases, "__")), false)
+			opts.AdditionalJoinOnConditions = []schema.QueryWithArgs{schema.SafeQuery(query, args)}
+		}
+		if len(ro.Columns) != 0 {
+			opts.Apply = func(q *bun.SelectQuery) *bun.SelectQuery {
+				return q.Column(ro.Columns...)
+			}
+		}
+		q.RelationWithOpts(ro.Name, opts)
+	default:
+		if ro.Limit > 0 && reflect.Indirect(reflect.ValueOf(tm.Value())).Kind() == reflect.Slice {
+			q.Err(fmt.Errorf("relation %s: the limit is not supported when getting multiple entities", ro.Name))
+			return
+		}
+		q.Relation(ro.Name, func(q *bun.SelectQuery) *bun.SelectQuery {
+			q.ApplyQueryBuilder(func(qb bun.QueryBuilder) bun.QueryBuilder {
+				return WhereExpr(qb, e)
+			}).Column(ro.Columns...).Order(ro.Orders...)
+			if ro.Limit > 0 {
+				q.Limit(ro.Limit)
+			}
+			return q
+		})
+	}
+}
+
+// qualify qualifies the columns of the expr with the table alias.
+func qualify(e predicate.Expr, alias string) predicate.Expr {
+	switch e := e.(type) {
+	case predicate.Cond:
+		e.Column = alias + "." + e.Column
+		return e
+	case predicate.NotExpr:
+		return predicate.NotExpr{X: qualify(e.X, alias)}
+	case predicate.AndExpr:
+		es := make(predicate.AndExpr, len(e))
+		for i, e := range e {
+			es[i] = qualify(e, alias)
+		}
+		return es
+	case predicate.OrExpr:
+		es := make(predicate.OrExpr, len(e))
+		for i, e := range e {
+			es[i] = qualify(e, alias)
+		}
+		return es
+	}
+	return e
+}
@@ -0,0 +1,75 @@
+package bunrepo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/adobaai/pkg/dbz"
+	"github.com/adobaai/pkg/dbz/predicate"
+	"github.com/adobaai/pkg/testingz"
+)
+
+type Writer struct {
+	ID     int `bun:",pk"`
+	Name   string
+	Active bool
+	Posts  []*Post `bun:"rel:has-many,join:id=writer_id"`
+}
+
+type Post struct {
+	ID       int `bun:",pk"`
+	WriterID int
+	Title    string
+	Status   string
+	Writer   *Writer `bun:"rel:belongs-to,join:writer_id=id"`
+}
+
+func TestRelation(t *testing.T) {
+	bdb, err := newDB()
+	require.NoError(t, err)
+	ctx := context.Background()
+	testingz.R(bdb.NewCreateTable().Model((*Writer)(nil)).Exec(ctx)).NoError(t)
+	testingz.R(bdb.NewCreateTable().Model((*Post)(nil)).Exec(ctx)).NoError(t)
+	writers, posts := New[Writer](bdb), New[Post](bdb)
+	testingz.R(writers.Addm(ctx, []*Writer{{ID: 1, Name: "a", Active: true}, {ID: 2, Name: "b"}})).NoError(t)
+	testingz.R(posts.Addm(ctx, []*Post{
+		{ID: 1, WriterID: 1, Title: "x", Status: "draft"},
+		{ID: 2, WriterID: 1, Title: "y", Status: "published"},
+		{ID: 3, WriterID: 1, Title: "z", Status: "published"},
+		{ID: 4, WriterID: 2, Title: "w", Status: "published"},
+	})).NoError(t)
+
+	type PostQuery struct {
+		Status *predicate.Field[string]
+	}
+	type WriterQuery struct {
+		Active *predicate.Field[bool]
+	}
+
+	w := Writer{ID: 1}
+	require.NoError(t, writers.Get(ctx, &w, Relation("Posts",
+		RelQuery(&PostQuery{Status: predicate.EQ("published")}), RelOrders("id DESC"), RelLimit(1))))
+	require.Len(t, w.Posts, 1)
+	assert.Equal(t, 3, w.Posts[0].ID)
+
+	ps, n, err := posts.Getm(ctx, &dbz.BaseList{Orders: []string{"post.id"}}, nil, Count(),
+		Relation("Writer", RelQuery(&WriterQuery{Active: predicate.EQ(true)}), RelColumns("id", "name")))
+	require.NoError(t, err)
+	assert.Equal(t, 4, n, "the posts are not filtered by the writers")
+	require.Len(t, ps, 4)
+	assert.Equal(t, &Writer{ID: 1, Name: "a"}, ps[0].Writer)
+	assert.Nil(t, ps[3].Writer)
+
+	t.Run("LimitMultiple", func(t *testing.T) {
+		_, _, err := writers.Getm(ctx, nil, nil, Relation("Posts", RelLimit(1)))
+		require.ErrorContains(t, err, "the limit is not supported")
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		_, _, err := posts.Getm(ctx, nil, nil, Relation("Author"))
+		require.ErrorContains(t, err, `does not have relation "Author"`)
+	})
+}
@@ -13,25 +13,88 @@ import (
 
 // Repo is the repository.
 // T is the entity type.
+//
+// Soft delete is enabled by the bun tag `soft_delete` on a nullable time column:
+//
+//	DeletedAt time.Time `bun:",soft_delete,nullzero"`
+//
+// Then the queries skip the soft-deleted rows unless [WithDeleted] or [OnlyDeleted] is given,
+// and [Repo.Del] and [Repo.Delm] set the column instead of deleting the rows
+// unless [HardDelete] is given. The rows are restored by [Repo.Restore].
+//
+// The defaults of the queries are set by the options of [New],
+// like [WithMaxLimit], [WithOrders], [WithExcludeColumns] and [WithCount].
+// The repo is scoped to the tenant in the context by [WithTenant],
+// and the sensitive fields are encrypted by [WithEncryption].
 type Repo[T any] struct {
 	db        bun.IDB
 	returning string
+	hooks     []Hooks[T]
+	defaults  repoDefaults
+	// tenant is the tenant column set by [WithTenant].
+	tenant  string
+	crypter *crypter
+}
+
+// repoDefaults are the defaults of the queries set by the [RepoOption]s.
+type repoDefaults struct {
+	MaxLimit int32
+	Orders   []string
+	Exclude  []string
+	Count    bool
 }
 
 func New[T any](db bun.IDB, opts ...RepoOption[T]) *Repo[T] {
-	return &Repo[T]{
+	repo := &Repo[T]{
 		db: db,
 	}
+	for _, opt := range opts {
+		opt(repo)
+	}
+	return repo
 }
 
 type RepoOption[T any] func(*Repo[T])
 
+// WithReturning sets the RETURNING clause of the additions, like `*`.
 func WithReturning[T any](r string) RepoOption[T] {
 	return func(repo *Repo[T]) {
 		repo.returning = r
 	}
 }
 
+// WithMaxLimit sets the default max limit of [Repo.Getm] and [Repo.Getc],
+// which is overridden by the MaxLimit of the params or the [MaxLimit] option.
+func WithMaxLimit[T any](n int32) RepoOption[T] {
+	return func(repo *Repo[T]) {
+		repo.defaults.MaxLimit = n
+	}
+}
+
+// WithOrders sets the default orders of [Repo.Getm] and [Repo.Getc],
+// which are used if the params have no orders.
+func WithOrders[T any](orders ...string) RepoOption[T] {
+	return func(repo *Repo[T]) {
+		repo.defaults.Orders = orders
+	}
+}
+
+// WithExcludeColumns sets the columns never selected by default, like `password_hash`,
+// which are overridden by the [Columns] or [ExcludeColumns] option.
+func WithExcludeColumns[T any](cols ...string) RepoOption[T] {
+	return func(repo *Repo[T]) {
+		repo.defaults.Exclude = cols
+	}
+}
+
+// WithCount makes [Repo.Getm] count the query by default,
+// which is overridden by the [NoCount] option.
+func WithCount[T any]() RepoOption[T] {
+	return func(repo *Repo[T]) {
+		repo.defaults.Count = true
+	}
+}
+
 type GetOption interface {
 	ApplyGet(o *getOption)
 }
@@ -39,21 +102,93 @@ type GetOption interface {
 type getOption struct {
 	queryOption
 	Columns   columnsOption
-	ForUpdate bool
+	Lock      dbz.Lock
 	Count     bool
+	Codec     *dbz.CursorCodec
+	Deleted   deletedOption
+	MaxLimit  int32
+	ChunkSize int
+	// ServerCursor makes [Repo.Iter] read from a server-side cursor.
+	ServerCursor bool
+	GroupBy      []string
+	Selects      []Tuple[string, []any]
+	Having       []Tuple[string, []any]
+	Relations    []relationOption
+}
+
+// getOption returns the option with the defaults of the repo.
+func (repo *Repo[T]) getOption(opts []GetOption) getOption {
+	o := getOption{
+		Columns: columnsOption{Exclude: repo.defaults.Exclude},
+		Count:   repo.defaults.Count,
+	}
+	for _, opt := range opts {
+		opt.ApplyGet(&o)
+	}
+	return o
+}
+
+// listParams returns the list params with the defaults of the repo, nil if lp is nil.
+func (repo *Repo[T]) listParams(lp dbz.ListParams, o *getOption) dbz.ListParams {
+	if lp == nil {
+		return nil
+	}
+	res := &dbz.BaseList{
+		Limit:    lp.GetLimit(),
+		Offset:   lp.GetOffset(),
+		Orders:   lp.GetOrders(),
+		MaxLimit: o.MaxLimit,
+	}
+	if bl, ok := lp.(*dbz.BaseList); ok && res.MaxLimit == 0 {
+		res.MaxLimit = bl.MaxLimit
+	}
+	if res.MaxLimit == 0 {
+		res.MaxLimit = repo.defaults.MaxLimit
+	}
+	if len(res.Orders) == 0 {
+		res.Orders = repo.defaults.Orders
+	}
+	return res
+}
+
+// cursorParams is the [Repo.listParams] of [dbz.CursorParams].
+func (repo *Repo[T]) cursorParams(cp dbz.CursorParams, o *getOption) dbz.CursorParams {
+	res := &dbz.BaseCursor{
+		Limit:    cp.GetLimit(),
+		Cursor:   cp.GetCursor(),
+		Orders:   cp.GetOrders(),
+		MaxLimit: o.MaxLimit,
+	}
+	if bc, ok := cp.(*dbz.BaseCursor); ok && bc != nil && res.MaxLimit == 0 {
+		res.MaxLimit = bc.MaxLimit
+	}
+	if res.MaxLimit == 0 {
+		res.MaxLimit = repo.defaults.MaxLimit
+	}
+	if len(res.Orders) == 0 {
+		res.Orders = repo.defaults.Orders
+	}
+	return res
 }
 
 // Get returns the entity by id.
 func (repo *Repo[T]) Get(ctx context.Context, entity *T, opts ...GetOption) (err error) {
-	o := getOption{}
-	for _, opt := range opts {
-		opt.ApplyGet(&o)
+	if err = repo.get(ctx, entity, opts...); err != nil {
+		return err
 	}
-	q := repo.db.NewSelect().Model(entity).
-		ApplyQueryBuilder(o.QueryBuilder(true))
+	return repo.decrypt(ctx, entity)
+}
 
-	err = applyGet(q, &o).Scan(ctx)
-	return
+// get is [Repo.Get] without decrypting the entity.
+func (repo *Repo[T]) get(ctx context.Context, entity *T, opts ...GetOption) (err error) {
+	o := repo.getOption(opts)
+	scope, err := repo.scope(ctx)
+	if err != nil {
+		return err
+	}
+	q := repo.db.NewSelect().Model(entity).
+		ApplyQueryBuilder(o.QueryBuilder(true)).ApplyQueryBuilder(scope)
+	return applyGet(q, &o).Scan(ctx)
 }
 
 func (repo *Repo[T]) Getf(
@@ -61,40 +196,66 @@ func (repo *Repo[T]) Getf(
 	entity *T,
 	f func(q *bun.SelectQuery) *bun.SelectQuery,
 ) (err error) {
-	q := repo.db.NewSelect().Model(entity).Apply(f)
-	return q.Scan(ctx)
+	scope, err := repo.scope(ctx)
+	if err != nil {
+		return err
+	}
+	q := repo.db.NewSelect().Model(entity).ApplyQueryBuilder(scope).Apply(f)
+	if err = q.Scan(ctx); err != nil {
+		return err
+	}
+	return repo.decrypt(ctx, entity)
 }
 
 // Getm gets multiple entities.
+//
+// All the entities are returned if lp is nil, which are still sorted by the default orders if any.
 func (repo *Repo[T]) Getm(ctx context.Context, lp dbz.ListParams, p any, opts ...GetOption,
 ) (res []*T, n int, err error) {
-	o := getOption{}
-	for _, opt := range opts {
-		opt.ApplyGet(&o)
-	}
+	o := repo.getOption(opts)
 
-	qb, err := BuildQuery(p)
+	qb, err := repo.buildQuery(ctx, p)
 	if err != nil {
 		return nil, 0, fmt.Errorf("build: %w", err)
 	}
+	scope, err := repo.scope(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
 
 	q := repo.db.NewSelect().Model(&res).ApplyQueryBuilder(qb).
-		ApplyQueryBuilder(o.QueryBuilder(false))
+		ApplyQueryBuilder(o.QueryBuilder(false)).ApplyQueryBuilder(scope)
 
 	q = applyGet(q, &o)
-	if o.Count {
-		n, err = List(q, lp).ScanAndCount(ctx)
-	} else {
-		err = List(q, lp).Scan(ctx)
+	if lp = repo.listParams(lp, &o); lp == nil {
+		q.Order(repo.defaults.Orders...)
+	}
+	q = List(q, lp)
+	switch {
+	case o.Count && len(o.Relations) != 0:
+		// ScanAndCount may run the queries concurrently, which share the relations.
+		if err = q.Scan(ctx); err == nil {
+			n, err = q.Count(ctx)
+		}
+	case o.Count:
+		n, err = q.ScanAndCount(ctx)
+	default:
+		err = q.Scan(ctx)
 	}
+	if err != nil {
+		return nil, 0, err
+	}
+	err = repo.decrypt(ctx, res...)
 	return
 }
 
 func applyGet(q *bun.SelectQuery, o *getOption) *bun.SelectQuery {
-	q.Column(o.Columns.Include...).ExcludeColumn(o.Columns.Exclude...)
-	if o.ForUpdate {
-		For(q, dbz.Update)
+	q.Column(o.Columns.Include...).ExcludeColumn(o.Columns.Exclude...).
+		ApplyQueryBuilder(o.Deleted.QueryBuilder())
+	for _, r := range o.Relations {
+		r.apply(q)
 	}
+	Lock(q, o.Lock)
 	return q
 }
 
@@ -112,6 +273,22 @@ type addOption struct {
 // Add adds a new entity to the repository.
 func (repo *Repo[T]) Add(ctx context.Context, entity *T, opts ...AddOption,
 ) (res sql.Result, err error) {
+	if err = repo.setTenant(ctx, entity); err != nil {
+		return nil, err
+	}
+	if len(repo.hooks) != 0 {
+		return repo.runHooked(ctx, hookedChange[T]{
+			Op: ChangeAdd, Entities: []*T{entity}, Fields: allFields[T],
+			Exec: func(ctx context.Context, r *Repo[T]) (sql.Result, error) {
+				return r.Add(ctx, entity, opts...)
+			},
+		})
+	}
+	restore, err := repo.encrypt(ctx, entity)
+	if err != nil {
+		return nil, err
+	}
+	defer restore()
 	return repo.add(ctx, entity, opts...)
 }
 
@@ -121,6 +298,14 @@ func (repo *Repo[T]) Addf(
 	entity *T,
 	f func(q *bun.InsertQuery) *bun.InsertQuery,
 ) (res sql.Result, err error) {
+	if err = repo.setTenant(ctx, entity); err != nil {
+		return nil, err
+	}
+	restore, err := repo.encrypt(ctx, entity)
+	if err != nil {
+		return nil, err
+	}
+	defer restore()
 	q := repo.db.NewInsert().Model(entity).Apply(f)
 	return q.Exec(ctx)
 }
@@ -128,6 +313,22 @@ func (repo *Repo[T]) Addf(
 // Addm adds multiple entities to the repository.
 func (repo *Repo[T]) Addm(ctx context.Context, entities []*T, opts ...AddOption,
 ) (res sql.Result, err error) {
+	if err = repo.setTenant(ctx, entities...); err != nil {
+		return nil, err
+	}
+	if len(repo.hooks) != 0 {
+		return repo.runHooked(ctx, hookedChange[T]{
+			Op: ChangeAdd, Entities: entities, Fields: allFields[T],
+			Exec: func(ctx context.Context, r *Repo[T]) (sql.Result, error) {
+				return r.Addm(ctx, entities, opts...)
+			},
+		})
+	}
+	restore, err := repo.encrypt(ctx, entities...)
+	if err != nil {
+		return nil, err
+	}
+	defer restore()
 	return repo.add(ctx, &entities, opts...)
 }
 
@@ -137,8 +338,12 @@ func (repo *Repo[T]) add(ctx context.Context, entities any, opts ...AddOption,
 	for _, opt := range opts {
 		opt.ApplyAdd(&o)
 	}
-	q := repo.db.NewInsert().Model(entities).
-		Column(o.Columns.Include...).ExcludeColumn(o.Columns.Exclude...)
+	q := repo.db.NewInsert().Model(entities).Column(o.Columns.Include...)
+	if len(o.Columns.Exclude) != 0 {
+		// ExcludeColumn without columns makes all columns explicit,
+		// which prevents auto-increment columns from using their defaults.
+		q.ExcludeColumn(o.Columns.Exclude...)
+	}
 	if o.On != "" {
 		q.On(o.On)
 	}
@@ -157,13 +362,50 @@ type updOption struct {
 	Columns     columnsOption
 	IncludeZero bool
 	Returning   Tuple[string, []any]
+	Deleted     deletedOption
 }
 
 // Upd updates an entity.
+//
+// If the entity has a version column tagged with `dbz:"version"`, the row is updated
+// only if its version is unchanged and the version is increased,
+// otherwise a [*ConflictError] is returned.
 func (repo *Repo[T]) Upd(ctx context.Context, entity *T, opts ...UpdOption,
 ) (res sql.Result, err error) {
-	q := repo.db.NewUpdate().Model(entity)
-	return applyUpdOptions(q, opts...).Exec(ctx)
+	if err = repo.setTenant(ctx, entity); err != nil {
+		return nil, err
+	}
+	if len(repo.hooks) != 0 {
+		o := updOption{}
+		for _, opt := range opts {
+			opt.ApplyUpd(&o)
+		}
+		return repo.runHooked(ctx, hookedChange[T]{
+			Op: ChangeUpd, Entities: []*T{entity}, Where: o.QueryBuilder(true), Fields: updFields[T](&o),
+			Exec: func(ctx context.Context, r *Repo[T]) (sql.Result, error) {
+				return r.Upd(ctx, entity, opts...)
+			},
+		})
+	}
+	scope, err := repo.scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	restore, err := repo.encrypt(ctx, entity)
+	if err != nil {
+		return nil, err
+	}
+	defer restore()
+	q := repo.db.NewUpdate().Model(entity).ApplyQueryBuilder(scope)
+	q = applyUpdOptions(q, opts...)
+	f, err := repo.versionField()
+	if err != nil {
+		return nil, err
+	}
+	if f != nil {
+		return repo.updVersion(ctx, q, f, entity, opts)
+	}
+	return q.Exec(ctx)
 }
 
 // Updf provides more customizations for updation via function.
@@ -172,13 +414,62 @@ func (repo *Repo[T]) Updf(
 	entity *T,
 	f func(q *bun.UpdateQuery) *bun.UpdateQuery,
 ) (sql.Result, error) {
-	q := repo.db.NewUpdate().Model(entity).Apply(f)
+	scope, err := repo.scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = repo.setTenant(ctx, entity); err != nil {
+		return nil, err
+	}
+	restore, err := repo.encrypt(ctx, entity)
+	if err != nil {
+		return nil, err
+	}
+	defer restore()
+	q := repo.db.NewUpdate().Model(entity).ApplyQueryBuilder(scope).Apply(f)
 	return q.Exec(ctx)
 }
 
+// Updm updates multiple entities in bulk.
+//
+// If the entities have a version column tagged with `dbz:"version"`, they are updated
+// one by one, only the rows with the same versions are updated and their versions are increased,
+// and a [*ConflictError] is returned for each of the others.
+// The updated rows are not rolled back on conflicts, run it in [RunInTx] if needed.
 func (repo *Repo[T]) Updm(ctx context.Context, entities []*T, opts ...UpdOption,
 ) (sql.Result, error) {
-	q := repo.db.NewUpdate().Model(&entities).Bulk()
+	if err := repo.setTenant(ctx, entities...); err != nil {
+		return nil, err
+	}
+	if len(repo.hooks) != 0 {
+		o := updOption{}
+		for _, opt := range opts {
+			opt.ApplyUpd(&o)
+		}
+		return repo.runHooked(ctx, hookedChange[T]{
+			Op: ChangeUpd, Entities: entities, Where: wherePK, Fields: updFields[T](&o),
+			Exec: func(ctx context.Context, r *Repo[T]) (sql.Result, error) {
+				return r.Updm(ctx, entities, opts...)
+			},
+		})
+	}
+	scope, err := repo.scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	restore, err := repo.encrypt(ctx, entities...)
+	if err != nil {
+		return nil, err
+	}
+	defer restore()
+	f, err := repo.versionField()
+	if err != nil {
+		return nil, err
+	}
+	if f != nil {
+		return repo.updmVersion(ctx, f, entities, scope, opts)
+	}
+	q := repo.db.NewUpdate().Model(&entities).Bulk().ApplyQueryBuilder(scope)
 	return applyUpdOptions(q, opts...).Exec(ctx)
 }
 
@@ -188,7 +479,8 @@ func applyUpdOptions(q *bun.UpdateQuery, opts ...UpdOption) *bun.UpdateQuery {
 		opt.ApplyUpd(&o)
 	}
 	q.Column(o.Columns.Include...).ExcludeColumn(o.Columns.Exclude...).
-		ApplyQueryBuilder(o.QueryBuilder(true))
+		ApplyQueryBuilder(o.QueryBuilder(true)).
+		ApplyQueryBuilder(o.Deleted.QueryBuilder())
 
 	if !o.IncludeZero {
 		q.OmitZero()
@@ -205,20 +497,49 @@ type DelOption interface {
 
 type delOption struct {
 	queryOption
-	Returning Tuple[string, []any]
+	Returning  Tuple[string, []any]
+	HardDelete bool
 }
 
 // Del deletes the entity from the repository.
 func (repo *Repo[T]) Del(ctx context.Context, entity *T, opts ...DelOption,
 ) (res sql.Result, err error) {
-	q := repo.db.NewDelete().Model(entity)
+	scope, err := repo.scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(repo.hooks) != 0 {
+		o := delOption{}
+		for _, opt := range opts {
+			opt.ApplyDel(&o)
+		}
+		return repo.runHooked(ctx, hookedChange[T]{
+			Op: ChangeDel, Entities: []*T{entity}, Where: o.QueryBuilder(true), Fields: allFields[T],
+			Exec: func(ctx context.Context, r *Repo[T]) (sql.Result, error) {
+				return r.Del(ctx, entity, opts...)
+			},
+		})
+	}
+	q := repo.db.NewDelete().Model(entity).ApplyQueryBuilder(scope)
 	return applyDelOptions(q, opts...).Exec(ctx)
 }
 
 // Delm deletes multiple entities from the repository.
 func (repo *Repo[T]) Delm(ctx context.Context, entities []*T, opts ...DelOption,
 ) (res sql.Result, err error) {
-	q := repo.db.NewDelete().Model(&entities)
+	scope, err := repo.scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(repo.hooks) != 0 {
+		return repo.runHooked(ctx, hookedChange[T]{
+			Op: ChangeDel, Entities: entities, Where: wherePK, Fields: allFields[T],
+			Exec: func(ctx context.Context, r *Repo[T]) (sql.Result, error) {
+				return r.Delm(ctx, entities, opts...)
+			},
+		})
+	}
+	q := repo.db.NewDelete().Model(&entities).ApplyQueryBuilder(scope)
 	return applyDelOptions(q, opts...).Exec(ctx)
 }
 
@@ -228,7 +549,11 @@ func (repo *Repo[T]) Delf(
 	entity *T,
 	f func(q *bun.DeleteQuery) *bun.DeleteQuery,
 ) (sql.Result, error) {
-	return repo.db.NewDelete().Model(entity).Apply(f).Exec(ctx)
+	scope, err := repo.scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repo.db.NewDelete().Model(entity).ApplyQueryBuilder(scope).Apply(f).Exec(ctx)
 }
 
 func applyDelOptions(q *bun.DeleteQuery, opts ...DelOption) *bun.DeleteQuery {
@@ -240,6 +565,9 @@ func applyDelOptions(q *bun.DeleteQuery, opts ...DelOption) *bun.DeleteQuery {
 	if o.Returning.A != "" {
 		q.Returning(o.Returning.A, o.Returning.B...)
 	}
+	if o.HardDelete {
+		q.ForceDelete()
+	}
 	return q
 }
 
@@ -320,6 +648,11 @@ type AddGetUpdOption interface {
 	UpdOption
 }
 
+type GetUpdOption interface {
+	GetOption
+	UpdOption
+}
+
 type UpdDelOption interface {
 	UpdOption
 	DelOption
@@ -330,7 +663,8 @@ func Columns(cols ...string) AddGetUpdOption {
 	return columnsOption{Include: cols}
 }
 
-// ExcludeColumns specifies the columns which will be excluded from the query.
+// ExcludeColumns specifies the columns which will be excluded from the query,
+// which replaces the columns of [WithExcludeColumns] when getting.
 func ExcludeColumns(cols ...string) AddGetUpdOption {
 	return columnsOption{Exclude: cols}
 }
@@ -352,15 +686,24 @@ func (o columnsOption) ApplyUpd(uo *updOption) {
 	uo.Columns = o
 }
 
-// ForUpdate locks the rows for an update.
-func ForUpdate() GetOption {
-	return forUpdateOption(true)
+// ForUpdate locks the rows for an update with the modifiers, see [Lock].
+//
+// Example of claiming the jobs without blocking the other workers:
+//
+//	jobs, _, err := repo.Getm(ctx, lp, &query, bunrepo.ForUpdate(dbz.SkipLocked()))
+func ForUpdate(opts ...dbz.LockOption) GetOption {
+	return lockOption(dbz.NewLock(dbz.Update, opts...))
 }
 
-type forUpdateOption bool
+// ForLock locks the rows in the mode with the modifiers, see [Lock].
+func ForLock(f dbz.For, opts ...dbz.LockOption) GetOption {
+	return lockOption(dbz.NewLock(f, opts...))
+}
+
+type lockOption dbz.Lock
 
-func (fu forUpdateOption) ApplyGet(o *getOption) {
-	o.ForUpdate = bool(fu)
+func (lo lockOption) ApplyGet(o *getOption) {
+	o.Lock = dbz.Lock(lo)
 }
 
 // Count count the query when call [Getm].
@@ -368,12 +711,42 @@ func Count() GetOption {
 	return countOption(true)
 }
 
+// NoCount does not count the query when call [Getm], which overrides [WithCount].
+func NoCount() GetOption {
+	return countOption(false)
+}
+
 type countOption bool
 
 func (co countOption) ApplyGet(o *getOption) {
 	o.Count = bool(co)
 }
 
+// CursorCodec sets the codec of the cursors when call [Repo.Getc].
+func CursorCodec(cc *dbz.CursorCodec) GetOption {
+	return cursorCodecOption{cc}
+}
+
+// MaxLimit sets the max limit of [Repo.Getm] and [Repo.Getc],
+// which overrides the MaxLimit of the params and [WithMaxLimit], -1 means no limit.
+func MaxLimit(n int32) GetOption {
+	return maxLimitOption(n)
+}
+
+type maxLimitOption int32
+
+func (mo maxLimitOption) ApplyGet(o *getOption) {
+	o.MaxLimit = int32(mo)
+}
+
+type cursorCodecOption struct {
+	cc *dbz.CursorCodec
+}
+
+func (co cursorCodecOption) ApplyGet(o *getOption) {
+	o.Codec = co.cc
+}
+
 type onAdd string
 
 // On performs an upsert operation.
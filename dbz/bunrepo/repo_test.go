@@ -241,3 +241,90 @@ func TestPayment(t *testing.T) {
 		assert.Equal(t, "I-4234", got[0].ProviderID)
 	})
 }
+
+type Member struct {
+	ID           int `bun:",pk,autoincrement"`
+	Name         string
+	PasswordHash string
+	CreatedAt    time.Time `bun:",nullzero,default:CURRENT_TIMESTAMP"`
+}
+
+func TestRepoDefaults(t *testing.T) {
+	bdb, err := newDB()
+	require.NoError(t, err)
+	ctx := context.Background()
+	testingz.R(bdb.NewCreateTable().Model((*Member)(nil)).Exec(ctx)).NoError(t)
+	repo := New(bdb,
+		WithReturning[Member]("*"),
+		WithMaxLimit[Member](2),
+		WithOrders[Member]("id DESC"),
+		WithExcludeColumns[Member]("password_hash"),
+		WithCount[Member](),
+	)
+
+	m := &Member{Name: "a", PasswordHash: "x"}
+	testingz.R(repo.Add(ctx, m)).NoError(t)
+	assert.NotZero(t, m.ID)
+	assert.False(t, m.CreatedAt.IsZero(), "returning")
+	testingz.R(repo.Addm(ctx, []*Member{{Name: "b"}, {Name: "c"}})).NoError(t)
+
+	got := Member{ID: m.ID}
+	require.NoError(t, repo.Get(ctx, &got))
+	assert.Equal(t, "a", got.Name)
+	assert.Empty(t, got.PasswordHash)
+	require.NoError(t, repo.Get(ctx, &got, ExcludeColumns()))
+	assert.Equal(t, "x", got.PasswordHash)
+
+	names := func(ms []*Member) (res []string) {
+		for _, m := range ms {
+			res = append(res, m.Name)
+		}
+		return
+	}
+	ms, n, err := repo.Getm(ctx, &dbz.BaseList{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c", "b"}, names(ms))
+	assert.Equal(t, 3, n)
+	assert.Empty(t, ms[0].PasswordHash)
+
+	ms, n, err = repo.Getm(ctx, &dbz.BaseList{Orders: []string{"id"}}, nil, MaxLimit(-1), NoCount())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, names(ms))
+	assert.Zero(t, n)
+
+	ms, _, err = repo.Getm(ctx, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c", "b", "a"}, names(ms))
+
+	page, err := repo.Getc(ctx, &dbz.BaseCursor{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c", "b"}, names(page.Items))
+	assert.NotEmpty(t, page.Next)
+}
+
+type Sequenced struct {
+	ID        int64 `bun:",pk,autoincrement"`
+	Name      string
+	CreatedAt time.Time `bun:",nullzero,notnull,default:CURRENT_TIMESTAMP"`
+}
+
+func TestAddAutoIncrement(t *testing.T) {
+	bdb, err := newDB()
+	require.NoError(t, err)
+	ctx := context.Background()
+	testingz.R(bdb.NewCreateTable().Model((*Sequenced)(nil)).Exec(ctx)).NoError(t)
+	repo := New[Sequenced](bdb)
+
+	// The auto-increment primary keys use their defaults without the excluded columns.
+	testingz.R(repo.Add(ctx, &Sequenced{Name: "a"})).NoError(t)
+	testingz.R(repo.Addm(ctx, []*Sequenced{{Name: "b"}, {Name: "c"}})).NoError(t)
+	testingz.R(repo.Add(ctx, &Sequenced{Name: "d"}, ExcludeColumns("name"))).NoError(t)
+
+	res, _, err := repo.Getm(ctx, nil, nil)
+	require.NoError(t, err)
+	require.Len(t, res, 4)
+	for i, e := range res {
+		assert.Equal(t, int64(i+1), e.ID)
+		assert.False(t, e.CreatedAt.IsZero(), "the column default is used")
+	}
+}
@@ -0,0 +1,277 @@
+package bunrepo
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/schema"
+)
+
+// RouterOption is the option of [NewRouter].
+type RouterOption func(r *Router)
+
+// WithHealthCheck sets the interval of pinging the replicas, default to 10s, 0 to disable.
+// The replicas failing the ping are skipped until they pass the next one.
+func WithHealthCheck(interval time.Duration) RouterOption {
+	return func(r *Router) {
+		r.interval = interval
+	}
+}
+
+type replica struct {
+	db      *sql.DB
+	healthy atomic.Bool
+}
+
+// Router is a [bun.IDB] routing the reads to the replicas and the writes to the primary.
+//
+// The queries of [Router.NewSelect] are sent to the healthy replicas in turn,
+// and all the other queries, the transactions and the locking reads like `FOR UPDATE`
+// are sent to the primary. The reads are sent to the primary too:
+//   - with the context returned by [UsePrimary];
+//   - after a write with the context returned by [StickyContext], or its children,
+//     so the reads see the writes despite the replication lag.
+//
+// The queries are built and hooked by the primary.
+type Router struct {
+	primary  *bun.DB
+	replicas []*replica
+	next     atomic.Uint64
+	interval time.Duration
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+var _ bun.IDB = (*Router)(nil)
+
+// NewRouter returns a router of the primary and the replicas,
+// which should be closed to stop the health checks.
+//
+// Example:
+//
+//	db := bunrepo.NewRouter(primary, []*sql.DB{replica1, replica2})
+//	defer db.Close()
+//	repo := bunrepo.New[User](db)
+func NewRouter(primary *bun.DB, replicas []*sql.DB, opts ...RouterOption) *Router {
+	r := &Router{primary: primary, interval: 10 * time.Second, stop: make(chan struct{})}
+	for _, opt := range opts {
+		opt(r)
+	}
+	for _, db := range replicas {
+		rep := &replica{db: db}
+		rep.healthy.Store(true)
+		r.replicas = append(r.replicas, rep)
+	}
+	if r.interval > 0 && len(r.replicas) != 0 {
+		go r.checkHealth()
+	}
+	return r
+}
+
+// Close stops the health checks, the databases are not closed.
+func (r *Router) Close() error {
+	r.stopOnce.Do(func() { close(r.stop) })
+	return nil
+}
+
+// Primary returns the primary database.
+func (r *Router) Primary() *bun.DB {
+	return r.primary
+}
+
+func (r *Router) checkHealth() {
+	t := time.NewTicker(r.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-t.C:
+		}
+		for _, rep := range r.replicas {
+			ctx, cancel := context.WithTimeout(context.Background(), r.interval)
+			rep.healthy.Store(rep.db.PingContext(ctx) == nil)
+			cancel()
+		}
+	}
+}
+
+type primaryKey struct{}
+
+// UsePrimary returns a context with which the reads of the [Router] are sent to the primary.
+func UsePrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+type stickyKey struct{}
+
+// StickyContext returns a context with which the reads of the [Router]
+// are sent to the primary after a write with the context or its children,
+// like a context for an HTTP request.
+func StickyContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, stickyKey{}, new(atomic.Bool))
+}
+
+func (r *Router) wrote(ctx context.Context) {
+	if written, ok := ctx.Value(stickyKey{}).(*atomic.Bool); ok {
+		written.Store(true)
+	}
+}
+
+// lockRegexp matches the locking clauses rendered by [Lock].
+var lockRegexp = regexp.MustCompile(`(?i)\sFOR\s+(UPDATE|NO\s+KEY\s+UPDATE|SHARE|KEY\s+SHARE)\b`)
+
+// reader returns the conn to read with the ctx.
+func (r *Router) reader(ctx context.Context, query string) bun.IConn {
+	if len(r.replicas) == 0 || ctx.Value(primaryKey{}) != nil || lockRegexp.MatchString(query) {
+		return r.primary.DB
+	}
+	if written, ok := ctx.Value(stickyKey{}).(*atomic.Bool); ok && written.Load() {
+		return r.primary.DB
+	}
+	n := r.next.Add(1)
+	for i := range uint64(len(r.replicas)) {
+		if rep := r.replicas[(n+i)%uint64(len(r.replicas))]; rep.healthy.Load() {
+			return rep.db
+		}
+	}
+	return r.primary.DB
+}
+
+// readConn routes the queries to the replicas.
+type readConn struct {
+	r *Router
+}
+
+func (c readConn) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return c.r.reader(ctx, query).QueryContext(ctx, query, args...)
+}
+
+func (c readConn) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	c.r.wrote(ctx)
+	return c.r.primary.DB.ExecContext(ctx, query, args...)
+}
+
+func (c readConn) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return c.r.reader(ctx, query).QueryRowContext(ctx, query, args...)
+}
+
+// writeConn routes the queries to the primary and marks the sticky context as written,
+// including the queries with the RETURNING clause.
+type writeConn struct {
+	r *Router
+}
+
+func (c writeConn) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	c.r.wrote(ctx)
+	return c.r.primary.DB.QueryContext(ctx, query, args...)
+}
+
+func (c writeConn) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	c.r.wrote(ctx)
+	return c.r.primary.DB.ExecContext(ctx, query, args...)
+}
+
+func (c writeConn) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	c.r.wrote(ctx)
+	return c.r.primary.DB.QueryRowContext(ctx, query, args...)
+}
+
+func (r *Router) Dialect() schema.Dialect {
+	return r.primary.Dialect()
+}
+
+// QueryContext runs the raw query on the primary, since it may be a write.
+func (r *Router) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	r.wrote(ctx)
+	return r.primary.QueryContext(ctx, query, args...)
+}
+
+func (r *Router) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	r.wrote(ctx)
+	return r.primary.ExecContext(ctx, query, args...)
+}
+
+// QueryRowContext runs the raw query on the primary, since it may be a write.
+func (r *Router) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	r.wrote(ctx)
+	return r.primary.QueryRowContext(ctx, query, args...)
+}
+
+// NewSelect returns a select query which is sent to a replica, see [Router].
+func (r *Router) NewSelect() *bun.SelectQuery {
+	return r.primary.NewSelect().Conn(readConn{r})
+}
+
+func (r *Router) NewValues(model any) *bun.ValuesQuery {
+	return r.primary.NewValues(model).Conn(writeConn{r})
+}
+
+func (r *Router) NewInsert() *bun.InsertQuery {
+	return r.primary.NewInsert().Conn(writeConn{r})
+}
+
+func (r *Router) NewUpdate() *bun.UpdateQuery {
+	return r.primary.NewUpdate().Conn(writeConn{r})
+}
+
+func (r *Router) NewDelete() *bun.DeleteQuery {
+	return r.primary.NewDelete().Conn(writeConn{r})
+}
+
+func (r *Router) NewMerge() *bun.MergeQuery {
+	return r.primary.NewMerge().Conn(writeConn{r})
+}
+
+// NewRaw returns a raw query which is sent to the primary, since it may be a write.
+func (r *Router) NewRaw(query string, args ...any) *bun.RawQuery {
+	return r.primary.NewRaw(query, args...).Conn(writeConn{r})
+}
+
+func (r *Router) NewCreateTable() *bun.CreateTableQuery {
+	return r.primary.NewCreateTable().Conn(writeConn{r})
+}
+
+func (r *Router) NewDropTable() *bun.DropTableQuery {
+	return r.primary.NewDropTable().Conn(writeConn{r})
+}
+
+func (r *Router) NewCreateIndex() *bun.CreateIndexQuery {
+	return r.primary.NewCreateIndex().Conn(writeConn{r})
+}
+
+func (r *Router) NewDropIndex() *bun.DropIndexQuery {
+	return r.primary.NewDropIndex().Conn(writeConn{r})
+}
+
+func (r *Router) NewTruncateTable() *bun.TruncateTableQuery {
+	return r.primary.NewTruncateTable().Conn(writeConn{r})
+}
+
+func (r *Router) NewAddColumn() *bun.AddColumnQuery {
+	return r.primary.NewAddColumn().Conn(writeConn{r})
+}
+
+func (r *Router) NewDropColumn() *bun.DropColumnQuery {
+	return r.primary.NewDropColumn().Conn(writeConn{r})
+}
+
+// BeginTx begins a transaction on the primary, which marks the sticky context as written.
+func (r *Router) BeginTx(ctx context.Context, opts *sql.TxOptions) (bun.Tx, error) {
+	r.wrote(ctx)
+	return r.primary.BeginTx(ctx, opts)
+}
+
+// RunInTx runs f in a transaction on the primary, which marks the sticky context as written.
+func (r *Router) RunInTx(ctx context.Context, opts *sql.TxOptions,
+	f func(ctx context.Context, tx bun.Tx) error,
+) error {
+	r.wrote(ctx)
+	return r.primary.RunInTx(ctx, opts, f)
+}
@@ -0,0 +1,72 @@
+package bunrepo
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+	"github.com/uptrace/bun/driver/sqliteshim"
+
+	"github.com/adobaai/pkg/testingz"
+)
+
+type Replicated struct {
+	ID   int `bun:",pk"`
+	Name string
+}
+
+func newRouterDB(t *testing.T, name string) *sql.DB {
+	sqldb, err := sql.Open(sqliteshim.ShimName, "file:"+name+"?mode=memory&cache=shared")
+	require.NoError(t, err)
+	t.Cleanup(func() { sqldb.Close() })
+	db := bun.NewDB(sqldb, sqlitedialect.New())
+	testingz.R(db.NewCreateTable().Model((*Replicated)(nil)).Exec(context.Background())).NoError(t)
+	testingz.R(db.NewInsert().Model(&Replicated{ID: 1, Name: name}).Exec(context.Background())).NoError(t)
+	return sqldb
+}
+
+func TestRouter(t *testing.T) {
+	ctx := context.Background()
+	primary := bun.NewDB(newRouterDB(t, "router_primary"), sqlitedialect.New())
+	r1, r2 := newRouterDB(t, "router_replica1"), newRouterDB(t, "router_replica2")
+	router := NewRouter(primary, []*sql.DB{r1, r2}, WithHealthCheck(10*time.Millisecond))
+	defer router.Close()
+	repo := New[Replicated](router)
+
+	name := func(ctx context.Context) string {
+		e := &Replicated{ID: 1}
+		require.NoError(t, repo.Get(ctx, e))
+		return e.Name
+	}
+	names := map[string]bool{name(ctx): true, name(ctx): true}
+	assert.Equal(t, map[string]bool{"router_replica1": true, "router_replica2": true}, names)
+	assert.Equal(t, "router_primary", name(UsePrimary(ctx)))
+	// The locking reads go to the primary.
+	assert.Same(t, primary.DB, router.reader(ctx, `SELECT * FROM "t" FOR UPDATE SKIP LOCKED`))
+	assert.Same(t, primary.DB, router.reader(ctx, `SELECT * FROM "t" FOR NO KEY UPDATE`))
+	assert.NotSame(t, primary.DB, router.reader(ctx, `SELECT * FROM "t" WHERE "a" = 'for update'`))
+
+	// The writes go to the primary, and the sticky context reads the primary after a write.
+	sticky := StickyContext(ctx)
+	assert.Contains(t, []string{"router_replica1", "router_replica2"}, name(sticky))
+	testingz.R(repo.Add(sticky, &Replicated{ID: 2, Name: "new"})).NoError(t)
+	assert.Equal(t, "router_primary", name(sticky))
+	assert.ErrorIs(t, repo.Get(ctx, &Replicated{ID: 2}), sql.ErrNoRows)
+	e := &Replicated{ID: 2}
+	require.NoError(t, repo.Get(sticky, e))
+	assert.Equal(t, "new", e.Name)
+
+	// The unhealthy replicas are skipped.
+	r1.Close()
+	assert.Eventually(t, func() bool {
+		return !router.replicas[0].healthy.Load()
+	}, time.Second, 10*time.Millisecond)
+	for range 3 {
+		assert.Equal(t, "router_replica2", name(ctx))
+	}
+}
@@ -0,0 +1,88 @@
+package bunrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+
+	"github.com/uptrace/bun"
+)
+
+// ErrNoSoftDelete is returned by [Repo.Restore] if the entity has no soft delete column.
+var ErrNoSoftDelete = errors.New("bunrepo: no soft delete column")
+
+type deletedOption int8
+
+const (
+	notDeleted deletedOption = iota
+	withDeleted
+	onlyDeleted
+)
+
+// WithDeleted includes the soft-deleted rows.
+func WithDeleted() GetUpdOption {
+	return withDeleted
+}
+
+// OnlyDeleted selects the soft-deleted rows only.
+func OnlyDeleted() GetUpdOption {
+	return onlyDeleted
+}
+
+func (do deletedOption) ApplyGet(o *getOption) {
+	o.Deleted = do
+}
+
+func (do deletedOption) ApplyUpd(o *updOption) {
+	o.Deleted = do
+}
+
+func (do deletedOption) QueryBuilder() func(bun.QueryBuilder) bun.QueryBuilder {
+	return func(qb bun.QueryBuilder) bun.QueryBuilder {
+		switch do {
+		case withDeleted:
+			return qb.WhereAllWithDeleted()
+		case onlyDeleted:
+			return qb.WhereDeleted()
+		}
+		return qb
+	}
+}
+
+// HardDelete deletes the rows even if soft delete is enabled.
+func HardDelete() DelOption {
+	return hardDeleteOption(true)
+}
+
+type hardDeleteOption bool
+
+func (ho hardDeleteOption) ApplyDel(o *delOption) {
+	o.HardDelete = bool(ho)
+}
+
+// Restore restores the soft-deleted entity by clearing the soft delete column.
+func (repo *Repo[T]) Restore(ctx context.Context, entity *T, opts ...UpdOption,
+) (res sql.Result, err error) {
+	o := updOption{}
+	for _, opt := range opts {
+		opt.ApplyUpd(&o)
+	}
+	table := repo.db.Dialect().Tables().Get(reflect.TypeFor[T]())
+	if table.SoftDeleteField == nil {
+		return nil, ErrNoSoftDelete
+	}
+	scope, err := repo.scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	q := repo.db.NewUpdate().Model(entity).ApplyQueryBuilder(scope).
+		Set("? = NULL", bun.Ident(table.SoftDeleteField.Name)).
+		WhereDeleted().
+		ApplyQueryBuilder(o.QueryBuilder(true))
+	if o.Returning.A != "" {
+		q.Returning(o.Returning.A, o.Returning.B...)
+	}
+	return q.Exec(ctx)
+}
@@ -0,0 +1,72 @@
+package bunrepo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+
+	"github.com/adobaai/pkg/dbz"
+	"github.com/adobaai/pkg/testingz"
+)
+
+type Comment struct {
+	bun.BaseModel `bun:",alias:c"`
+
+	ID        int `bun:",pk"`
+	Body      string
+	DeletedAt time.Time `bun:",soft_delete,nullzero"`
+}
+
+func TestSoftDelete(t *testing.T) {
+	bdb, err := newDB()
+	require.NoError(t, err)
+	ctx := context.Background()
+	testingz.R(bdb.NewCreateTable().Model((*Comment)(nil)).Exec(ctx)).NoError(t)
+	repo := New[Comment](bdb)
+
+	cs := []*Comment{{ID: 1, Body: "a"}, {ID: 2, Body: "b"}, {ID: 3, Body: "c"}}
+	testingz.R(repo.Addm(ctx, cs)).NoError(t)
+
+	res, err := repo.Del(ctx, &Comment{ID: 1})
+	require.NoError(t, err)
+	testingz.R(res.RowsAffected()).NoError(t).Equal(1)
+	testingz.R(repo.Delm(ctx, []*Comment{{ID: 2}})).NoError(t)
+
+	ids := func(opts ...GetOption) (res []int) {
+		t.Helper()
+		cs, _, err := repo.Getm(ctx, &dbz.BaseList{Orders: []string{"id"}}, nil, opts...)
+		require.NoError(t, err)
+		for _, c := range cs {
+			res = append(res, c.ID)
+		}
+		return
+	}
+	assert.Equal(t, []int{3}, ids())
+	assert.Equal(t, []int{1, 2, 3}, ids(WithDeleted()))
+	assert.Equal(t, []int{1, 2}, ids(OnlyDeleted()))
+
+	c := Comment{ID: 1}
+	require.Error(t, repo.Get(ctx, &c))
+	require.NoError(t, repo.Get(ctx, &c, WithDeleted()))
+	assert.False(t, c.DeletedAt.IsZero())
+
+	// Updates skip the soft-deleted rows.
+	res, err = repo.Upd(ctx, &Comment{ID: 1, Body: "x"})
+	require.NoError(t, err)
+	testingz.R(res.RowsAffected()).NoError(t).Equal(0)
+
+	res, err = repo.Restore(ctx, &Comment{ID: 1})
+	require.NoError(t, err)
+	testingz.R(res.RowsAffected()).NoError(t).Equal(1)
+	assert.Equal(t, []int{1, 3}, ids())
+
+	testingz.R(repo.Del(ctx, &Comment{ID: 2}, HardDelete())).NoError(t)
+	assert.Equal(t, []int{1, 3}, ids(WithDeleted()))
+
+	_, err = New[Payment](bdb).Restore(ctx, &Payment{ID: 1})
+	require.ErrorIs(t, err, ErrNoSoftDelete)
+}
@@ -0,0 +1,87 @@
+package bunrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/uptrace/bun"
+)
+
+// ErrNoTenant is returned by the tenant-scoped repos if the context has no tenant.
+var ErrNoTenant = errors.New("no tenant in the context")
+
+type tenantKey struct{}
+
+// ContextWithTenant returns a context with the tenant like the tenant ID,
+// which scopes the repos created with [WithTenant].
+func ContextWithTenant(ctx context.Context, tenant any) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant stored by [ContextWithTenant].
+func TenantFromContext(ctx context.Context) (any, bool) {
+	tenant := ctx.Value(tenantKey{})
+	return tenant, tenant != nil
+}
+
+// WithTenant scopes the repo to the tenant in the context by the column like `tenant_id`.
+//
+// All the queries of the repo, including the `f` variants like [Repo.Getf],
+// are filtered by `WHERE column = tenant`, and the column of the entities is set to the tenant
+// before the additions and the updates, so the rows never move to other tenants.
+// The upserts never update the rows of other tenants.
+// The queries fail with [ErrNoTenant] if the context has no tenant.
+//
+// Example:
+//
+//	repo := bunrepo.New(db, bunrepo.WithTenant[Order]("tenant_id"))
+//	ctx = bunrepo.ContextWithTenant(ctx, claims.TenantID)
+//	res, _, err := repo.Getm(ctx, lp, &query)
+func WithTenant[T any](column string) RepoOption[T] {
+	return func(repo *Repo[T]) {
+		repo.tenant = column
+	}
+}
+
+func noScope(qb bun.QueryBuilder) bun.QueryBuilder {
+	return qb
+}
+
+// scope returns the query builder filtering by the tenant in the context,
+// which does nothing if the repo is not scoped.
+func (repo *Repo[T]) scope(ctx context.Context) (func(bun.QueryBuilder) bun.QueryBuilder, error) {
+	if repo.tenant == "" {
+		return noScope, nil
+	}
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return nil, ErrNoTenant
+	}
+	return func(qb bun.QueryBuilder) bun.QueryBuilder {
+		return qb.Where("?TableAlias.? = ?", bun.Ident(repo.tenant), tenant)
+	}, nil
+}
+
+// setTenant sets the tenant column of the entities to the tenant in the context.
+func (repo *Repo[T]) setTenant(ctx context.Context, entities ...*T) error {
+	if repo.tenant == "" {
+		return nil
+	}
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return ErrNoTenant
+	}
+	table := repo.db.Dialect().Tables().Get(reflect.TypeFor[T]())
+	f, ok := table.FieldMap[repo.tenant]
+	if !ok {
+		return fmt.Errorf("%s does not have the tenant column %q", table.TypeName, repo.tenant)
+	}
+	for _, e := range entities {
+		if err := f.ScanValue(reflect.ValueOf(e).Elem(), tenant); err != nil {
+			return fmt.Errorf("set tenant: %w", err)
+		}
+	}
+	return nil
+}
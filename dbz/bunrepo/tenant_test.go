@@ -0,0 +1,74 @@
+package bunrepo
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/adobaai/pkg/testingz"
+)
+
+type Note struct {
+	ID       int `bun:",pk"`
+	TenantID string
+	Body     string
+}
+
+func TestWithTenant(t *testing.T) {
+	bdb, err := newDB()
+	require.NoError(t, err)
+	ctx := context.Background()
+	testingz.R(bdb.NewCreateTable().Model((*Note)(nil)).Exec(ctx)).NoError(t)
+	repo := New(bdb, WithTenant[Note]("tenant_id"))
+
+	_, _, err = repo.Getm(ctx, nil, nil)
+	assert.ErrorIs(t, err, ErrNoTenant)
+	_, err = repo.Add(ctx, &Note{ID: 1})
+	assert.ErrorIs(t, err, ErrNoTenant)
+	_, err = repo.Del(ctx, &Note{ID: 1})
+	assert.ErrorIs(t, err, ErrNoTenant)
+
+	ctxA := ContextWithTenant(ctx, "a")
+	ctxB := ContextWithTenant(ctx, "b")
+	a1 := &Note{ID: 1, TenantID: "b", Body: "a1"}
+	testingz.R(repo.Add(ctxA, a1)).NoError(t)
+	assert.Equal(t, "a", a1.TenantID)
+	testingz.R(repo.Addm(ctxA, []*Note{{ID: 2, Body: "a2"}})).NoError(t)
+	testingz.R(repo.Addm(ctxB, []*Note{{ID: 3, Body: "b3"}})).NoError(t)
+
+	res, _, err := repo.Getm(ctxA, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []*Note{
+		{ID: 1, TenantID: "a", Body: "a1"},
+		{ID: 2, TenantID: "a", Body: "a2"},
+	}, res)
+	testingz.R(repo.Count(ctxB, nil)).NoError(t).Equal(1)
+
+	assert.ErrorIs(t, repo.Get(ctxB, &Note{ID: 1}), sql.ErrNoRows)
+	b3 := &Note{ID: 3}
+	require.NoError(t, repo.Get(ctxB, b3))
+	assert.Equal(t, "b3", b3.Body)
+
+	// The rows of other tenants are never changed.
+	r, err := repo.Upd(ctxB, &Note{ID: 1, Body: "x"})
+	require.NoError(t, err)
+	testingz.R(r.RowsAffected()).NoError(t).Equal(0)
+	r, err = repo.Del(ctxB, &Note{ID: 2})
+	require.NoError(t, err)
+	testingz.R(r.RowsAffected()).NoError(t).Equal(0)
+	testingz.R(repo.Upsertm(ctxB, []*Note{{ID: 1, Body: "x"}})).NoError(t)
+	n1 := &Note{ID: 1}
+	require.NoError(t, repo.Get(ctxA, n1))
+	assert.Equal(t, &Note{ID: 1, TenantID: "a", Body: "a1"}, n1)
+
+	r, err = repo.Upd(ctxA, &Note{ID: 1, Body: "a1'"})
+	require.NoError(t, err)
+	testingz.R(r.RowsAffected()).NoError(t).Equal(1)
+	r, err = repo.Del(ctxA, &Note{ID: 2})
+	require.NoError(t, err)
+	testingz.R(r.RowsAffected()).NoError(t).Equal(1)
+	testingz.R(repo.Count(ctxA, nil)).NoError(t).Equal(1)
+}
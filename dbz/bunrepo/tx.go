@@ -0,0 +1,163 @@
+package bunrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// TxOptions is the options of [RunInTx].
+type TxOptions struct {
+	sql.TxOptions
+	// MaxRetries is the max number of the retries on the retryable errors, see [IsRetryable].
+	// Default to 3, -1 to disable retrying.
+	MaxRetries int
+	// Backoff returns the delay before the nth retry, which starts from 1.
+	// Default to the exponential backoff from 10ms to 1s with jitter.
+	Backoff func(n int) time.Duration
+}
+
+func defaultBackoff(n int) time.Duration {
+	d := min(10*time.Millisecond<<(n-1), time.Second)
+	return d/2 + rand.N(d/2+1)
+}
+
+type txKey struct{}
+
+type commitKey struct{}
+
+// commitHooks are the funcs run after the transaction of [RunInTx] commits.
+type commitHooks struct {
+	mu  sync.Mutex
+	fns []func(ctx context.Context)
+}
+
+// onCommit registers f to run after the outermost transaction of [RunInTx] commits,
+// it returns false if the context is not in the transaction.
+func onCommit(ctx context.Context, f func(ctx context.Context)) bool {
+	hs, ok := ctx.Value(commitKey{}).(*commitHooks)
+	if !ok {
+		return false
+	}
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	hs.fns = append(hs.fns, f)
+	return true
+}
+
+func (hs *commitHooks) run(ctx context.Context) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	for _, f := range hs.fns {
+		f(ctx)
+	}
+}
+
+// TxFromContext returns the transaction stored by [RunInTx].
+func TxFromContext(ctx context.Context) (bun.Tx, bool) {
+	tx, ok := ctx.Value(txKey{}).(bun.Tx)
+	return tx, ok
+}
+
+// DBFromContext returns the transaction stored by [RunInTx] if any, otherwise the db.
+func DBFromContext(ctx context.Context, db bun.IDB) bun.IDB {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx
+	}
+	return db
+}
+
+// FromContext returns a repo using the transaction stored by [RunInTx] if any,
+// otherwise the db.
+func FromContext[T any](ctx context.Context, db bun.IDB, opts ...RepoOption[T]) *Repo[T] {
+	return New(DBFromContext(ctx, db), opts...)
+}
+
+// RunInTx runs fn in a transaction, which is committed if fn returns nil,
+// otherwise rolled back. The transaction is stored in the context passed to fn,
+// so the repos created by [FromContext] with the context use it.
+//
+// The nested calls run in savepoints of the outer transaction and ignore the opts.
+// The whole transaction is retried on the retryable errors, so fn should be idempotent
+// except for the database operations.
+//
+// Example:
+//
+//	err := bunrepo.RunInTx(ctx, db, nil, func(ctx context.Context, tx bun.Tx) error {
+//		if _, err := bunrepo.FromContext[Order](ctx, db).Add(ctx, order); err != nil {
+//			return err
+//		}
+//		_, err := bunrepo.FromContext[Stock](ctx, db).Upd(ctx, stock)
+//		return err
+//	})
+func RunInTx(ctx context.Context, db bun.IDB, opts *TxOptions,
+	fn func(ctx context.Context, tx bun.Tx) error,
+) error {
+	run := func(ctx context.Context, tx bun.Tx) error {
+		return fn(context.WithValue(ctx, txKey{}, tx), tx)
+	}
+	if tx, ok := TxFromContext(ctx); ok {
+		// The retryable errors abort the whole transaction, so savepoints are not retried.
+		return tx.RunInTx(ctx, nil, run)
+	}
+
+	o := TxOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.MaxRetries == 0 {
+		o.MaxRetries = 3
+	}
+	if o.Backoff == nil {
+		o.Backoff = defaultBackoff
+	}
+
+	for n := 1; ; n++ {
+		hooks := &commitHooks{}
+		err := db.RunInTx(context.WithValue(ctx, commitKey{}, hooks), &o.TxOptions, run)
+		if err == nil {
+			hooks.run(ctx)
+			return nil
+		}
+		if n > o.MaxRetries || !IsRetryable(err) {
+			return err
+		}
+		t := time.NewTimer(o.Backoff(n))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+	}
+}
+
+// IsRetryable reports whether the error is a serialization failure (40001)
+// or a deadlock (40P01) of Postgres, after which the transaction can be retried.
+//
+// The SQLSTATE is got by the method `SQLState() string` of pgx and pq,
+// or `Field('C')` of bun pgdriver.
+func IsRetryable(err error) bool {
+	switch sqlState(err) {
+	case "40001", "40P01":
+		return true
+	}
+	return false
+}
+
+func sqlState(err error) string {
+	var se interface{ SQLState() string }
+	if errors.As(err, &se) {
+		return se.SQLState()
+	}
+	var fe interface{ Field(byte) string }
+	if errors.As(err, &fe) {
+		return fe.Field('C')
+	}
+	return ""
+}
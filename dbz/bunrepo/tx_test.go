@@ -0,0 +1,110 @@
+package bunrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+
+	"github.com/adobaai/pkg/dbz"
+	"github.com/adobaai/pkg/testingz"
+)
+
+type Entry struct {
+	ID   int `bun:",pk"`
+	Memo string
+}
+
+type sqlStateError string
+
+func (e sqlStateError) Error() string    { return "sqlstate " + string(e) }
+func (e sqlStateError) SQLState() string { return string(e) }
+
+type fieldError string
+
+func (e fieldError) Error() string { return "field " + string(e) }
+func (e fieldError) Field(k byte) string {
+	if k == 'C' {
+		return string(e)
+	}
+	return ""
+}
+
+func TestRunInTx(t *testing.T) {
+	bdb, err := newDB()
+	require.NoError(t, err)
+	ctx := context.Background()
+	testingz.R(bdb.NewCreateTable().Model((*Entry)(nil)).Exec(ctx)).NoError(t)
+
+	errAbort := errors.New("abort")
+	err = RunInTx(ctx, bdb, nil, func(ctx context.Context, tx bun.Tx) error {
+		got, ok := TxFromContext(ctx)
+		require.True(t, ok)
+		assert.Equal(t, tx, got)
+
+		repo := FromContext[Entry](ctx, bdb)
+		testingz.R(repo.Add(ctx, &Entry{ID: 1})).NoError(t)
+
+		err := RunInTx(ctx, bdb, nil, func(ctx context.Context, sp bun.Tx) error {
+			testingz.R(FromContext[Entry](ctx, bdb).Add(ctx, &Entry{ID: 2})).NoError(t)
+			return errAbort
+		})
+		require.ErrorIs(t, err, errAbort)
+
+		return RunInTx(ctx, bdb, nil, func(ctx context.Context, sp bun.Tx) error {
+			_, err := FromContext[Entry](ctx, bdb).Add(ctx, &Entry{ID: 3})
+			return err
+		})
+	})
+	require.NoError(t, err)
+	_, ok := TxFromContext(ctx)
+	assert.False(t, ok)
+
+	es, _, err := New[Entry](bdb).Getm(ctx, &dbz.BaseList{Orders: []string{"id"}}, nil)
+	require.NoError(t, err)
+	require.Len(t, es, 2)
+	assert.Equal(t, []int{1, 3}, []int{es[0].ID, es[1].ID})
+
+	t.Run("Retry", func(t *testing.T) {
+		var n int
+		opts := &TxOptions{Backoff: func(int) time.Duration { return time.Millisecond }}
+		err := RunInTx(ctx, bdb, opts, func(ctx context.Context, tx bun.Tx) error {
+			n++
+			if _, err := FromContext[Entry](ctx, bdb).Add(ctx, &Entry{ID: 10}); err != nil {
+				return err
+			}
+			if n < 3 {
+				return fmt.Errorf("upd: %w", sqlStateError("40001"))
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 3, n)
+
+		n = 0
+		err = RunInTx(ctx, bdb, opts, func(ctx context.Context, tx bun.Tx) error {
+			n++
+			return fieldError("40P01")
+		})
+		require.Error(t, err)
+		assert.Equal(t, 4, n)
+
+		n = 0
+		opts.MaxRetries = -1
+		err = RunInTx(ctx, bdb, opts, func(ctx context.Context, tx bun.Tx) error {
+			n++
+			return sqlStateError("40001")
+		})
+		require.Error(t, err)
+		assert.Equal(t, 1, n)
+	})
+
+	assert.False(t, IsRetryable(errAbort))
+	assert.False(t, IsRetryable(sqlStateError("23505")))
+	assert.True(t, IsRetryable(fieldError("40001")))
+}
@@ -0,0 +1,133 @@
+package bunrepo
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/schema"
+)
+
+// ErrConflict is matched by [*ConflictError] with errors.Is.
+var ErrConflict = errors.New("bunrepo: version conflict")
+
+// ConflictError is returned by [Repo.Upd] and [Repo.Updm] when the version of
+// the entity is stale, i.e. the row has been updated by others.
+type ConflictError struct {
+	// Entity is the entity failed to update.
+	Entity any
+	// Version is the current version of the row, 0 if the row does not exist.
+	Version int64
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("bunrepo: version conflict, current version %d", e.Version)
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// versionField returns the version column tagged with `dbz:"version"`, which is an integer:
+//
+//	Version int64 `dbz:"version"`
+func versionField(table *schema.Table) (*schema.Field, error) {
+	for _, f := range table.Fields {
+		if f.StructField.Tag.Get("dbz") != "version" {
+			continue
+		}
+		switch f.StructField.Type.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return f, nil
+		}
+		return nil, fmt.Errorf("%s.%s: the version is not an integer", table.TypeName, f.GoName)
+	}
+	return nil, nil
+}
+
+func (repo *Repo[T]) versionField() (*schema.Field, error) {
+	return versionField(repo.db.Dialect().Tables().Get(reflect.TypeFor[T]()))
+}
+
+// addVersion adds delta to the version of the entity and returns the old version.
+func addVersion[T any](f *schema.Field, entity *T, delta int64) int64 {
+	v := f.Value(reflect.ValueOf(entity).Elem())
+	if v.CanInt() {
+		old := v.Int()
+		v.SetInt(old + delta)
+		return old
+	}
+	old := int64(v.Uint())
+	v.SetUint(uint64(old + delta))
+	return old
+}
+
+// updVersion executes the update with optimistic locking: the version of the entity
+// is increased if the row is not updated by others, otherwise a conflict error is returned.
+func (repo *Repo[T]) updVersion(ctx context.Context, q *bun.UpdateQuery, f *schema.Field,
+	entity *T, opts []UpdOption,
+) (sql.Result, error) {
+	o := updOption{}
+	for _, opt := range opts {
+		opt.ApplyUpd(&o)
+	}
+	if len(o.Columns.Include) != 0 {
+		q.Column(f.Name)
+	}
+
+	old := addVersion(f, entity, 1)
+	q.Where("?TableAlias.? = ?", bun.Ident(f.Name), old)
+	res, err := q.Exec(ctx)
+	if err != nil {
+		addVersion(f, entity, -1)
+		return res, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil || n != 0 {
+		return res, err
+	}
+
+	addVersion(f, entity, -1)
+	ce := &ConflictError{Entity: entity}
+	scope, err := repo.scope(ctx)
+	if err != nil {
+		return res, err
+	}
+	err = repo.db.NewSelect().Model(entity).Column(f.Name).WherePK().ApplyQueryBuilder(scope).
+		Scan(ctx, &ce.Version)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return res, fmt.Errorf("get version: %w", err)
+	}
+	return res, ce
+}
+
+// updmVersion updates the entities one by one with optimistic locking,
+// since the conflicts in a bulk update cannot be told reliably.
+func (repo *Repo[T]) updmVersion(ctx context.Context, f *schema.Field, entities []*T,
+	scope func(bun.QueryBuilder) bun.QueryBuilder, opts []UpdOption,
+) (sql.Result, error) {
+	var (
+		errs []error
+		sum  int64
+	)
+	for _, e := range entities {
+		q := applyUpdOptions(repo.db.NewUpdate().Model(e).ApplyQueryBuilder(scope), opts...)
+		res, err := repo.updVersion(ctx, q, f, e, opts)
+		var ce *ConflictError
+		switch {
+		case errors.As(err, &ce):
+			errs = append(errs, err)
+		case err != nil:
+			return driver.RowsAffected(sum), err
+		default:
+			n, _ := res.RowsAffected()
+			sum += n
+		}
+	}
+	return driver.RowsAffected(sum), errors.Join(errs...)
+}
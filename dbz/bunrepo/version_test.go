@@ -0,0 +1,75 @@
+package bunrepo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/adobaai/pkg/testingz"
+)
+
+type Doc struct {
+	ID      int `bun:",pk"`
+	Title   string
+	Version int64 `dbz:"version"`
+}
+
+func TestOptimisticLocking(t *testing.T) {
+	bdb, err := newDB()
+	require.NoError(t, err)
+	ctx := context.Background()
+	testingz.R(bdb.NewCreateTable().Model((*Doc)(nil)).Exec(ctx)).NoError(t)
+	repo := New[Doc](bdb)
+	testingz.R(repo.Addm(ctx, []*Doc{{ID: 1, Version: 1}, {ID: 2, Version: 1}, {ID: 3, Version: 1}})).NoError(t)
+
+	a, b := &Doc{ID: 1, Title: "a", Version: 1}, &Doc{ID: 1, Title: "b", Version: 1}
+	testingz.R(repo.Upd(ctx, a)).NoError(t)
+	assert.EqualValues(t, 2, a.Version)
+
+	_, err = repo.Upd(ctx, b)
+	require.ErrorIs(t, err, ErrConflict)
+	var ce *ConflictError
+	require.ErrorAs(t, err, &ce)
+	assert.EqualValues(t, 2, ce.Version)
+	assert.Same(t, b, ce.Entity)
+	assert.EqualValues(t, 1, b.Version)
+
+	b.Version = ce.Version
+	testingz.R(repo.Upd(ctx, b, Columns("title"))).NoError(t)
+	got := Doc{ID: 1}
+	require.NoError(t, repo.Get(ctx, &got))
+	assert.Equal(t, Doc{ID: 1, Title: "b", Version: 3}, got)
+
+	_, err = repo.Upd(ctx, &Doc{ID: 9, Title: "x", Version: 1})
+	require.ErrorAs(t, err, &ce)
+	assert.EqualValues(t, 0, ce.Version)
+
+	t.Run("Updm", func(t *testing.T) {
+		ds := []*Doc{{ID: 2, Title: "x", Version: 1}, {ID: 3, Title: "y", Version: 1}}
+		testingz.R(repo.Updm(ctx, ds)).NoError(t)
+		assert.EqualValues(t, 2, ds[0].Version)
+		assert.EqualValues(t, 2, ds[1].Version)
+
+		ds = []*Doc{{ID: 2, Title: "z", Version: 2}, {ID: 3, Title: "z", Version: 1}}
+		_, err := repo.Updm(ctx, ds)
+		require.ErrorAs(t, err, &ce)
+		assert.Same(t, ds[1], ce.Entity)
+		assert.EqualValues(t, 2, ce.Version)
+		assert.EqualValues(t, 3, ds[0].Version)
+		assert.EqualValues(t, 1, ds[1].Version)
+	})
+
+	t.Run("NotInteger", func(t *testing.T) {
+		type Rev struct {
+			ID      int     `bun:",pk"`
+			Version *string `dbz:"version"`
+		}
+		repo := New[Rev](bdb)
+		_, err := repo.Upd(ctx, &Rev{ID: 1})
+		require.EqualError(t, err, "Rev.Version: the version is not an integer")
+		_, err = repo.Updm(ctx, []*Rev{{ID: 1}})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,274 @@
+package dbz
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// ErrInvalidCursor is returned when the cursor is malformed, tampered or
+// created with different orders.
+var ErrInvalidCursor = errors.New("dbz: invalid cursor")
+
+// CursorParams is for keyset (cursor) pagination,
+// which is stable and fast on large tables comparing to [ListParams].
+type CursorParams interface {
+	GetLimit() uint32
+	// GetCursor returns the cursor of the page, empty for the first page.
+	GetCursor() string
+	GetOrders() []string
+}
+
+// BaseCursor is a basic implementation of CursorParams.
+type BaseCursor struct {
+	Limit    uint32
+	Cursor   string
+	Orders   []string
+	MaxLimit int32
+}
+
+func (p *BaseCursor) GetLimit() uint32 {
+	if p == nil {
+		return MaxLimit
+	}
+	return p.Limit
+}
+
+func (p *BaseCursor) GetCursor() string {
+	if p == nil {
+		return ""
+	}
+	return p.Cursor
+}
+
+func (p *BaseCursor) GetOrders() []string {
+	if p == nil {
+		return nil
+	}
+	return p.Orders
+}
+
+// SafeCursorLimit returns the limit of CursorParams which does not exceed the maximum allowed limit.
+func SafeCursorLimit(p CursorParams) uint32 {
+	var maxs []int32
+	if bp, ok := p.(*BaseCursor); ok && bp != nil && bp.MaxLimit != 0 {
+		maxs = append(maxs, bp.MaxLimit)
+	}
+	return SafeLimit(p.GetLimit(), maxs...)
+}
+
+// Page is a page of keyset pagination.
+type Page[T any] struct {
+	Items []*T
+	// Next is the cursor of the next page, empty if there are no more items.
+	Next string
+	// Prev is the cursor of the previous page, empty if it is the first page.
+	Prev string
+}
+
+// Cursor is the decoded form of a cursor.
+type Cursor struct {
+	// Orders are the orders the cursor is created with.
+	Orders []string
+	// Values are the order-by values of the last row of the page,
+	// or the first row if Backward.
+	Values []any
+	// Backward reports whether the cursor points to the previous page.
+	Backward bool
+}
+
+// CursorCodec encodes and decodes cursors, which are signed with HMAC-SHA256
+// so that clients cannot forge them.
+type CursorCodec struct {
+	key []byte
+}
+
+// NewCursorCodec returns a codec signing the cursors with the key.
+func NewCursorCodec(key []byte) *CursorCodec {
+	return &CursorCodec{key: key}
+}
+
+var defaultCodec atomic.Pointer[CursorCodec]
+
+func init() {
+	// The random key makes the cursors invalid after restarting,
+	// call SetCursorKey to share the cursors among instances.
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	defaultCodec.Store(NewCursorCodec(key))
+}
+
+// SetCursorKey sets the key of the default codec.
+func SetCursorKey(key []byte) {
+	defaultCodec.Store(NewCursorCodec(key))
+}
+
+// DefaultCursorCodec returns the default codec.
+func DefaultCursorCodec() *CursorCodec {
+	return defaultCodec.Load()
+}
+
+type cursorJSON struct {
+	Orders   []string      `json:"o"`
+	Values   []cursorValue `json:"v"`
+	Backward bool          `json:"b,omitempty"`
+}
+
+// cursorValue keeps the type of the value, since JSON loses the types of integers and times.
+type cursorValue struct {
+	T string `json:"t"`
+	V any    `json:"v,omitempty"`
+}
+
+// Encode encodes the cursor as a URL-safe base64 string.
+func (cc *CursorCodec) Encode(c Cursor) (string, error) {
+	cj := cursorJSON{Orders: c.Orders, Backward: c.Backward}
+	for _, v := range c.Values {
+		cv, err := toCursorValue(v)
+		if err != nil {
+			return "", err
+		}
+		cj.Values = append(cj.Values, cv)
+	}
+	b, err := json.Marshal(cj)
+	if err != nil {
+		return "", fmt.Errorf("marshal cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(append(b, cc.sign(b)...)), nil
+}
+
+// Decode decodes and verifies the cursor.
+func (cc *CursorCodec) Decode(s string) (res Cursor, err error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) < sha256.Size {
+		return res, ErrInvalidCursor
+	}
+	payload, sig := b[:len(b)-sha256.Size], b[len(b)-sha256.Size:]
+	if !hmac.Equal(sig, cc.sign(payload)) {
+		return res, ErrInvalidCursor
+	}
+
+	var cj cursorJSON
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	if err = dec.Decode(&cj); err != nil {
+		return res, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+	}
+	res = Cursor{Orders: cj.Orders, Backward: cj.Backward}
+	for _, cv := range cj.Values {
+		v, err := cv.value()
+		if err != nil {
+			return res, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+		}
+		res.Values = append(res.Values, v)
+	}
+	return res, nil
+}
+
+// DecodeFor decodes the cursor and checks that it is created with the orders.
+func (cc *CursorCodec) DecodeFor(s string, orders []string) (Cursor, error) {
+	c, err := cc.Decode(s)
+	if err != nil {
+		return c, err
+	}
+	if !slices.Equal(c.Orders, orders) || len(c.Values) != len(orders) {
+		return c, fmt.Errorf("%w: orders mismatch", ErrInvalidCursor)
+	}
+	return c, nil
+}
+
+func (cc *CursorCodec) sign(b []byte) []byte {
+	h := hmac.New(sha256.New, cc.key)
+	h.Write(b)
+	return h.Sum(nil)
+}
+
+func toCursorValue(v any) (cursorValue, error) {
+	if vr, ok := v.(driver.Valuer); ok {
+		if rv := reflect.ValueOf(v); !(rv.Kind() == reflect.Pointer && rv.IsNil()) {
+			var err error
+			if v, err = vr.Value(); err != nil {
+				return cursorValue{}, fmt.Errorf("cursor value: %w", err)
+			}
+		}
+	}
+
+	switch v := v.(type) {
+	case nil:
+		return cursorValue{T: "n"}, nil
+	case time.Time:
+		return cursorValue{T: "t", V: v.Format(time.RFC3339Nano)}, nil
+	case []byte:
+		return cursorValue{T: "x", V: v}, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Pointer:
+		if rv.IsNil() {
+			return cursorValue{T: "n"}, nil
+		}
+		return toCursorValue(rv.Elem().Interface())
+	case reflect.Bool:
+		return cursorValue{T: "b", V: rv.Bool()}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return cursorValue{T: "i", V: rv.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return cursorValue{T: "u", V: rv.Uint()}, nil
+	case reflect.Float32, reflect.Float64:
+		return cursorValue{T: "f", V: rv.Float()}, nil
+	case reflect.String:
+		return cursorValue{T: "s", V: rv.String()}, nil
+	}
+	return cursorValue{}, fmt.Errorf("cursor value: unsupported type %T", v)
+}
+
+func (cv cursorValue) value() (any, error) {
+	switch cv.T {
+	case "n":
+		return nil, nil
+	case "b":
+		b, ok := cv.V.(bool)
+		if !ok {
+			return nil, fmt.Errorf("bad bool %v", cv.V)
+		}
+		return b, nil
+	case "s", "t", "x":
+		s, ok := cv.V.(string)
+		if !ok {
+			return nil, fmt.Errorf("bad value %v of type %s", cv.V, cv.T)
+		}
+		switch cv.T {
+		case "t":
+			return time.Parse(time.RFC3339Nano, s)
+		case "x":
+			return base64.StdEncoding.DecodeString(s)
+		}
+		return s, nil
+	case "i", "u", "f":
+		n, ok := cv.V.(json.Number)
+		if !ok {
+			return nil, fmt.Errorf("bad number %v", cv.V)
+		}
+		switch cv.T {
+		case "i":
+			return n.Int64()
+		case "u":
+			var u uint64
+			err := json.Unmarshal([]byte(n), &u)
+			return u, err
+		}
+		return n.Float64()
+	}
+	return nil, fmt.Errorf("unknown type %q", cv.T)
+}
@@ -0,0 +1,52 @@
+package dbz
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/adobaai/pkg/testingz"
+)
+
+func TestCursor(t *testing.T) {
+	cc := NewCursorCodec([]byte("secret"))
+	ts := time.Date(2024, 11, 11, 14, 0, 9, 123, time.UTC)
+	name := "foo"
+	c := Cursor{
+		Orders:   []string{"a ASC", "b DESC", "c ASC", "d ASC", "e ASC", "f ASC", "g ASC", "h ASC"},
+		Values:   []any{int64(1) << 60, uint8(2), 1.5, "x", ts, nil, &name, []byte{1, 2}},
+		Backward: true,
+	}
+	s := testingz.R(cc.Encode(c)).NoError(t).V()
+	assert.NotContains(t, s, "=")
+
+	got := testingz.R(cc.DecodeFor(s, c.Orders)).NoError(t).V()
+	assert.Equal(t, []any{int64(1) << 60, uint64(2), 1.5, "x", ts, nil, "foo", []byte{1, 2}}, got.Values)
+	assert.True(t, got.Backward)
+
+	testingz.R(cc.DecodeFor(s, c.Orders[1:])).ErrorIs(t, ErrInvalidCursor)
+	testingz.R(NewCursorCodec([]byte("other")).Decode(s)).ErrorIs(t, ErrInvalidCursor)
+	testingz.R(cc.Decode("not base64!")).ErrorIs(t, ErrInvalidCursor)
+	testingz.R(cc.Decode(s[:len(s)-2]+"AA")).ErrorIs(t, ErrInvalidCursor)
+	_, err := cc.Encode(Cursor{Values: []any{struct{}{}}})
+	require.Error(t, err)
+
+	SetCursorKey([]byte("secret"))
+	testingz.R(DefaultCursorCodec().Decode(s)).NoError(t)
+}
+
+func TestBaseCursor(t *testing.T) {
+	var bc *BaseCursor
+	assert.Equal(t, uint32(MaxLimit), bc.GetLimit())
+	assert.Empty(t, bc.GetCursor())
+	assert.Empty(t, bc.GetOrders())
+	assert.Equal(t, uint32(MaxLimit), SafeCursorLimit(bc))
+
+	bc = &BaseCursor{Limit: 30, MaxLimit: 20}
+	require.Equal(t, uint32(20), SafeCursorLimit(bc))
+	bc.MaxLimit = -1
+	bc.Limit = 1000
+	require.Equal(t, uint32(1000), SafeCursorLimit(bc))
+}
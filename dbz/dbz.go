@@ -11,8 +11,58 @@ const (
 	Nothing For = iota
 	Update
 	Share
+	// NoKeyUpdate is weaker than [Update], which does not block [KeyShare],
+	// so the rows can still be referenced by foreign keys.
+	NoKeyUpdate
+	// KeyShare is weaker than [Share], which only blocks the deletions and the key updates.
+	KeyShare
 )
 
+// Lock is the row locking with the modifiers.
+type Lock struct {
+	For For
+	// Of locks the rows of the tables only, like `FOR UPDATE OF t`.
+	Of []string
+	// NoWait reports an error instead of waiting if a row cannot be locked immediately.
+	NoWait bool
+	// SkipLocked skips the rows which cannot be locked immediately,
+	// which is useful for claiming the jobs from a queue table.
+	SkipLocked bool
+}
+
+// LockOption modifies the [Lock].
+type LockOption func(l *Lock)
+
+// NewLock returns the [Lock] of the mode with the options.
+func NewLock(f For, opts ...LockOption) Lock {
+	l := Lock{For: f}
+	for _, opt := range opts {
+		opt(&l)
+	}
+	return l
+}
+
+// Of locks the rows of the tables only.
+func Of(tables ...string) LockOption {
+	return func(l *Lock) {
+		l.Of = append(l.Of, tables...)
+	}
+}
+
+// NoWait reports an error if a row cannot be locked immediately.
+func NoWait() LockOption {
+	return func(l *Lock) {
+		l.NoWait = true
+	}
+}
+
+// SkipLocked skips the rows which cannot be locked immediately.
+func SkipLocked() LockOption {
+	return func(l *Lock) {
+		l.SkipLocked = true
+	}
+}
+
 // ListParams is for offset-limit pagination
 // This is mainly used with proto, so we use uint32.
 type ListParams interface {
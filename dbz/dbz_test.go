@@ -124,3 +124,9 @@ func TestAppendOrders(t *testing.T) {
 		assert.Equal(t, want, res.GetOrders())
 	})
 }
+
+func TestNewLock(t *testing.T) {
+	assert.Equal(t, Lock{For: Update}, NewLock(Update))
+	assert.Equal(t, Lock{For: Share, Of: []string{"a", "b"}, SkipLocked: true},
+		NewLock(Share, Of("a"), Of("b"), SkipLocked()))
+}
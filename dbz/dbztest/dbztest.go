@@ -0,0 +1,240 @@
+// Package dbztest provides the isolated databases and the fixtures for the repo tests.
+//
+// Example:
+//
+//	//go:embed testdata/*.yaml
+//	var fixtures embed.FS
+//
+//	func TestUserRepo(t *testing.T) {
+//		db := dbztest.Open(t)
+//		dbztest.CreateTables(t, db, (*User)(nil), (*Order)(nil))
+//		tx := dbztest.Tx(t, db)
+//		dbztest.LoadFixtures(t, tx, fixtures, "testdata/*.yaml")
+//
+//		repo := bunrepo.New[User](tx)
+//		// ...
+//		dbztest.Count[User](t.Context(), tx, "name = ?", "alice").NoError(t).Equal(1)
+//	}
+package dbztest
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+	"github.com/uptrace/bun/driver/sqliteshim"
+	"github.com/uptrace/bun/extra/bundebug"
+	"gopkg.in/yaml.v3"
+
+	"github.com/adobaai/pkg/testingz"
+)
+
+// DSNEnv is the environment variable of the Postgres DSN,
+// the tests use SQLite in-memory databases if it is empty.
+const DSNEnv = "DBZTEST_PG_DSN"
+
+// Option is the option of [Open].
+type Option func(o *option)
+
+type option struct {
+	openPG func(dsn string) (*bun.DB, error)
+}
+
+// WithPostgres sets the function opening the Postgres database of the DSN in [DSNEnv],
+// so this package does not depend on any Postgres driver.
+//
+// Example:
+//
+//	dbztest.WithPostgres(func(dsn string) (*bun.DB, error) {
+//		sqldb := sql.OpenDB(pgdriver.NewConnector(pgdriver.WithDSN(dsn)))
+//		return bun.NewDB(sqldb, pgdialect.New()), nil
+//	})
+func WithPostgres(open func(dsn string) (*bun.DB, error)) Option {
+	return func(o *option) {
+		o.openPG = open
+	}
+}
+
+// Open opens an isolated database for the test, which is closed in the cleanup.
+//
+// It is a SQLite in-memory database by default.
+// If [DSNEnv] is set, it is a Postgres schema created for the test and dropped in the cleanup,
+// which requires the [WithPostgres] option. The search path of the connections is set
+// to the schema by the `options` parameter of the DSN, which is a URL or key/value pairs.
+//
+// The queries are logged if the BUNDEBUG environment variable is set, see [bundebug.FromEnv].
+func Open(t *testing.T, opts ...Option) *bun.DB {
+	t.Helper()
+	o := option{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var db *bun.DB
+	if dsn := os.Getenv(DSNEnv); dsn != "" {
+		require.NotNil(t, o.openPG, "%s is set without the WithPostgres option", DSNEnv)
+		db = openPG(t, o.openPG, dsn)
+	} else {
+		sqldb, err := sql.Open(sqliteshim.ShimName,
+			fmt.Sprintf("file:%s?mode=memory&cache=shared", randomName()))
+		require.NoError(t, err)
+		db = bun.NewDB(sqldb, sqlitedialect.New())
+		t.Cleanup(func() { db.Close() })
+	}
+	db.AddQueryHook(bundebug.NewQueryHook(bundebug.FromEnv("BUNDEBUG")))
+	return db
+}
+
+func openPG(t *testing.T, open func(dsn string) (*bun.DB, error), dsn string) *bun.DB {
+	t.Helper()
+	ctx := context.Background()
+	schema := randomName()
+	admin, err := open(dsn)
+	require.NoError(t, err, "open postgres")
+	_, err = admin.ExecContext(ctx, "CREATE SCHEMA ?", bun.Ident(schema))
+	admin.Close()
+	require.NoError(t, err, "create schema")
+
+	db, err := open(searchPathDSN(dsn, schema))
+	require.NoError(t, err, "open postgres")
+	t.Cleanup(func() {
+		_, err := db.ExecContext(ctx, "DROP SCHEMA ? CASCADE", bun.Ident(schema))
+		db.Close()
+		require.NoError(t, err, "drop schema")
+	})
+	return db
+}
+
+// searchPathDSN returns the DSN setting the search path of the connections to the schema,
+// which is a URL like `postgres://localhost/db` or key/value pairs like `host=localhost`.
+func searchPathDSN(dsn, schema string) string {
+	options := "-csearch_path=" + schema
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		q := u.Query()
+		if o := q.Get("options"); o != "" {
+			options = o + " " + options
+		}
+		q.Set("options", options)
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+	return dsn + " options=" + options
+}
+
+func randomName() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "dbztest_" + hex.EncodeToString(b)
+}
+
+// CreateTables creates the tables of the models like (*User)(nil) if they do not exist.
+func CreateTables(t *testing.T, db bun.IDB, models ...any) {
+	t.Helper()
+	for _, m := range models {
+		_, err := db.NewCreateTable().Model(m).IfNotExists().Exec(t.Context())
+		require.NoError(t, err, "create table of %T", m)
+	}
+}
+
+// Tx begins a transaction which is rolled back in the cleanup,
+// so the changes of the test are discarded.
+func Tx(t *testing.T, db *bun.DB) bun.Tx {
+	t.Helper()
+	tx, err := db.BeginTx(t.Context(), nil)
+	require.NoError(t, err, "begin")
+	t.Cleanup(func() { tx.Rollback() })
+	return tx
+}
+
+// LoadFixtures inserts the rows in the fixture files matching the patterns, see [fs.Glob].
+//
+// The files are YAML or JSON mappings from the tables to the rows, which are mappings
+// from the columns to the values. The tables are inserted in the order of the files
+// and the keys, so the referenced tables should go first.
+//
+//	users:
+//	  - id: 1
+//	    name: alice
+//	orders:
+//	  - id: 1
+//	    user_id: 1
+func LoadFixtures(t *testing.T, db bun.IDB, fsys fs.FS, patterns ...string) {
+	t.Helper()
+	for _, pattern := range patterns {
+		names, err := fs.Glob(fsys, pattern)
+		require.NoError(t, err, "glob %s", pattern)
+		for _, name := range names {
+			require.NoError(t, loadFixture(t.Context(), db, fsys, name), "load %s", name)
+		}
+	}
+}
+
+func loadFixture(ctx context.Context, db bun.IDB, fsys fs.FS, name string) error {
+	switch ext := path.Ext(name); ext {
+	case ".yaml", ".yml", ".json":
+	default:
+		return fmt.Errorf("unsupported fixture %s", ext)
+	}
+	b, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return err
+	}
+
+	// JSON is YAML, and the node keeps the order of the tables.
+	var doc yaml.Node
+	if err = yaml.Unmarshal(b, &doc); err != nil {
+		return fmt.Errorf("unmarshal: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	tables := doc.Content[0]
+	if tables.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: the fixture is not a mapping", tables.Line)
+	}
+	for i := 0; i < len(tables.Content); i += 2 {
+		table := tables.Content[i].Value
+		var rows []map[string]any
+		if err = tables.Content[i+1].Decode(&rows); err != nil {
+			return fmt.Errorf("decode %s: %w", table, err)
+		}
+		for _, row := range rows {
+			_, err = db.NewInsert().Model(&row).ModelTableExpr("?", bun.Ident(table)).Exec(ctx)
+			if err != nil {
+				return fmt.Errorf("insert %s: %w", table, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Count counts the rows of the model T matching the where condition, which can be empty.
+func Count[T any](ctx context.Context, db bun.IDB, where string, args ...any,
+) *testingz.Result[int] {
+	q := db.NewSelect().Model((*T)(nil))
+	if where != "" {
+		q.Where(where, args...)
+	}
+	return testingz.R(q.Count(ctx))
+}
+
+// Get gets the first row of the model T matching the where condition, which can be empty.
+func Get[T any](ctx context.Context, db bun.IDB, where string, args ...any,
+) *testingz.Result[*T] {
+	res := new(T)
+	q := db.NewSelect().Model(res)
+	if where != "" {
+		q.Where(where, args...)
+	}
+	return testingz.R(res, q.Limit(1).Scan(ctx))
+}
@@ -0,0 +1,66 @@
+package dbztest
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type User struct {
+	ID   int `bun:",pk"`
+	Name string
+}
+
+type Order struct {
+	ID     int `bun:",pk"`
+	UserID int
+	Amount int
+}
+
+func TestDBZTest(t *testing.T) {
+	db := Open(t)
+	CreateTables(t, db, (*User)(nil), (*Order)(nil))
+	fsys := fstest.MapFS{
+		"testdata/users.yaml": {Data: []byte(`
+users:
+  - id: 1
+    name: alice
+  - id: 2
+    name: bob
+orders:
+  - {id: 1, user_id: 1, amount: 10}
+`)},
+		"testdata/orders.json": {Data: []byte(`{"orders": [{"id": 2, "user_id": 2, "amount": 20}]}`)},
+	}
+	ctx := t.Context()
+	LoadFixtures(t, db, fsys, "testdata/*")
+	Count[User](ctx, db, "").NoError(t).Equal(2)
+	Count[Order](ctx, db, "amount > ?", 10).NoError(t).Equal(1)
+	Get[User](ctx, db, "name = ?", "bob").NoError(t).Equal(&User{ID: 2, Name: "bob"})
+
+	t.Run("Tx", func(t *testing.T) {
+		tx := Tx(t, db)
+		LoadFixtures(t, tx, fstest.MapFS{
+			"users.yml": {Data: []byte("users:\n  - {id: 3, name: carol}\n")},
+		}, "*.yml")
+		Count[User](t.Context(), tx, "").NoError(t).Equal(3)
+	})
+	Count[User](ctx, db, "").NoError(t).Equal(2)
+
+	// The databases of the tests are isolated.
+	other := Open(t)
+	CreateTables(t, other, (*User)(nil))
+	Count[User](ctx, other, "").NoError(t).Equal(0)
+}
+
+func TestSearchPathDSN(t *testing.T) {
+	for dsn, want := range map[string]string{
+		"postgres://u@localhost/db?sslmode=disable": "postgres://u@localhost/db?options=-csearch_path%3Ds&sslmode=disable",
+		"postgres://localhost/db?options=-cstatement_timeout%3D5s": "postgres://localhost/db?options=" +
+			"-cstatement_timeout%3D5s+-csearch_path%3Ds",
+		"host=localhost dbname=db": "host=localhost dbname=db options=-csearch_path=s",
+	} {
+		assert.Equal(t, want, searchPathDSN(dsn, "s"), dsn)
+	}
+}
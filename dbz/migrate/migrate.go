@@ -0,0 +1,426 @@
+// Package migrate runs the versioned schema migrations with any [bun.IDB].
+//
+// The migrations are SQL files read from an [fs.FS] like an [embed.FS],
+// or Go functions, and the applied versions are tracked in a table.
+//
+// Example:
+//
+//	//go:embed migrations/*.sql
+//	var migrations embed.FS
+//
+//	m := migrate.New(db)
+//	sub, _ := fs.Sub(migrations, "migrations")
+//	if err := m.AddFS(sub); err != nil {
+//		return err
+//	}
+//	applied, err := m.Up(ctx)
+package migrate
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+)
+
+const (
+	// DefaultTable is the default table of the applied versions.
+	DefaultTable = "schema_migrations"
+
+	// splitDirective separates the statements in a SQL file,
+	// for the drivers which cannot execute multiple statements at once.
+	splitDirective = "--migrate:split"
+	// noTxDirective on a line of a SQL file runs the migration without a transaction,
+	// which is required by the statements like `CREATE INDEX CONCURRENTLY`.
+	noTxDirective = "--migrate:notx"
+)
+
+var (
+	// ErrDuplicateVersion is returned if the migrations have the same version.
+	ErrDuplicateVersion = errors.New("duplicate migration version")
+	// ErrNoDown is returned if an irreversible migration is reverted.
+	ErrNoDown = errors.New("migration has no down")
+	// ErrUnknownVersion is returned if an applied migration to revert is not added.
+	ErrUnknownVersion = errors.New("applied migration is unknown")
+)
+
+// Func is the up or down function of a migration.
+type Func func(ctx context.Context, db bun.IDB) error
+
+// Migration is a versioned migration.
+type Migration struct {
+	// Version orders the migrations, like 1 or 20250102150405.
+	Version int64
+	Name    string
+	Up      Func
+	// Down reverts Up, nil if the migration is irreversible.
+	Down Func
+	// NoTx runs the migration without a transaction.
+	NoTx bool
+}
+
+func (m *Migration) String() string {
+	return fmt.Sprintf("%d_%s", m.Version, m.Name)
+}
+
+// Status is the status of a migration.
+type Status struct {
+	*Migration
+	// AppliedAt is zero if the migration is pending.
+	AppliedAt time.Time
+}
+
+// Applied reports whether the migration is applied.
+func (s *Status) Applied() bool {
+	return !s.AppliedAt.IsZero()
+}
+
+// Option is the option of [New].
+type Option func(m *Migrator)
+
+// WithTable sets the table of the applied versions, default to [DefaultTable].
+func WithTable(table string) Option {
+	return func(m *Migrator) {
+		m.table = table
+	}
+}
+
+// WithLockKey sets the key of the Postgres advisory lock,
+// default to the hash of the table name.
+func WithLockKey(key int64) Option {
+	return func(m *Migrator) {
+		m.lockKey = key
+	}
+}
+
+// WithDryRun makes [Migrator.Up] and [Migrator.Down] return the migrations
+// to run without running them. The version table is still created if it does not exist.
+func WithDryRun() Option {
+	return func(m *Migrator) {
+		m.dryRun = true
+	}
+}
+
+// Migrator runs the migrations.
+//
+// On Postgres, the runs take an advisory lock to avoid concurrent runs:
+// a session lock on a connection of the *bun.DB or on the bun.Conn,
+// or a transaction lock in the bun.Tx.
+// The other dialects have no lock.
+type Migrator struct {
+	db         bun.IDB
+	migrations map[int64]*Migration
+	table      string
+	lockKey    int64
+	dryRun     bool
+}
+
+// New returns a migrator of the db.
+func New(db bun.IDB, opts ...Option) *Migrator {
+	m := &Migrator{db: db, migrations: map[int64]*Migration{}, table: DefaultTable}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.lockKey == 0 {
+		h := fnv.New64a()
+		h.Write([]byte(m.table))
+		m.lockKey = int64(h.Sum64())
+	}
+	return m
+}
+
+// Add adds the migrations, whose versions should be unique.
+func (m *Migrator) Add(migrations ...*Migration) error {
+	for _, mi := range migrations {
+		if _, ok := m.migrations[mi.Version]; ok {
+			return fmt.Errorf("%w: %d", ErrDuplicateVersion, mi.Version)
+		}
+		m.migrations[mi.Version] = mi
+	}
+	return nil
+}
+
+var fileRegexp = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// AddFS adds the SQL migrations in the root directory of the fsys.
+//
+// The files are named like `0001_create_users.up.sql` and `0001_create_users.down.sql`,
+// and the down files are optional.
+// The statements in a file can be separated by the `--migrate:split` lines,
+// and a `--migrate:notx` line runs the migration without a transaction.
+func (m *Migrator) AddFS(fsys fs.FS) error {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return fmt.Errorf("read dir: %w", err)
+	}
+	byVersion := map[int64]*Migration{}
+	for _, e := range entries {
+		matches := fileRegexp.FindStringSubmatch(e.Name())
+		if e.IsDir() || matches == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("parse version of %s: %w", e.Name(), err)
+		}
+		b, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return fmt.Errorf("read %s: %w", e.Name(), err)
+		}
+
+		mi := byVersion[version]
+		if mi == nil {
+			mi = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = mi
+		} else if mi.Name != matches[2] {
+			return fmt.Errorf("%w: %s", ErrDuplicateVersion, e.Name())
+		}
+		f, noTx := sqlFunc(string(b))
+		if matches[3] == "up" {
+			mi.Up, mi.NoTx = f, noTx
+		} else {
+			mi.Down = f
+		}
+	}
+
+	ms := make([]*Migration, 0, len(byVersion))
+	for _, mi := range byVersion {
+		if mi.Up == nil {
+			return fmt.Errorf("migration %s has no up", mi)
+		}
+		ms = append(ms, mi)
+	}
+	return m.Add(ms...)
+}
+
+func sqlFunc(content string) (f Func, noTx bool) {
+	var (
+		stmts []string
+		sb    strings.Builder
+	)
+	s := bufio.NewScanner(strings.NewReader(content))
+	for s.Scan() {
+		switch strings.TrimSpace(s.Text()) {
+		case splitDirective:
+			stmts = append(stmts, sb.String())
+			sb.Reset()
+		case noTxDirective:
+			noTx = true
+		default:
+			sb.WriteString(s.Text())
+			sb.WriteByte('\n')
+		}
+	}
+	stmts = append(stmts, sb.String())
+
+	return func(ctx context.Context, db bun.IDB) error {
+		for _, stmt := range stmts {
+			if strings.TrimSpace(stmt) == "" {
+				continue
+			}
+			if _, err := db.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, noTx
+}
+
+type migrationRow struct {
+	Version   int64 `bun:",pk"`
+	Name      string
+	AppliedAt time.Time `bun:",notnull"`
+}
+
+// Status returns the status of the migrations ordered by the versions,
+// including the applied ones which are not added.
+func (m *Migrator) Status(ctx context.Context) (res []*Status, err error) {
+	err = m.withLock(ctx, func(db bun.IDB) error {
+		res, err = m.status(ctx, db)
+		return err
+	})
+	return
+}
+
+// Up applies the pending migrations in the order of the versions,
+// and returns the applied ones.
+//
+// The pending migrations older than the applied ones are applied too.
+// Each migration is run in a transaction with the version record unless [Migration.NoTx].
+func (m *Migrator) Up(ctx context.Context) (res []*Migration, err error) {
+	err = m.withLock(ctx, func(db bun.IDB) error {
+		ss, err := m.status(ctx, db)
+		if err != nil {
+			return err
+		}
+		for _, s := range ss {
+			if s.Applied() {
+				continue
+			}
+			if !m.dryRun {
+				if err := m.run(ctx, db, s.Migration, true); err != nil {
+					return err
+				}
+			}
+			res = append(res, s.Migration)
+		}
+		return nil
+	})
+	return
+}
+
+// Down reverts the last n applied migrations in the reverse order of the versions,
+// and returns the reverted ones.
+func (m *Migrator) Down(ctx context.Context, n int) (res []*Migration, err error) {
+	err = m.withLock(ctx, func(db bun.IDB) error {
+		ss, err := m.status(ctx, db)
+		if err != nil {
+			return err
+		}
+		for _, s := range slices.Backward(ss) {
+			if len(res) == n {
+				break
+			}
+			if !s.Applied() {
+				continue
+			}
+			switch {
+			case s.Up == nil:
+				return fmt.Errorf("%w: %s", ErrUnknownVersion, s.Migration)
+			case s.Down == nil:
+				return fmt.Errorf("%w: %s", ErrNoDown, s.Migration)
+			}
+			if !m.dryRun {
+				if err := m.run(ctx, db, s.Migration, false); err != nil {
+					return err
+				}
+			}
+			res = append(res, s.Migration)
+		}
+		return nil
+	})
+	return
+}
+
+func (m *Migrator) status(ctx context.Context, db bun.IDB) ([]*Status, error) {
+	_, err := db.NewCreateTable().Model((*migrationRow)(nil)).
+		ModelTableExpr("?", bun.Ident(m.table)).IfNotExists().Exec(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("create table: %w", err)
+	}
+	var rows []migrationRow
+	err = db.NewSelect().Model(&rows).ModelTableExpr("? AS ?TableAlias", bun.Ident(m.table)).
+		Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("select applied: %w", err)
+	}
+
+	byVersion := make(map[int64]*Status, len(m.migrations))
+	for v, mi := range m.migrations {
+		byVersion[v] = &Status{Migration: mi}
+	}
+	for _, row := range rows {
+		s := byVersion[row.Version]
+		if s == nil {
+			s = &Status{Migration: &Migration{Version: row.Version, Name: row.Name}}
+			byVersion[row.Version] = s
+		}
+		s.AppliedAt = row.AppliedAt
+	}
+
+	res := make([]*Status, 0, len(byVersion))
+	for _, s := range byVersion {
+		res = append(res, s)
+	}
+	slices.SortFunc(res, func(a, b *Status) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+	return res, nil
+}
+
+func (m *Migrator) run(ctx context.Context, db bun.IDB, mi *Migration, up bool) error {
+	f := mi.Up
+	if !up {
+		f = mi.Down
+	}
+	run := func(ctx context.Context, db bun.IDB) (err error) {
+		if err = f(ctx, db); err != nil {
+			return err
+		}
+		if up {
+			row := &migrationRow{Version: mi.Version, Name: mi.Name, AppliedAt: time.Now()}
+			_, err = db.NewInsert().Model(row).ModelTableExpr("?", bun.Ident(m.table)).Exec(ctx)
+		} else {
+			_, err = db.NewDelete().Model((*migrationRow)(nil)).ModelTableExpr("?", bun.Ident(m.table)).
+				Where("version = ?", mi.Version).Exec(ctx)
+		}
+		return err
+	}
+
+	var err error
+	if mi.NoTx {
+		err = run(ctx, db)
+	} else {
+		err = db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+			return run(ctx, tx)
+		})
+	}
+	if err != nil {
+		if up {
+			return fmt.Errorf("up %s: %w", mi, err)
+		}
+		return fmt.Errorf("down %s: %w", mi, err)
+	}
+	return nil
+}
+
+// withLock runs fn with the advisory lock on Postgres.
+func (m *Migrator) withLock(ctx context.Context, fn func(db bun.IDB) error) error {
+	if m.db.Dialect().Name() != dialect.PG {
+		return fn(m.db)
+	}
+
+	switch db := m.db.(type) {
+	case bun.Tx:
+		if _, err := db.ExecContext(ctx, "SELECT pg_advisory_xact_lock(?)", m.lockKey); err != nil {
+			return fmt.Errorf("lock: %w", err)
+		}
+		return fn(db)
+	case *bun.DB:
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			return fmt.Errorf("conn: %w", err)
+		}
+		defer conn.Close()
+		return m.withConnLock(ctx, conn, fn)
+	case bun.Conn:
+		return m.withConnLock(ctx, db, fn)
+	default:
+		return fmt.Errorf("advisory lock is unsupported with %T", m.db)
+	}
+}
+
+func (m *Migrator) withConnLock(ctx context.Context, conn bun.Conn, fn func(db bun.IDB) error,
+) (err error) {
+	if _, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock(?)", m.lockKey); err != nil {
+		return fmt.Errorf("lock: %w", err)
+	}
+	defer func() {
+		_, uerr := conn.ExecContext(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock(?)", m.lockKey)
+		if uerr != nil {
+			err = errors.Join(err, fmt.Errorf("unlock: %w", uerr))
+		}
+	}()
+	return fn(conn)
+}
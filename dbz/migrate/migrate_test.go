@@ -0,0 +1,100 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+	"github.com/uptrace/bun/driver/sqliteshim"
+
+	"github.com/adobaai/pkg/testingz"
+)
+
+func newDB(t *testing.T) *bun.DB {
+	sqldb, err := sql.Open(sqliteshim.ShimName, "file:"+t.Name()+"?mode=memory&cache=shared")
+	require.NoError(t, err)
+	t.Cleanup(func() { sqldb.Close() })
+	return bun.NewDB(sqldb, sqlitedialect.New())
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+	db := newDB(t)
+	fsys := fstest.MapFS{
+		"0001_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);")},
+		"0001_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+		"0002_add_email.up.sql": {Data: []byte(`ALTER TABLE users ADD COLUMN email TEXT;
+--migrate:split
+CREATE UNIQUE INDEX users_email ON users (email);`)},
+		"0002_add_email.down.sql": {Data: []byte("DROP INDEX users_email;\n--migrate:split\nALTER TABLE users DROP COLUMN email;")},
+		"README.md":               {Data: []byte("not a migration")},
+	}
+	seed := &Migration{Version: 3, Name: "seed", Up: func(ctx context.Context, db bun.IDB) error {
+		_, err := db.NewRaw("INSERT INTO users (name, email) VALUES (?, ?)", "a", "a@x").Exec(ctx)
+		return err
+	}}
+
+	m := New(db)
+	require.NoError(t, m.AddFS(fsys))
+	require.NoError(t, m.Add(seed))
+	assert.ErrorIs(t, m.Add(&Migration{Version: 1}), ErrDuplicateVersion)
+
+	versions := func(ms []*Migration) (res []int64) {
+		for _, mi := range ms {
+			res = append(res, mi.Version)
+		}
+		return
+	}
+	dry := New(db, WithDryRun())
+	require.NoError(t, dry.AddFS(fsys))
+	require.NoError(t, dry.Add(seed))
+	res, err := dry.Up(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 3}, versions(res))
+	testingz.R(dry.Up(ctx)).NoError(t).Equal(res)
+
+	ss, err := m.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, ss, 3)
+	assert.False(t, ss[0].Applied())
+
+	res, err = m.Up(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 3}, versions(res))
+	testingz.R(db.NewSelect().Table("users").Count(ctx)).NoError(t).Equal(1)
+	testingz.R(m.Up(ctx)).NoError(t).Equal([]*Migration(nil))
+
+	ss, err = m.Status(ctx)
+	require.NoError(t, err)
+	for _, s := range ss {
+		assert.True(t, s.Applied(), s.Migration)
+	}
+
+	_, err = m.Down(ctx, 1)
+	assert.ErrorIs(t, err, ErrNoDown)
+
+	// The applied seed is unknown to the migrator without it.
+	m2 := New(db)
+	require.NoError(t, m2.AddFS(fsys))
+	_, err = m2.Down(ctx, 1)
+	assert.ErrorIs(t, err, ErrUnknownVersion)
+
+	require.NoError(t, m2.Add(&Migration{Version: 3, Name: "seed", Up: seed.Up,
+		Down: func(ctx context.Context, db bun.IDB) error {
+			_, err := db.NewRaw("DELETE FROM users").Exec(ctx)
+			return err
+		}}))
+	res, err = m2.Down(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{3, 2}, versions(res))
+	ss, err = m2.Status(ctx)
+	require.NoError(t, err)
+	assert.True(t, ss[0].Applied())
+	assert.False(t, ss[1].Applied())
+	assert.False(t, ss[2].Applied())
+}
@@ -0,0 +1,246 @@
+package predicate
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/adobaai/pkg/dbz"
+	"github.com/adobaai/pkg/strz"
+)
+
+// Expr is a node of the predicate AST, which is one of [Cond], [AndExpr], [OrExpr] and [NotExpr].
+type Expr interface {
+	isExpr()
+}
+
+// Cond is a condition on a column.
+type Cond struct {
+	Column string
+	Op     Op
+	// Value is the operand of the binary operators.
+	Value any
+	// Values are the operands of the list operators, see [Op.IsList].
+	Values []any
+	// Path is the JSON path of the JSONB operators.
+	Path []string
+	// Config is the text search config of [OpSearch].
+	Config string
+}
+
+// AndExpr is the conjunction of the exprs.
+type AndExpr []Expr
+
+// OrExpr is the disjunction of the exprs.
+type OrExpr []Expr
+
+// NotExpr is the negation of the expr.
+type NotExpr struct {
+	X Expr
+}
+
+func (Cond) isExpr()    {}
+func (AndExpr) isExpr() {}
+func (OrExpr) isExpr()  {}
+func (NotExpr) isExpr() {}
+
+// Exprer is implemented by the types which can be compiled to an [Expr], like [Field].
+type Exprer interface {
+	// Expr returns the expr on the column, or nil if there is no operation.
+	Expr(column string) Expr
+}
+
+// All returns the conjunction of the non-nil exprs, flattening the nested conjunctions.
+func All(es ...Expr) Expr {
+	var res AndExpr
+	for _, e := range es {
+		switch e := e.(type) {
+		case nil:
+		case AndExpr:
+			res = append(res, e...)
+		default:
+			res = append(res, e)
+		}
+	}
+	return simplify(res)
+}
+
+// Any returns the disjunction of the non-nil exprs, flattening the nested disjunctions.
+func Any(es ...Expr) Expr {
+	var res OrExpr
+	for _, e := range es {
+		switch e := e.(type) {
+		case nil:
+		case OrExpr:
+			res = append(res, e...)
+		default:
+			res = append(res, e)
+		}
+	}
+	switch len(res) {
+	case 0:
+		return nil
+	case 1:
+		return res[0]
+	}
+	return res
+}
+
+func simplify(es AndExpr) Expr {
+	switch len(es) {
+	case 0:
+		return nil
+	case 1:
+		return es[0]
+	}
+	return es
+}
+
+// Expr compiles the field to an [Expr] on the column.
+//
+// The predicates are joined by `AND` unless [Field.Or] is called,
+// and `AND` takes precedence over `OR` as in SQL, so
+// `GT(1).LT(5).Or().EQ(9)` is `(c > 1 AND c < 5) OR c = 9`.
+func (f *Field[T]) Expr(column string) Expr {
+	if f == nil {
+		return nil
+	}
+
+	var (
+		ors           []Expr
+		ands          AndExpr
+		not, or, zero bool
+		appendExpr    = func(e Expr) {
+			if not {
+				e = NotExpr{e}
+				not = false
+			}
+			if or && len(ands) != 0 {
+				ors = append(ors, simplify(ands))
+				ands = nil
+			}
+			or = false
+			ands = append(ands, e)
+		}
+	)
+	for _, t := range f.Tokens {
+		switch t.Type {
+		case Or:
+			or = true
+		case Not:
+			not = true
+		case Zero:
+			zero = true
+		case Pred:
+			p := t.Pred
+			if p.IsNop() && !zero {
+				continue
+			}
+			zero = false
+			c := Cond{Column: column, Op: p.Op, Path: p.Path, Config: p.Config}
+			switch {
+			case p.Op.IsList():
+				c.Values = make([]any, len(p.Vs))
+				for i, v := range p.Vs {
+					c.Values[i] = v
+				}
+			case p.Op.hasArg():
+				c.Value = p.Arg
+			case !p.Op.IsUnary():
+				c.Value = p.V
+			}
+			appendExpr(c)
+		case Group:
+			if e := t.Group.Expr(column); e != nil {
+				appendExpr(e)
+			}
+		}
+	}
+	if len(ands) != 0 {
+		ors = append(ors, simplify(ands))
+	}
+	return Any(ors...)
+}
+
+var (
+	listParamsType   = reflect.TypeFor[dbz.ListParams]()
+	cursorParamsType = reflect.TypeFor[dbz.CursorParams]()
+)
+
+// isParams reports whether the type is the pagination params like [dbz.BaseList],
+// whose methods have pointer receivers.
+func isParams(t reflect.Type) bool {
+	for _, it := range []reflect.Type{listParamsType, cursorParamsType} {
+		if t.Implements(it) || reflect.PointerTo(t).Implements(it) {
+			return true
+		}
+	}
+	return false
+}
+
+// FromStruct compiles a query struct to an [Expr], which is the conjunction of the fields.
+//
+// The fields are walked by [WalkStruct].
+// The fields implementing [Exprer] are compiled by it, the others are compared by `=`.
+func FromStruct(p any) (Expr, error) {
+	var es []Expr
+	err := WalkStruct(p, func(column string, v any) {
+		if e, ok := v.(Exprer); ok {
+			es = append(es, e.Expr(column))
+		} else {
+			es = append(es, Cond{Column: column, Op: OpEQ, Value: v})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return All(es...), nil
+}
+
+// WalkStruct calls fn with the column names and the values of the fields of a query struct.
+//
+// It will ignore zero value fields and use the `fp` tag as the column name.
+// If no tag, it will generate column names from struct field names
+// by underscoring them.
+// For example, struct field `UserID` gets column name `user_id`.
+// If the `fp` tag is set to "-", the field will be skipped,
+// so are the [dbz.For] fields and the pagination params like [dbz.BaseList].
+func WalkStruct(p any, fn func(column string, v any)) error {
+	if p == nil {
+		return nil
+	}
+
+	v := reflect.ValueOf(p)
+	if v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return fmt.Errorf("the p should be a struct or struct pointer, got %v", v.Kind())
+	}
+
+	t := v.Type()
+	for i := range v.NumField() {
+		f := v.Field(i)
+		if !t.Field(i).IsExported() || f.IsZero() {
+			continue
+		}
+
+		fi := f.Interface()
+		if _, ok := fi.(dbz.For); ok {
+			continue
+		}
+		if isParams(f.Type()) {
+			continue
+		}
+
+		ft := t.Field(i)
+		fName := ft.Tag.Get("fp")
+		if fName == "-" {
+			continue
+		}
+		if fName == "" {
+			fName = strz.Underscore(ft.Name)
+		}
+		fn(fName, fi)
+	}
+	return nil
+}
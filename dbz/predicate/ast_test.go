@@ -0,0 +1,114 @@
+package predicate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/adobaai/pkg/dbz"
+)
+
+func TestFieldExpr(t *testing.T) {
+	cases := []struct {
+		Name string
+		In   Exprer
+		Want Expr
+	}{
+		{"Nil", (*Field[int])(nil), nil},
+		{"Nop", EQ(0), nil},
+		{"Zero", EQZ(0), Cond{Column: "c", Op: OpEQ, Value: 0}},
+		{"And", GT(1).LT(5), AndExpr{Cond{Column: "c", Op: OpGT, Value: 1}, Cond{Column: "c", Op: OpLT, Value: 5}}},
+		{
+			"Precedence",
+			GT(1).LT(5).Or().EQ(9),
+			OrExpr{
+				AndExpr{Cond{Column: "c", Op: OpGT, Value: 1}, Cond{Column: "c", Op: OpLT, Value: 5}},
+				Cond{Column: "c", Op: OpEQ, Value: 9},
+			},
+		},
+		{
+			"NotIn",
+			In([]string{"a", "b"}).Not().IsNull(),
+			AndExpr{Cond{Column: "c", Op: OpIn, Values: []any{"a", "b"}}, NotExpr{Cond{Column: "c", Op: OpIsNull}}},
+		},
+		{"EmptyIn", In[int](nil), nil},
+		{
+			"Group",
+			IsNull[int]().Or().Not().Group(func(f *Field[int]) {
+				f.GTE(1).LTE(3)
+			}),
+			OrExpr{
+				Cond{Column: "c", Op: OpIsNull},
+				NotExpr{AndExpr{Cond{Column: "c", Op: OpGTE, Value: 1}, Cond{Column: "c", Op: OpLTE, Value: 3}}},
+			},
+		},
+		{"Between", NewField[int]().Between(1, 0), Cond{Column: "c", Op: OpBetween, Values: []any{1, 0}}},
+		{"NopBetween", NewField[int]().Between(0, 0).ArrayContains(nil).JSONHasKey("").Search(""), nil},
+		{
+			"JSON",
+			NewField[any]().JSONHasKey("k", "a").Search("q", "simple"),
+			AndExpr{
+				Cond{Column: "c", Op: OpJSONHasKey, Value: "k", Path: []string{"a"}},
+				Cond{Column: "c", Op: OpSearch, Value: "q", Config: "simple"},
+			},
+		},
+		{"EmptyGroup", NewField[int]().Group(func(f *Field[int]) { f.EQ(0) }).NEQ(2), Cond{Column: "c", Op: OpNEQ, Value: 2}},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			assert.Equal(t, c.Want, c.In.Expr("c"))
+		})
+	}
+}
+
+func TestFromStruct(t *testing.T) {
+	type Query struct {
+		UserID   int
+		Name     *Field[string] `fp:"u.name"`
+		Age      *Field[int]
+		Skipped  string `fp:"-"`
+		Lock     dbz.For
+		List     dbz.ListParams
+		internal int
+	}
+
+	e, err := FromStruct(&Query{
+		UserID:   1,
+		Name:     NewField[string]().Like("%foo%"),
+		Age:      EQ(0),
+		Skipped:  "x",
+		Lock:     dbz.Update,
+		List:     &dbz.BaseList{},
+		internal: 1,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, AndExpr{
+		Cond{Column: "user_id", Op: OpEQ, Value: 1},
+		Cond{Column: "u.name", Op: OpLike, Value: "%foo%"},
+	}, e)
+
+	build := func(p any) Expr {
+		e, err := FromStruct(p)
+		require.NoError(t, err)
+		return e
+	}
+	assert.Nil(t, build(nil))
+	assert.Nil(t, build(Query{}))
+	assert.Equal(t, Cond{Column: "created_at", Op: OpGT, Value: time.Unix(1, 0)},
+		build(struct{ CreatedAt *Field[time.Time] }{GT(time.Unix(1, 0))}))
+
+	_, err = FromStruct(1)
+	require.Error(t, err)
+}
+
+func TestAllAny(t *testing.T) {
+	a, b, c := Cond{Column: "a"}, Cond{Column: "b"}, Cond{Column: "c"}
+	assert.Nil(t, All())
+	assert.Nil(t, Any(nil, nil))
+	assert.Equal(t, a, All(nil, a))
+	assert.Equal(t, AndExpr{a, b, c}, All(a, AndExpr{b, c}))
+	assert.Equal(t, OrExpr{a, b, c}, Any(OrExpr{a, b}, nil, c))
+	assert.Equal(t, OrExpr{AndExpr{a, b}, c}, Any(All(a, b), c))
+}
@@ -0,0 +1,126 @@
+package predicate
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Ident is an identifier in the args of [Cond.SQL].
+type Ident string
+
+// SQL returns the SQL template of the condition, where `?` is the placeholder of an arg
+// and `\?` is a literal question mark, like the JSONB operator `?`.
+// The args of type [Ident] are identifiers which should be quoted.
+//
+// It is the common part of the SQL builders, which only differ in placeholders and quoting.
+func (c Cond) SQL() (string, []any) {
+	col := Ident(c.Column)
+	switch c.Op {
+	case OpIsNull, OpNotNull:
+		return "? " + c.Op.String(), []any{col}
+	case OpIn, OpNotIn:
+		if len(c.Values) == 0 {
+			// `IN ()` is invalid.
+			if c.Op == OpIn {
+				return "1 = 0", nil
+			}
+			return "1 = 1", nil
+		}
+		ph := strings.Repeat(", ?", len(c.Values))[2:]
+		return "? " + c.Op.String() + " (" + ph + ")", append([]any{col}, c.Values...)
+	case OpBetween:
+		return "? BETWEEN ? AND ?", append([]any{col}, c.Values...)
+	case OpHasPrefix, OpHasSuffix, OpContains:
+		// `!` has no special meaning in string literals of all the dialects, unlike `\`.
+		return "? LIKE ? ESCAPE '!'", []any{col, likePattern(c.Op, fmt.Sprint(c.Value), '!', "%")}
+	case OpArrayContains, OpArrayOverlap:
+		return "? " + c.Op.String() + " ?", []any{col, PGArray(c.Values)}
+	case OpArrayHas:
+		return "? = ANY(?)", []any{c.Value, col}
+	case OpEqAny:
+		return "? = ANY(?)", []any{col, PGArray(c.Values)}
+	case OpJSONHasKey:
+		q, args := c.jsonColumn()
+		return q + ` \? ?`, append(args, c.Value)
+	case OpJSONContains:
+		q, args := c.jsonColumn()
+		var v any = c.Value
+		if b, err := json.Marshal(c.Value); err == nil {
+			v = string(b)
+		}
+		return q + " @> ?", append(args, v)
+	case OpSearch:
+		if c.Config == "" {
+			return "to_tsvector(?) @@ plainto_tsquery(?)", []any{col, c.Value}
+		}
+		return "to_tsvector(?::regconfig, ?) @@ plainto_tsquery(?::regconfig, ?)",
+			[]any{c.Config, col, c.Config, c.Value}
+	}
+	return "? " + c.Op.String() + " ?", []any{col, c.Value}
+}
+
+func (c Cond) jsonColumn() (string, []any) {
+	if len(c.Path) == 0 {
+		return "?", []any{Ident(c.Column)}
+	}
+	return "(? #> ?)", []any{Ident(c.Column), PGArray(toAnys(c.Path))}
+}
+
+func toAnys[T any](vs []T) []any {
+	res := make([]any, len(vs))
+	for i, v := range vs {
+		res[i] = v
+	}
+	return res
+}
+
+// likePattern escapes the LIKE wildcards of the value and adds the wildcard of the operator.
+func likePattern(op Op, v string, escape rune, wildcard string) string {
+	e := string(escape)
+	v = strings.NewReplacer(e, e+e, "%", e+"%", "_", e+"_").Replace(v)
+	switch op {
+	case OpHasPrefix:
+		return v + wildcard
+	case OpHasSuffix:
+		return wildcard + v
+	default:
+		return wildcard + v + wildcard
+	}
+}
+
+// PGArray is a Postgres array, which is encoded as the array literal like `{1,"a b"}`,
+// so it can be bound as a single parameter.
+type PGArray []any
+
+// Value implements [driver.Valuer].
+func (a PGArray) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, v := range a {
+		if i != 0 {
+			b.WriteByte(',')
+		}
+		switch v := v.(type) {
+		case nil:
+			b.WriteString("NULL")
+		case bool:
+			fmt.Fprint(&b, v)
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+			fmt.Fprint(&b, v)
+		case time.Time:
+			b.WriteString(`"` + v.Format(time.RFC3339Nano) + `"`)
+		default:
+			s := fmt.Sprint(v)
+			s = strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+			b.WriteString(`"` + s + `"`)
+		}
+	}
+	b.WriteByte('}')
+	return b.String(), nil
+}
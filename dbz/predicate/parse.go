@@ -0,0 +1,194 @@
+package predicate
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Parser is implemented by the types which can be parsed from the PostgREST-like filters,
+// like [Field].
+type Parser interface {
+	// Parse parses the filter like `gte.18` and appends it with `AND`.
+	Parse(s string) error
+}
+
+var _ Parser = (*Field[int])(nil)
+
+// Parse parses the filter in the PostgREST syntax `[not.]op.value`, which is the
+// inverse of [PostgREST]. The supported operators are:
+//
+//	eq, neq, gt, gte, lt, lte  age=gte.18
+//	like, ilike                name=ilike.*foo*
+//	in                         status=in.(a,"b,c")
+//	is                         deleted_at=is.null
+//	cs, ov                     tags=cs.{a,b}
+//	plfts                      doc=plfts(english).foo bar
+//
+// Unlike the methods, the parsed zero values are not skipped, so `eq.0` is `= 0`.
+//
+// See https://docs.postgrest.org/en/stable/references/api/tables_views.html#operators
+func (f *Field[T]) Parse(s string) error {
+	op, v, ok := strings.Cut(s, ".")
+	neg := op == "not"
+	if neg {
+		op, v, ok = strings.Cut(v, ".")
+	}
+	if !ok {
+		return fmt.Errorf("missing operator in %q", s)
+	}
+
+	n := len(f.Tokens)
+	if err := f.parse(op, v); err != nil {
+		return err
+	}
+	if neg {
+		f.Tokens = slices.Insert(f.Tokens, n, Token[T]{Type: Not})
+	}
+	return nil
+}
+
+func (f *Field[T]) parse(op, v string) error {
+	if name, config, ok := strings.Cut(op, "("); ok && name == "plfts" {
+		config, ok = strings.CutSuffix(config, ")")
+		if !ok || config == "" {
+			return fmt.Errorf("invalid operator %q", op)
+		}
+		f.Search(v, config)
+		return nil
+	}
+
+	switch op {
+	case "eq", "neq", "gt", "gte", "lt", "lte", "like", "ilike":
+		if op == "like" || op == "ilike" {
+			v = strings.ReplaceAll(v, "*", "%")
+		}
+		x, err := parseValue[T](v)
+		if err != nil {
+			return err
+		}
+		f.Zero().appendPred2(pgrstParseOps[op], x)
+	case "in", "cs", "ov":
+		start, end := "(", ")"
+		if op != "in" {
+			start, end = "{", "}"
+		}
+		vs, err := parseList[T](v, start, end)
+		if err != nil {
+			return err
+		}
+		f.Zero().appendPred(Predicate[T]{Op: pgrstParseOps[op], Vs: vs})
+	case "is":
+		if v != "null" {
+			return fmt.Errorf("invalid value %q of is", v)
+		}
+		f.IsNull()
+	case "plfts":
+		f.Search(v)
+	default:
+		return fmt.Errorf("unknown operator %q", op)
+	}
+	return nil
+}
+
+var pgrstParseOps = map[string]Op{
+	"eq":    OpEQ,
+	"neq":   OpNEQ,
+	"gt":    OpGT,
+	"gte":   OpGTE,
+	"lt":    OpLT,
+	"lte":   OpLTE,
+	"like":  OpLike,
+	"ilike": OpILike,
+	"in":    OpIn,
+	"cs":    OpArrayContains,
+	"ov":    OpArrayOverlap,
+}
+
+// parseList parses the list like `(a,"b,c")`, the items with reserved characters are
+// double-quoted and `\` escapes the next character in the quotes.
+func parseList[T any](list, start, end string) ([]T, error) {
+	s, ok := strings.CutPrefix(list, start)
+	if ok {
+		s, ok = strings.CutSuffix(s, end)
+	}
+	if !ok {
+		return nil, fmt.Errorf("invalid list %q", list)
+	}
+	if s == "" {
+		return []T{}, nil
+	}
+
+	var (
+		items  []string
+		b      strings.Builder
+		quoted bool
+	)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quoted && c == '\\' && i+1 < len(s):
+			i++
+			b.WriteByte(s[i])
+		case c == '"':
+			quoted = !quoted
+		case !quoted && c == ',':
+			items = append(items, b.String())
+			b.Reset()
+		default:
+			b.WriteByte(c)
+		}
+	}
+	if quoted {
+		return nil, errors.New("unterminated quote")
+	}
+	items = append(items, b.String())
+
+	res := make([]T, len(items))
+	for i, item := range items {
+		v, err := parseValue[T](item)
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %w", i, err)
+		}
+		res[i] = v
+	}
+	return res, nil
+}
+
+// parseValue parses the value of type T,
+// which is a [encoding.TextUnmarshaler] like time.Time, or a string, bool or number.
+func parseValue[T any](s string) (res T, err error) {
+	if u, ok := any(&res).(encoding.TextUnmarshaler); ok {
+		err = u.UnmarshalText([]byte(s))
+		return
+	}
+
+	rv := reflect.ValueOf(&res).Elem()
+	switch rv.Kind() {
+	case reflect.String:
+		rv.SetString(s)
+	case reflect.Bool:
+		var b bool
+		b, err = strconv.ParseBool(s)
+		rv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		n, err = strconv.ParseInt(s, 10, rv.Type().Bits())
+		rv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n uint64
+		n, err = strconv.ParseUint(s, 10, rv.Type().Bits())
+		rv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		var n float64
+		n, err = strconv.ParseFloat(s, rv.Type().Bits())
+		rv.SetFloat(n)
+	default:
+		err = fmt.Errorf("unsupported type %T", res)
+	}
+	return
+}
@@ -0,0 +1,56 @@
+package predicate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		Name string
+		In   []string
+		Want Expr
+	}{
+		{"Zero", []string{"eq.0"}, Cond{Column: "c", Op: OpEQ, Value: 0}},
+		{
+			"And",
+			[]string{"gte.1", "not.lt.5"},
+			AndExpr{Cond{Column: "c", Op: OpGTE, Value: 1}, NotExpr{Cond{Column: "c", Op: OpLT, Value: 5}}},
+		},
+		{"In", []string{"in.(1,\"2\")"}, Cond{Column: "c", Op: OpIn, Values: []any{1, 2}}},
+		{"EmptyIn", []string{"in.()"}, Cond{Column: "c", Op: OpIn, Values: []any{}}},
+		{"IsNull", []string{"not.is.null"}, NotExpr{Cond{Column: "c", Op: OpIsNull}}},
+		{"Array", []string{"ov.{3}"}, Cond{Column: "c", Op: OpArrayOverlap, Values: []any{3}}},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			f := NewField[int]()
+			for _, s := range c.In {
+				require.NoError(t, f.Parse(s))
+			}
+			assert.Equal(t, c.Want, f.Expr("c"))
+		})
+	}
+
+	f := NewField[string]()
+	require.NoError(t, f.Parse(`like.a*`))
+	require.NoError(t, f.Parse(`cs.{"a,b","c\"d",e}`))
+	require.NoError(t, f.Parse(`plfts(english).foo bar`))
+	assert.Equal(t, AndExpr{
+		Cond{Column: "c", Op: OpLike, Value: "a%"},
+		Cond{Column: "c", Op: OpArrayContains, Values: []any{"a,b", `c"d`, "e"}},
+		Cond{Column: "c", Op: OpSearch, Value: "foo bar", Config: "english"},
+	}, f.Expr("c"))
+
+	tf := NewField[time.Time]()
+	require.NoError(t, tf.Parse("gt.2024-01-02T03:04:05Z"))
+	assert.Equal(t, Cond{Column: "c", Op: OpGT, Value: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+		tf.Expr("c"))
+
+	for _, s := range []string{"x", "not.x", "foo.1", "eq.x", "in.1,2", `in.("a)`, "is.true", "plfts().x"} {
+		assert.Error(t, NewField[int]().Parse(s), s)
+	}
+}
@@ -0,0 +1,228 @@
+package predicate
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// pgrstOps are the PostgREST operators of [Op].
+//
+// See https://docs.postgrest.org/en/stable/references/api/tables_views.html#operators
+var pgrstOps = [...]string{
+	OpEQ:      "eq",
+	OpNEQ:     "neq",
+	OpGT:      "gt",
+	OpGTE:     "gte",
+	OpLT:      "lt",
+	OpLTE:     "lte",
+	OpIn:      "in",
+	OpNotIn:   "not.in",
+	OpLike:    "like",
+	OpIsNull:  "is",
+	OpNotNull: "not.is",
+
+	OpILike:         "ilike",
+	OpHasPrefix:     "like",
+	OpHasSuffix:     "like",
+	OpContains:      "like",
+	OpArrayContains: "cs",
+	OpArrayOverlap:  "ov",
+	OpArrayHas:      "cs",
+	OpEqAny:         "in",
+	OpJSONContains:  "cs",
+	OpSearch:        "plfts",
+}
+
+// PostgREST renders an [Expr] as the horizontal filtering of PostgREST, like
+// `age=gt.18&or=(name.eq.foo,name.is.null)`.
+//
+// See https://docs.postgrest.org/en/stable/references/api/tables_views.html#horizontal-filtering
+func PostgREST(e Expr) url.Values {
+	res := url.Values{}
+	var trees []Expr
+	for _, e := range flattenAnd(pgrstLower(e)) {
+		c, neg := unwrapNot(e)
+		if cond, ok := c.(Cond); ok {
+			res.Add(pgrstColumn(cond), pgrstCond(cond, neg, false))
+		} else {
+			trees = append(trees, e)
+		}
+	}
+	switch len(trees) {
+	case 0:
+	case 1:
+		k, v := pgrstTree(trees[0])
+		res.Add(k, v)
+	default:
+		// Multiple trees are joined by `and` to avoid duplicated keys.
+		k, v := pgrstTree(AndExpr(trees))
+		res.Add(k, v)
+	}
+	return res
+}
+
+// pgrstLower rewrites the conds without PostgREST operators,
+// [OpBetween] becomes `gte` and `lte`, and [OpJSONHasKey] becomes `col->key=not.is.null`.
+func pgrstLower(e Expr) Expr {
+	switch e := e.(type) {
+	case Cond:
+		switch e.Op {
+		case OpBetween:
+			return AndExpr{
+				Cond{Column: e.Column, Op: OpGTE, Value: e.Values[0]},
+				Cond{Column: e.Column, Op: OpLTE, Value: e.Values[1]},
+			}
+		case OpJSONHasKey:
+			path := append(slices.Clone(e.Path), fmt.Sprint(e.Value))
+			return Cond{Column: e.Column, Op: OpNotNull, Path: path}
+		}
+	case NotExpr:
+		return NotExpr{pgrstLower(e.X)}
+	case AndExpr:
+		es := make([]Expr, len(e))
+		for i, e := range e {
+			es[i] = pgrstLower(e)
+		}
+		return All(es...)
+	case OrExpr:
+		es := make([]Expr, len(e))
+		for i, e := range e {
+			es[i] = pgrstLower(e)
+		}
+		return Any(es...)
+	}
+	return e
+}
+
+// pgrstColumn returns the column with the JSON path, like `data->a->b`.
+func pgrstColumn(c Cond) string {
+	if len(c.Path) == 0 {
+		return c.Column
+	}
+	return c.Column + "->" + strings.Join(c.Path, "->")
+}
+
+func flattenAnd(e Expr) []Expr {
+	switch e := e.(type) {
+	case nil:
+		return nil
+	case AndExpr:
+		return e
+	}
+	return []Expr{e}
+}
+
+// unwrapNot removes the NOTs and reports whether the expr is negated.
+func unwrapNot(e Expr) (Expr, bool) {
+	neg := false
+	for {
+		n, ok := e.(NotExpr)
+		if !ok {
+			return e, neg
+		}
+		e, neg = n.X, !neg
+	}
+}
+
+// pgrstTree returns the key and value of a logical tree like `or=(a.eq.1,b.eq.2)`.
+func pgrstTree(e Expr) (key, value string) {
+	s := pgrstExpr(e)
+	i := strings.IndexByte(s, '(')
+	return s[:i], s[i:]
+}
+
+// pgrstExpr renders the expr inside a logical tree, like `a.eq.1` or `not.or(a.eq.1,b.eq.2)`.
+func pgrstExpr(e Expr) string {
+	e, neg := unwrapNot(e)
+	var op string
+	var es []Expr
+	switch e := e.(type) {
+	case Cond:
+		return pgrstColumn(e) + "." + pgrstCond(e, neg, true)
+	case AndExpr:
+		op, es = "and", e
+	case OrExpr:
+		op, es = "or", e
+	}
+	if neg {
+		op = "not." + op
+	}
+	parts := make([]string, len(es))
+	for i, e := range es {
+		parts[i] = pgrstExpr(e)
+	}
+	return op + "(" + strings.Join(parts, ",") + ")"
+}
+
+// pgrstCond renders the operator and the value, like `not.eq.1`.
+func pgrstCond(c Cond, neg, inTree bool) string {
+	op := pgrstOps[c.Op]
+	if neg {
+		if after, ok := strings.CutPrefix(op, "not."); ok {
+			op = after
+		} else {
+			op = "not." + op
+		}
+	}
+
+	if c.Op == OpSearch && c.Config != "" {
+		op += "(" + c.Config + ")"
+	}
+
+	var v string
+	switch c.Op {
+	case OpIsNull, OpNotNull:
+		return op + ".null"
+	case OpIn, OpNotIn, OpEqAny:
+		vs := make([]string, len(c.Values))
+		for i, v := range c.Values {
+			vs[i] = pgrstQuote(pgrstValue(v), true)
+		}
+		return op + ".(" + strings.Join(vs, ",") + ")"
+	case OpArrayContains, OpArrayOverlap:
+		v = pgrstValue(PGArray(c.Values))
+	case OpArrayHas:
+		v = pgrstValue(PGArray{c.Value})
+	case OpLike, OpILike:
+		v = strings.ReplaceAll(pgrstValue(c.Value), "%", "*")
+	case OpHasPrefix, OpHasSuffix, OpContains:
+		// PostgREST passes `\` through, which is the default escape of LIKE.
+		v = likePattern(c.Op, pgrstValue(c.Value), '\\', "*")
+	case OpJSONContains:
+		b, _ := json.Marshal(c.Value)
+		v = string(b)
+	default:
+		v = pgrstValue(c.Value)
+	}
+	return op + "." + pgrstQuote(v, inTree)
+}
+
+func pgrstValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case driver.Valuer:
+		if dv, err := v.Value(); err == nil {
+			return pgrstValue(dv)
+		}
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fmt.Sprint(v)
+}
+
+// pgrstQuote quotes the value with the reserved characters in lists and logical trees.
+func pgrstQuote(v string, need bool) string {
+	if !need || !strings.ContainsAny(v, `,.:()" \`) {
+		return v
+	}
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	return `"` + strings.ReplaceAll(v, `"`, `\"`) + `"`
+}
@@ -0,0 +1,101 @@
+package predicate
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostgREST(t *testing.T) {
+	cases := []struct {
+		Name string
+		In   Expr
+		Want url.Values
+	}{
+		{"Nil", nil, url.Values{}},
+		{
+			"Conds",
+			All(
+				GT(18).LT(60).Expr("age"),
+				Cond{Column: "name", Op: OpLike, Value: "%foo%"},
+				Cond{Column: "tag", Op: OpIn, Values: []any{"a", "b,c"}},
+				NotExpr{Cond{Column: "id", Op: OpNotIn, Values: []any{1}}},
+				NotExpr{Cond{Column: "x", Op: OpEQ, Value: "a.b"}},
+				Cond{Column: "deleted_at", Op: OpIsNull},
+				Cond{Column: "created_at", Op: OpGTE, Value: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+			),
+			url.Values{
+				"age":        {"gt.18", "lt.60"},
+				"name":       {"like.*foo*"},
+				"tag":        {`in.(a,"b,c")`},
+				"id":         {"in.(1)"},
+				"x":          {"not.eq.a.b"},
+				"deleted_at": {"is.null"},
+				"created_at": {"gte.2024-01-02T03:04:05Z"},
+			},
+		},
+		{
+			"Or",
+			IsNull[int]().Or().Not().Group(func(f *Field[int]) { f.GT(1).LT(5) }).Expr("age"),
+			url.Values{"or": {"(age.is.null,not.and(age.gt.1,age.lt.5))"}},
+		},
+		{
+			"NotOr",
+			All(Cond{Column: "a", Op: OpEQ, Value: 1}, NotExpr{OrExpr{
+				Cond{Column: "b", Op: OpEQ, Value: `say "hi", bob`},
+				Cond{Column: "c", Op: OpNotNull},
+			}}),
+			url.Values{
+				"a":      {"eq.1"},
+				"not.or": {`(b.eq."say \"hi\", bob",c.not.is.null)`},
+			},
+		},
+		{
+			"Trees",
+			All(
+				OrExpr{Cond{Column: "a", Op: OpEQ, Value: 1}, Cond{Column: "b", Op: OpEQ, Value: 2}},
+				OrExpr{Cond{Column: "c", Op: OpEQ, Value: 3}, Cond{Column: "d", Op: OpEQ, Value: 4}},
+			),
+			url.Values{"and": {"(or(a.eq.1,b.eq.2),or(c.eq.3,d.eq.4))"}},
+		},
+		{
+			"Ops",
+			All(
+				NewField[int]().Between(1, 5).Expr("age"),
+				NewField[string]().ILike("%a%").Expr("name"),
+				NewField[string]().HasPrefix("5%").Expr("code"),
+				NewField[string]().ArrayContains([]string{"a", "b c"}).Expr("tags"),
+				NewField[int]().ArrayOverlap([]int{1, 2}).Expr("ids"),
+				NewField[string]().ArrayHas("x").Expr("labels"),
+				NewField[int]().EqAny([]int{3, 4}).Expr("n"),
+				NewField[any]().JSONHasKey("k", "a").Expr("data"),
+				NewField[map[string]int]().JSONContains(map[string]int{"b": 1}, "x").Expr("meta"),
+				NewField[string]().Search("foo", "english").Expr("doc"),
+			),
+			url.Values{
+				"age":        {"gte.1", "lte.5"},
+				"name":       {"ilike.*a*"},
+				"code":       {`like.5\%*`},
+				"tags":       {`cs.{"a","b c"}`},
+				"ids":        {"ov.{1,2}"},
+				"labels":     {`cs.{"x"}`},
+				"n":          {"in.(3,4)"},
+				"data->a->k": {"not.is.null"},
+				"meta->x":    {`cs.{"b":1}`},
+				"doc":        {"plfts(english).foo"},
+			},
+		},
+		{
+			"NotBetween",
+			NewField[int]().Not().Between(1, 5).Or().Search("q").Expr("c"),
+			url.Values{"or": {"(not.and(c.gte.1,c.lte.5),c.plfts.q)"}},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			assert.Equal(t, c.Want, PostgREST(c.In))
+		})
+	}
+}
@@ -1,10 +1,14 @@
 // Package predicate provides a simple way to build SQL predicates.
+//
+// Predicates are compiled to a dialect-independent AST, see [Expr],
+// which is rendered by the builders: [SQLBuilder] for database/sql,
+// [PostgREST] for PostgREST query strings and bunrepo.WhereExpr for bun.
 package predicate
 
 import (
 	"reflect"
 
-	"github.com/uptrace/bun" // TODO remove this dependency
+	"github.com/uptrace/bun"
 )
 
 // Op represents an operator.
@@ -16,17 +20,39 @@ type Op int
 const (
 	// Predicate operators.
 
-	opEQ      Op = iota // =
-	opNEQ               // <>
-	opGT                // >
-	opGTE               // >=
-	opLT                // <
-	opLTE               // <=
-	opIn                // IN
-	opNotIn             // NOT IN
-	opLike              // LIKE
-	opIsNull            // IS NULL
-	opNotNull           // IS NOT NULL
+	OpEQ      Op = iota // =
+	OpNEQ               // <>
+	OpGT                // >
+	OpGTE               // >=
+	OpLT                // <
+	OpLTE               // <=
+	OpIn                // IN
+	OpNotIn             // NOT IN
+	OpLike              // LIKE
+	OpIsNull            // IS NULL
+	OpNotNull           // IS NOT NULL
+
+	OpILike   // ILIKE
+	OpBetween // BETWEEN
+	// OpHasPrefix, OpHasSuffix and OpContains are LIKE with the escaped value.
+	OpHasPrefix
+	OpHasSuffix
+	OpContains
+
+	// Postgres array operators.
+
+	OpArrayContains // @>
+	OpArrayOverlap  // &&
+	OpArrayHas      // value = ANY(column)
+	OpEqAny         // column = ANY(values)
+
+	// Postgres JSONB operators, the column is extracted by the path if any.
+
+	OpJSONHasKey   // ?
+	OpJSONContains // @>
+
+	// OpSearch is `to_tsvector(column) @@ plainto_tsquery(value)`.
+	OpSearch
 )
 
 func (o Op) String() string {
@@ -34,31 +60,72 @@ func (o Op) String() string {
 }
 
 var ops = [...]string{
-	opEQ:      "=",
-	opNEQ:     "<>",
-	opGT:      ">",
-	opGTE:     ">=",
-	opLT:      "<",
-	opLTE:     "<=",
-	opIn:      "IN",
-	opNotIn:   "NOT IN",
-	opLike:    "LIKE",
-	opIsNull:  "IS NULL",
-	opNotNull: "IS NOT NULL",
+	OpEQ:      "=",
+	OpNEQ:     "<>",
+	OpGT:      ">",
+	OpGTE:     ">=",
+	OpLT:      "<",
+	OpLTE:     "<=",
+	OpIn:      "IN",
+	OpNotIn:   "NOT IN",
+	OpLike:    "LIKE",
+	OpIsNull:  "IS NULL",
+	OpNotNull: "IS NOT NULL",
+
+	OpILike:     "ILIKE",
+	OpBetween:   "BETWEEN",
+	OpHasPrefix: "LIKE",
+	OpHasSuffix: "LIKE",
+	OpContains:  "LIKE",
+
+	OpArrayContains: "@>",
+	OpArrayOverlap:  "&&",
+	OpArrayHas:      "= ANY",
+	OpEqAny:         "= ANY",
+
+	OpJSONHasKey:   "?",
+	OpJSONContains: "@>",
+
+	OpSearch: "@@",
 }
 
 func (o Op) IsIn() bool {
 	switch o {
-	case opIn, opNotIn:
+	case OpIn, OpNotIn:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsList reports whether the operands are [Predicate.Vs] rather than [Predicate.V].
+func (o Op) IsList() bool {
+	switch o {
+	case OpIn, OpNotIn, OpBetween, OpArrayContains, OpArrayOverlap, OpEqAny:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsLike reports whether the operator matches the escaped value by LIKE.
+func (o Op) IsLike() bool {
+	switch o {
+	case OpHasPrefix, OpHasSuffix, OpContains:
 		return true
 	default:
 		return false
 	}
 }
 
+// hasArg reports whether the operand is [Predicate.Arg] rather than [Predicate.V].
+func (o Op) hasArg() bool {
+	return o == OpJSONHasKey || o == OpSearch
+}
+
 func (o Op) IsUnary() bool {
 	switch o {
-	case opIsNull, opNotNull:
+	case OpIsNull, OpNotNull:
 		return true
 	default:
 		return false
@@ -79,20 +146,34 @@ type Predicate[T any] struct {
 	Op Op
 	V  T // Value
 	Vs []T
+	// Arg is the operand which is not of type T,
+	// like the key of [OpJSONHasKey] and the query of [OpSearch].
+	Arg string
+	// Path is the JSON path of the JSONB operators.
+	Path []string
+	// Config is the text search config of [OpSearch].
+	Config string
 }
 
 func (p Predicate[T]) IsNop() bool {
-	if p.Op.IsUnary() {
+	switch {
+	case p.Op.IsUnary():
 		return false
-	}
-	if p.Op.IsIn() {
+	case p.Op == OpBetween:
+		return len(p.Vs) != 2 || isZero(p.Vs[0]) && isZero(p.Vs[1])
+	case p.Op.IsList():
 		return len(p.Vs) == 0
+	case p.Op.hasArg():
+		return p.Arg == ""
 	}
-	var v any = p.V
+	return isZero(p.V)
+}
+
+func isZero(v any) bool {
 	if a, ok := v.(interface{ IsZero() bool }); ok {
 		return a.IsZero()
 	}
-	return reflect.ValueOf(p.V).IsZero()
+	return reflect.ValueOf(v).IsZero()
 }
 
 type Token[T any] struct {
@@ -179,27 +260,27 @@ func (f *Field[T]) appendType(t TokenType) *Field[T] {
 }
 
 // EQ is `=` in SQL.
-func (f *Field[T]) EQ(v T) *Field[T] { return f.appendPred2(opEQ, v) }
+func (f *Field[T]) EQ(v T) *Field[T] { return f.appendPred2(OpEQ, v) }
 
 // NEQ is `<>` in SQL.
-func (f *Field[T]) NEQ(v T) *Field[T] { return f.appendPred2(opNEQ, v) }
+func (f *Field[T]) NEQ(v T) *Field[T] { return f.appendPred2(OpNEQ, v) }
 
 // GT is `>` in SQL.
-func (f *Field[T]) GT(v T) *Field[T] { return f.appendPred2(opGT, v) }
+func (f *Field[T]) GT(v T) *Field[T] { return f.appendPred2(OpGT, v) }
 
 // GTE is `>=` in SQL.
-func (f *Field[T]) GTE(v T) *Field[T] { return f.appendPred2(opGTE, v) }
+func (f *Field[T]) GTE(v T) *Field[T] { return f.appendPred2(OpGTE, v) }
 
 // LT is `<` in SQL.
-func (f *Field[T]) LT(v T) *Field[T] { return f.appendPred2(opLT, v) }
+func (f *Field[T]) LT(v T) *Field[T] { return f.appendPred2(OpLT, v) }
 
 // LTE is `<=` in SQL.
-func (f *Field[T]) LTE(v T) *Field[T] { return f.appendPred2(opLTE, v) }
+func (f *Field[T]) LTE(v T) *Field[T] { return f.appendPred2(OpLTE, v) }
 
 // In is `IN` in SQL.
 func (f *Field[T]) In(vs []T) *Field[T] {
 	return f.appendPred(Predicate[T]{
-		Op: opIn,
+		Op: OpIn,
 		Vs: vs,
 	})
 }
@@ -207,7 +288,7 @@ func (f *Field[T]) In(vs []T) *Field[T] {
 // NotIn is `NOT IN` in SQL.
 func (f *Field[T]) NotIn(vs []T) *Field[T] {
 	return f.appendPred(Predicate[T]{
-		Op: opNotIn,
+		Op: OpNotIn,
 		Vs: vs,
 	})
 }
@@ -215,22 +296,107 @@ func (f *Field[T]) NotIn(vs []T) *Field[T] {
 // Like is `LIKE` in SQL.
 func (f *Field[T]) Like(v T) *Field[T] {
 	return f.appendPred(Predicate[T]{
-		Op: opLike,
+		Op: OpLike,
 		V:  v,
 	})
 }
 
+// ILike is `ILIKE` in SQL, which is case-insensitive LIKE of Postgres.
+func (f *Field[T]) ILike(v T) *Field[T] { return f.appendPred2(OpILike, v) }
+
+// Between is `BETWEEN lo AND hi` in SQL, it is skipped if both are zero.
+func (f *Field[T]) Between(lo, hi T) *Field[T] {
+	return f.appendPred(Predicate[T]{
+		Op: OpBetween,
+		Vs: []T{lo, hi},
+	})
+}
+
+// HasPrefix matches the values starting with v,
+// the wildcards in v are escaped so they match literally.
+func (f *Field[T]) HasPrefix(v T) *Field[T] { return f.appendPred2(OpHasPrefix, v) }
+
+// HasSuffix matches the values ending with v, see [Field.HasPrefix].
+func (f *Field[T]) HasSuffix(v T) *Field[T] { return f.appendPred2(OpHasSuffix, v) }
+
+// Contains matches the values containing v, see [Field.HasPrefix].
+func (f *Field[T]) Contains(v T) *Field[T] { return f.appendPred2(OpContains, v) }
+
+// ArrayContains is `column @> values` of Postgres arrays,
+// i.e. the array column contains all the values.
+func (f *Field[T]) ArrayContains(vs []T) *Field[T] {
+	return f.appendPred(Predicate[T]{
+		Op: OpArrayContains,
+		Vs: vs,
+	})
+}
+
+// ArrayOverlap is `column && values` of Postgres arrays,
+// i.e. the array column contains any of the values.
+func (f *Field[T]) ArrayOverlap(vs []T) *Field[T] {
+	return f.appendPred(Predicate[T]{
+		Op: OpArrayOverlap,
+		Vs: vs,
+	})
+}
+
+// ArrayHas is `v = ANY(column)` of Postgres arrays,
+// i.e. the array column contains the value.
+func (f *Field[T]) ArrayHas(v T) *Field[T] { return f.appendPred2(OpArrayHas, v) }
+
+// EqAny is `column = ANY(values)` of Postgres, which is like [Field.In],
+// but the values are bound as one array parameter.
+func (f *Field[T]) EqAny(vs []T) *Field[T] {
+	return f.appendPred(Predicate[T]{
+		Op: OpEqAny,
+		Vs: vs,
+	})
+}
+
+// JSONHasKey is `column ? key` of Postgres JSONB,
+// the column is extracted by the path like `column #> '{a,b}'` if any.
+func (f *Field[T]) JSONHasKey(key string, path ...string) *Field[T] {
+	return f.appendPred(Predicate[T]{
+		Op:   OpJSONHasKey,
+		Arg:  key,
+		Path: path,
+	})
+}
+
+// JSONContains is `column @> v` of Postgres JSONB, v is encoded as JSON,
+// the column is extracted by the path like `column #> '{a,b}'` if any.
+func (f *Field[T]) JSONContains(v T, path ...string) *Field[T] {
+	return f.appendPred(Predicate[T]{
+		Op:   OpJSONContains,
+		V:    v,
+		Path: path,
+	})
+}
+
+// Search is the full-text search `to_tsvector(column) @@ plainto_tsquery(query)` of Postgres,
+// with the optional text search config like "english".
+func (f *Field[T]) Search(query string, config ...string) *Field[T] {
+	p := Predicate[T]{
+		Op:  OpSearch,
+		Arg: query,
+	}
+	if len(config) != 0 {
+		p.Config = config[0]
+	}
+	return f.appendPred(p)
+}
+
 // IsNull is `IS NULL` in SQL.
 func (f *Field[T]) IsNull() *Field[T] {
 	return f.appendPred(Predicate[T]{
-		Op: opIsNull,
+		Op: OpIsNull,
 	})
 }
 
 // IsNull is `IS NOT NULL` in SQL.
 func (f *Field[T]) IsNotNull() *Field[T] {
 	return f.appendPred(Predicate[T]{
-		Op: opNotNull,
+		Op: OpNotNull,
 	})
 }
 
@@ -255,63 +421,15 @@ func (f *Field[T]) Group(fn func(f *Field[T])) *Field[T] {
 	})
 }
 
+// BuildFieldBun adds the predicates on the column name to the WHERE clause of qb.
+//
+// Deprecated: Use [Field.Expr] with bunrepo.WhereExpr instead.
 func (f *Field[T]) BuildFieldBun(name string, qb bun.QueryBuilder) {
-	not, or, zero := false, false, false
-	for _, pg := range f.Tokens {
-		t, p, group := pg.Type, pg.Pred, pg.Group
-		switch t {
-		case Or:
-			or = true
-		case Not:
-			not = true
-		case Zero:
-			zero = true
-		case Pred:
-			if p.IsNop() && !zero {
-				continue
-			}
-
-			zero = false
-			var qs string
-			args := []any{bun.Ident(name)}
-			if not {
-				qs += "NOT "
-				not = false
-			}
-
-			qs += "? " + p.Op.String()
-			if !p.Op.IsUnary() {
-				if p.Op.IsIn() {
-					qs += " (?)"
-					args = append(args, bun.In(p.Vs))
-				} else {
-					qs += " ?"
-					args = append(args, p.V)
-				}
-			}
-			switch {
-			case or:
-				qb.WhereOr(qs, args...)
-				or = false
-			default:
-				qb.Where(qs, args...)
-			}
-		case Group:
-			var op string
-			if or {
-				op = " OR "
-				or = false
-			} else {
-				op = " AND "
-			}
-			if not {
-				op += "NOT "
-				not = false
-			}
-			qb.WhereGroup(op, func(qb2 bun.QueryBuilder) bun.QueryBuilder {
-				group.BuildFieldBun(name, qb2)
-				return qb2
-			})
-		}
+	e := f.Expr(name)
+	if e == nil {
+		return
 	}
+	b := SQLBuilder{identArg: func(name string) any { return bun.Ident(name) }}
+	q, args := b.Build(e)
+	qb.Where(q, args...)
 }
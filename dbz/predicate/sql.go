@@ -0,0 +1,140 @@
+package predicate
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Placeholder is the bind parameter style of database/sql drivers.
+type Placeholder int8
+
+const (
+	// Question is `?`, used by MySQL and SQLite.
+	Question Placeholder = iota
+	// Dollar is `$1`, `$2`..., used by Postgres.
+	Dollar
+)
+
+// SQLBuilder renders an [Expr] as a SQL condition for database/sql.
+//
+// Example:
+//
+//	e, _ := predicate.FromStruct(params)
+//	where, args := predicate.SQLBuilder{Placeholder: predicate.Dollar}.Build(e)
+//	rows, err := db.QueryContext(ctx, "SELECT * FROM users WHERE "+where, args...)
+type SQLBuilder struct {
+	Placeholder Placeholder
+	// Start is the number of the existing `$n` args, the first arg is `$(Start+1)`.
+	Start int
+	// Quote quotes the identifiers, default to double quotes.
+	// Columns with dots like `u.name` are quoted part by part.
+	Quote func(ident string) string
+
+	// identArg, if set, binds the identifiers as args and keeps the literal `\?` escaped
+	// for the bun queries, which quote the identifiers themselves.
+	identArg func(ident string) any
+}
+
+// Build returns the condition and its args, the condition is `1 = 1` if e is nil.
+func (b SQLBuilder) Build(e Expr) (string, []any) {
+	sb := &sqlBuilder{SQLBuilder: b, n: b.Start}
+	if b.Quote == nil {
+		sb.Quote = quoteDouble
+	}
+	if e == nil {
+		return "1 = 1", nil
+	}
+	// The top-level OR is wrapped as well, so that the condition can be joined by AND.
+	_, isOr := e.(OrExpr)
+	sb.expr(e, isOr)
+	return sb.buf.String(), sb.args
+}
+
+func quoteDouble(ident string) string {
+	return `"` + strings.ReplaceAll(ident, `"`, `""`) + `"`
+}
+
+type sqlBuilder struct {
+	SQLBuilder
+	buf  strings.Builder
+	args []any
+	n    int
+}
+
+func (b *sqlBuilder) ident(name string) {
+	if b.identArg != nil {
+		b.buf.WriteByte('?')
+		b.args = append(b.args, b.identArg(name))
+		return
+	}
+	for i, part := range strings.Split(name, ".") {
+		if i != 0 {
+			b.buf.WriteByte('.')
+		}
+		b.buf.WriteString(b.Quote(part))
+	}
+}
+
+func (b *sqlBuilder) arg(v any) {
+	b.args = append(b.args, v)
+	if b.Placeholder == Dollar {
+		b.n++
+		b.buf.WriteString("$" + strconv.Itoa(b.n))
+	} else {
+		b.buf.WriteByte('?')
+	}
+}
+
+// expr writes the expr, nested exprs are wrapped in parentheses.
+func (b *sqlBuilder) expr(e Expr, nested bool) {
+	switch e := e.(type) {
+	case Cond:
+		b.cond(e)
+	case NotExpr:
+		b.buf.WriteString("NOT ")
+		b.expr(e.X, true)
+	case AndExpr:
+		b.list([]Expr(e), " AND ", nested)
+	case OrExpr:
+		b.list([]Expr(e), " OR ", nested)
+	}
+}
+
+func (b *sqlBuilder) list(es []Expr, sep string, nested bool) {
+	if nested {
+		b.buf.WriteByte('(')
+	}
+	for i, e := range es {
+		if i != 0 {
+			b.buf.WriteString(sep)
+		}
+		b.expr(e, true)
+	}
+	if nested {
+		b.buf.WriteByte(')')
+	}
+}
+
+func (b *sqlBuilder) cond(c Cond) {
+	q, args := c.SQL()
+	for i := 0; i < len(q); i++ {
+		switch {
+		case q[i] == '\\' && i+1 < len(q) && q[i+1] == '?':
+			if b.identArg != nil {
+				b.buf.WriteByte('\\')
+			}
+			b.buf.WriteByte('?')
+			i++
+		case q[i] == '?':
+			arg := args[0]
+			args = args[1:]
+			if id, ok := arg.(Ident); ok {
+				b.ident(string(id))
+			} else {
+				b.arg(arg)
+			}
+		default:
+			b.buf.WriteByte(q[i])
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package predicate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLBuilder(t *testing.T) {
+	e := All(
+		Cond{Column: "u.id", Op: OpIn, Values: []any{1, 2}},
+		GT(1).LT(5).Or().Not().Group(func(f *Field[int]) { f.IsNull().Or().EQ(9) }).Expr("age"),
+		Cond{Column: "name", Op: OpNotIn},
+	)
+
+	q, args := SQLBuilder{Placeholder: Dollar}.Build(e)
+	assert.Equal(t, `"u"."id" IN ($1, $2) AND `+
+		`(("age" > $3 AND "age" < $4) OR NOT ("age" IS NULL OR "age" = $5)) AND 1 = 1`, q)
+	assert.Equal(t, []any{1, 2, 1, 5, 9}, args)
+
+	quote := func(s string) string { return "`" + s + "`" }
+	q, args = SQLBuilder{Quote: quote}.Build(e)
+	assert.Equal(t, "`u`.`id` IN (?, ?) AND "+
+		"((`age` > ? AND `age` < ?) OR NOT (`age` IS NULL OR `age` = ?)) AND 1 = 1", q)
+	assert.Len(t, args, 5)
+
+	q, args = SQLBuilder{Placeholder: Dollar, Start: 2}.Build(Any(
+		Cond{Column: "a", Op: OpEQ, Value: "x"},
+		Cond{Column: "b", Op: OpIn},
+	))
+	assert.Equal(t, `("a" = $3 OR 1 = 0)`, q)
+	assert.Equal(t, []any{"x"}, args)
+
+	q, args = SQLBuilder{}.Build(nil)
+	assert.Equal(t, "1 = 1", q)
+	assert.Nil(t, args)
+
+	q, _ = SQLBuilder{}.Build(Cond{Column: `we"ird`, Op: OpNotNull})
+	assert.Equal(t, `"we""ird" IS NOT NULL`, q)
+}
+
+func TestSQLBuilderOps(t *testing.T) {
+	cases := []struct {
+		Name  string
+		In    Expr
+		Want  string
+		WantA []any
+	}{
+		{"ILike", NewField[string]().ILike("a%").Expr("c"), `"c" ILIKE $1`, []any{"a%"}},
+		{"Between", NewField[int]().Between(1, 5).Expr("c"), `"c" BETWEEN $1 AND $2`, []any{1, 5}},
+		{"HasPrefix", NewField[string]().HasPrefix("50%_!").Expr("c"),
+			`"c" LIKE $1 ESCAPE '!'`, []any{"50!%!_!!%"}},
+		{"HasSuffix", NewField[string]().HasSuffix("a").Expr("c"), `"c" LIKE $1 ESCAPE '!'`, []any{"%a"}},
+		{"Contains", NewField[string]().Contains("a").Expr("c"), `"c" LIKE $1 ESCAPE '!'`, []any{"%a%"}},
+		{"ArrayContains", NewField[string]().ArrayContains([]string{"a", "b"}).Expr("c"),
+			`"c" @> $1`, []any{PGArray{"a", "b"}}},
+		{"ArrayOverlap", NewField[int]().ArrayOverlap([]int{1}).Expr("c"), `"c" && $1`, []any{PGArray{1}}},
+		{"ArrayHas", NewField[string]().ArrayHas("a").Expr("c"), `$1 = ANY("c")`, []any{"a"}},
+		{"EqAny", NewField[int]().EqAny([]int{1, 2}).Expr("c"), `"c" = ANY($1)`, []any{PGArray{1, 2}}},
+		{"JSONHasKey", NewField[any]().JSONHasKey("k").Expr("c"), `"c" ? $1`, []any{"k"}},
+		{"JSONHasKeyPath", NewField[any]().JSONHasKey("k", "a", "b").Expr("c"),
+			`("c" #> $1) ? $2`, []any{PGArray{"a", "b"}, "k"}},
+		{"JSONContains", NewField[map[string]int]().JSONContains(map[string]int{"a": 1}, "x").Expr("c"),
+			`("c" #> $1) @> $2`, []any{PGArray{"x"}, `{"a":1}`}},
+		{"Search", NewField[string]().Search("foo bar").Expr("c"),
+			`to_tsvector("c") @@ plainto_tsquery($1)`, []any{"foo bar"}},
+		{"SearchConfig", NewField[string]().Search("foo", "english").Expr("c"),
+			`to_tsvector($1::regconfig, "c") @@ plainto_tsquery($2::regconfig, $3)`,
+			[]any{"english", "english", "foo"}},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			q, args := SQLBuilder{Placeholder: Dollar}.Build(c.In)
+			assert.Equal(t, c.Want, q)
+			assert.Equal(t, c.WantA, args)
+		})
+	}
+}
+
+func TestPGArray(t *testing.T) {
+	v, err := PGArray{1, 2.5, true, nil, `a "b" \c`, time.Unix(0, 0).UTC()}.Value()
+	require.NoError(t, err)
+	assert.Equal(t, `{1,2.5,true,NULL,"a \"b\" \\c","1970-01-01T00:00:00Z"}`, v)
+
+	v, err = PGArray(nil).Value()
+	require.NoError(t, err)
+	assert.Nil(t, v)
+}
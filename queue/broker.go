@@ -0,0 +1,195 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/adobaai/pkg/middleware"
+)
+
+// ErrNacked is returned by a handler chain when the delivery was negatively acknowledged.
+var ErrNacked = errors.New("nacked")
+
+// Publisher publishes messages to a topic.
+//
+// The topic is a Redis stream in redisq and a routing key in memq.
+type Publisher interface {
+	Publish(ctx context.Context, topic string, ms ...*M) error
+}
+
+// Consumer consumes messages of the subscribed topics.
+type Consumer interface {
+	Server
+	// Subscribe registers the handler of the topic.
+	// It should be called before [Server.Start].
+	Subscribe(topic string, h Handler) error
+}
+
+// Broker is both a [Publisher] and a [Consumer].
+type Broker interface {
+	Publisher
+	Consumer
+}
+
+// Delivery is a message delivered to a [Handler].
+//
+// A delivery is acknowledged automatically when the handler returns nil
+// and is negatively acknowledged when the handler returns an error,
+// unless [Delivery.Ack] or [Delivery.Nack] has been called explicitly.
+type Delivery interface {
+	context.Context
+	WithContext(context.Context) Delivery
+	Topic() string
+	Msg() *M
+	// Ack acknowledges the message.
+	Ack()
+	// Nack negatively acknowledges the message.
+	// Whether the message is redelivered depends on the broker.
+	Nack()
+	// Acked returns whether the message is acknowledged,
+	// and false if it is not settled yet.
+	Acked() (acked bool, settled bool)
+}
+
+type Handler = middleware.Handler[Delivery]
+
+type Middleware = middleware.Middleware[Delivery]
+
+type delivery struct {
+	context.Context
+	topic string
+	m     *M
+	state *int8 // 0: unsettled, 1: acked, -1: nacked
+}
+
+// NewDelivery returns a new delivery, it is mainly used by broker implementations.
+func NewDelivery(ctx context.Context, topic string, m *M) Delivery {
+	return &delivery{
+		Context: ctx,
+		topic:   topic,
+		m:       m,
+		state:   new(int8),
+	}
+}
+
+func (d *delivery) WithContext(ctx context.Context) Delivery {
+	d2 := *d
+	d2.Context = ctx
+	return &d2
+}
+
+func (d *delivery) Topic() string {
+	return d.topic
+}
+
+func (d *delivery) Msg() *M {
+	return d.m
+}
+
+func (d *delivery) Ack() {
+	*d.state = 1
+}
+
+func (d *delivery) Nack() {
+	*d.state = -1
+}
+
+func (d *delivery) Acked() (acked bool, settled bool) {
+	return *d.state == 1, *d.state != 0
+}
+
+// Handle runs the handler and settles the delivery by the returned error,
+// it reports whether the message is acknowledged.
+func Handle(d Delivery, h Handler) (acked bool, err error) {
+	err = h(d)
+	acked, settled := d.Acked()
+	if !settled {
+		acked = err == nil
+	}
+	if !acked && err == nil {
+		err = ErrNacked
+	}
+	return acked, err
+}
+
+// Metadata keys of the messages published by [EventPub].
+const (
+	MetaEventID   = "event_id"
+	MetaEventType = "event_type"
+	MetaEntityID  = "entity_id"
+)
+
+// EventPub adapts a [Publisher] to [Pub],
+// the entity of the event is encoded as the JSON body of the message.
+type EventPub struct {
+	p     Publisher
+	topic func(Event) string
+}
+
+var _ Pub[Event] = (*EventPub)(nil)
+
+// NewEventPub returns a new [EventPub],
+// the topic func maps an event to its topic, default to the event type.
+func NewEventPub(p Publisher, topic func(Event) string) *EventPub {
+	if topic == nil {
+		topic = func(e Event) string { return string(e.Type) }
+	}
+	return &EventPub{p: p, topic: topic}
+}
+
+// Pub publishes the event.
+func (ep *EventPub) Pub(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e.Entity)
+	if err != nil {
+		return fmt.Errorf("marshal entity: %w", err)
+	}
+	m := &M{
+		ContentType:   "application/json",
+		ContentLength: len(body),
+		CreatedAt:     e.CreatedAt,
+		Metadata: Metadata{
+			MetaEventID:   e.ID,
+			MetaEventType: string(e.Type),
+			MetaEntityID:  e.EntityID,
+		},
+		Body: body,
+	}
+	return ep.p.Publish(ctx, ep.topic(e), m)
+}
+
+// ToEvent converts the message published by [EventPub] back to the event,
+// the entity is kept as [json.RawMessage].
+func ToEvent(m *M) Event {
+	var entity any
+	if len(m.Body) != 0 {
+		entity = json.RawMessage(m.Body)
+	}
+	return Event{
+		ID:        m.Metadata[MetaEventID],
+		Type:      EventType(m.Metadata[MetaEventType]),
+		EntityID:  m.Metadata[MetaEntityID],
+		Entity:    entity,
+		CreatedAt: m.CreatedAt,
+	}
+}
+
+// ErrPanicked is a sentinel error for panics.
+var ErrPanicked = errors.New("panicked")
+
+// Recover recovers the handler from panics and returns [ErrPanicked].
+func Recover(l *slog.Logger) Middleware {
+	return func(next Handler) Handler {
+		return func(d Delivery) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					l.ErrorContext(d, "recover", "topic", d.Topic(), "value", r)
+					err = ErrPanicked
+				}
+			}()
+			return next(d)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package queue
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandle(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name  string
+		h     Handler
+		acked bool
+		err   error
+	}{
+		{"Nil", func(Delivery) error { return nil }, true, nil},
+		{"Error", func(Delivery) error { return ErrFull }, false, ErrFull},
+		{"Nack", func(d Delivery) error { d.Nack(); return nil }, false, ErrNacked},
+		{"AckError", func(d Delivery) error { d.Ack(); return ErrFull }, true, ErrFull},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDelivery(ctx, "topic", &M{})
+			acked, err := Handle(d, tt.h)
+			assert.Equal(t, tt.acked, acked)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
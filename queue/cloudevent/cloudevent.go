@@ -0,0 +1,382 @@
+// Package cloudevent converts [queue.Event] and [queue.M] to and from CloudEvents 1.0,
+// so the messages can be consumed by services in other languages.
+//
+// Both the structured JSON mode and the binary mode are supported:
+//
+//   - Structured: the whole event is encoded as the JSON body of the message,
+//     with the content type [MIMEStructured].
+//   - Binary: the attributes are stored in the metadata with the [MetaPrefix] prefix,
+//     and the data is stored as the body of the message.
+//
+// See https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/spec.md
+package cloudevent
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/adobaai/pkg/queue"
+)
+
+const (
+	// SpecVersion is the supported version of the CloudEvents specification.
+	SpecVersion = "1.0"
+	// MIMEStructured is the content type of the structured mode.
+	MIMEStructured = "application/cloudevents+json"
+	// MIMEJSON is the default content type of the data.
+	MIMEJSON = "application/json"
+	// MetaPrefix is the metadata key prefix of the attributes in the binary mode,
+	// which is the same as the Kafka protocol binding.
+	MetaPrefix = "ce_"
+)
+
+// ErrInvalid is returned when the event violates the specification.
+var ErrInvalid = errors.New("cloudevent: invalid")
+
+// Event is a CloudEvents event.
+type Event struct {
+	SpecVersion     string
+	ID              string
+	Source          string
+	Type            string
+	Subject         string
+	Time            time.Time
+	DataContentType string
+	DataSchema      string
+	Data            []byte
+	Extensions      map[string]string
+}
+
+// Validate validates the required attributes and the extension names.
+func (e *Event) Validate() error {
+	var errs []error
+	if e.SpecVersion != SpecVersion {
+		errs = append(errs, fmt.Errorf("%w: unsupported specversion %q", ErrInvalid, e.SpecVersion))
+	}
+	if e.ID == "" {
+		errs = append(errs, fmt.Errorf("%w: id is required", ErrInvalid))
+	}
+	if e.Source == "" {
+		errs = append(errs, fmt.Errorf("%w: source is required", ErrInvalid))
+	}
+	if e.Type == "" {
+		errs = append(errs, fmt.Errorf("%w: type is required", ErrInvalid))
+	}
+	for k := range e.Extensions {
+		if !validName(k) {
+			errs = append(errs, fmt.Errorf("%w: extension name %q", ErrInvalid, k))
+		} else if _, ok := attrs[k]; ok {
+			errs = append(errs, fmt.Errorf("%w: extension %q is a context attribute", ErrInvalid, k))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validName reports whether the attribute name consists of lower-case letters and digits.
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := range len(name) {
+		c := name[i]
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+var attrs = map[string]struct{}{
+	"specversion":     {},
+	"id":              {},
+	"source":          {},
+	"type":            {},
+	"subject":         {},
+	"time":            {},
+	"datacontenttype": {},
+	"dataschema":      {},
+	"data":            {},
+	"data_base64":     {},
+}
+
+// FromEvent converts the queue event to a CloudEvent,
+// the entity is encoded as JSON data and the entity ID is used as the subject.
+func FromEvent(e queue.Event, source string) (*Event, error) {
+	var data []byte
+	if e.Entity != nil {
+		var err error
+		if data, err = json.Marshal(e.Entity); err != nil {
+			return nil, fmt.Errorf("marshal entity: %w", err)
+		}
+	}
+	ce := &Event{
+		SpecVersion:     SpecVersion,
+		ID:              e.ID,
+		Source:          source,
+		Type:            string(e.Type),
+		Subject:         e.EntityID,
+		Time:            e.CreatedAt,
+		DataContentType: MIMEJSON,
+		Data:            data,
+	}
+	return ce, ce.Validate()
+}
+
+// ToEvent converts the CloudEvent to a queue event,
+// the data is kept as [json.RawMessage] if it is JSON, otherwise []byte.
+func (e *Event) ToEvent() queue.Event {
+	var entity any
+	if e.Data != nil {
+		if isJSON(e.DataContentType) {
+			entity = json.RawMessage(e.Data)
+		} else {
+			entity = e.Data
+		}
+	}
+	return queue.Event{
+		ID:        e.ID,
+		Type:      queue.EventType(e.Type),
+		EntityID:  e.Subject,
+		Entity:    entity,
+		CreatedAt: e.Time,
+	}
+}
+
+// isJSON reports whether the content type is JSON, which is the default.
+func isJSON(ct string) bool {
+	ct, _, _ = strings.Cut(ct, ";")
+	ct = strings.TrimSpace(ct)
+	return ct == "" || ct == MIMEJSON || strings.HasSuffix(ct, "/json") || strings.HasSuffix(ct, "+json")
+}
+
+// ##################### Structured mode #####################
+
+type structured struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            string          `json:"time,omitempty"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	DataSchema      string          `json:"dataschema,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+	DataBase64      string          `json:"data_base64,omitempty"`
+}
+
+// MarshalJSON encodes the event in the structured JSON format.
+func (e *Event) MarshalJSON() ([]byte, error) {
+	s := structured{
+		SpecVersion:     e.SpecVersion,
+		ID:              e.ID,
+		Source:          e.Source,
+		Type:            e.Type,
+		Subject:         e.Subject,
+		DataContentType: e.DataContentType,
+		DataSchema:      e.DataSchema,
+	}
+	if !e.Time.IsZero() {
+		s.Time = e.Time.Format(time.RFC3339Nano)
+	}
+	if e.Data != nil {
+		if isJSON(e.DataContentType) && json.Valid(e.Data) {
+			s.Data = e.Data
+		} else {
+			s.DataBase64 = base64.StdEncoding.EncodeToString(e.Data)
+		}
+	}
+	if len(e.Extensions) == 0 {
+		return json.Marshal(s)
+	}
+
+	// Extensions are top-level attributes.
+	b, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]json.RawMessage{}
+	if err = json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	for k, v := range e.Extensions {
+		if m[k], err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(m)
+}
+
+// UnmarshalJSON decodes the event from the structured JSON format.
+func (e *Event) UnmarshalJSON(b []byte) (err error) {
+	var s structured
+	if err = json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	var all map[string]json.RawMessage
+	if err = json.Unmarshal(b, &all); err != nil {
+		return err
+	}
+
+	*e = Event{
+		SpecVersion:     s.SpecVersion,
+		ID:              s.ID,
+		Source:          s.Source,
+		Type:            s.Type,
+		Subject:         s.Subject,
+		DataContentType: s.DataContentType,
+		DataSchema:      s.DataSchema,
+	}
+	if s.Time != "" {
+		if e.Time, err = time.Parse(time.RFC3339Nano, s.Time); err != nil {
+			return fmt.Errorf("%w: time: %w", ErrInvalid, err)
+		}
+	}
+	switch {
+	case s.Data != nil && s.DataBase64 != "":
+		return fmt.Errorf("%w: both data and data_base64 are set", ErrInvalid)
+	case s.DataBase64 != "":
+		if e.Data, err = base64.StdEncoding.DecodeString(s.DataBase64); err != nil {
+			return fmt.Errorf("%w: data_base64: %w", ErrInvalid, err)
+		}
+	case s.Data != nil && string(s.Data) != "null":
+		e.Data = []byte(s.Data)
+		if !isJSON(e.DataContentType) {
+			// Non-JSON data is encoded as a JSON string.
+			var str string
+			if err = json.Unmarshal(s.Data, &str); err == nil {
+				e.Data = []byte(str)
+			}
+		}
+	}
+	for k, v := range all {
+		if _, ok := attrs[k]; ok {
+			continue
+		}
+		var str string
+		if err = json.Unmarshal(v, &str); err != nil {
+			// Extension values of other types are kept in the JSON form.
+			str = string(v)
+		}
+		if e.Extensions == nil {
+			e.Extensions = map[string]string{}
+		}
+		e.Extensions[k] = str
+	}
+	return nil
+}
+
+// ToStructured encodes the event as a message in the structured mode.
+func ToStructured(e *Event) (*queue.M, error) {
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(e)
+	if err != nil {
+		return nil, fmt.Errorf("marshal: %w", err)
+	}
+	return &queue.M{
+		ID:            e.ID,
+		ContentType:   MIMEStructured,
+		ContentLength: len(body),
+		CreatedAt:     e.Time,
+		Body:          body,
+	}, nil
+}
+
+// FromStructured decodes the event from a message in the structured mode.
+func FromStructured(m *queue.M) (*Event, error) {
+	e := &Event{}
+	if err := json.Unmarshal(m.Body, e); err != nil {
+		return nil, fmt.Errorf("unmarshal: %w", err)
+	}
+	return e, e.Validate()
+}
+
+// ##################### Binary mode #####################
+
+// ToBinary encodes the event as a message in the binary mode.
+func ToBinary(e *Event) (*queue.M, error) {
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	meta := queue.Metadata{
+		MetaPrefix + "specversion": e.SpecVersion,
+		MetaPrefix + "id":          e.ID,
+		MetaPrefix + "source":      e.Source,
+		MetaPrefix + "type":        e.Type,
+	}
+	set := func(k, v string) {
+		if v != "" {
+			meta[MetaPrefix+k] = v
+		}
+	}
+	set("subject", e.Subject)
+	set("dataschema", e.DataSchema)
+	if !e.Time.IsZero() {
+		set("time", e.Time.Format(time.RFC3339Nano))
+	}
+	for k, v := range e.Extensions {
+		set(k, v)
+	}
+	return &queue.M{
+		ID:            e.ID,
+		ContentType:   e.DataContentType,
+		ContentLength: len(e.Data),
+		CreatedAt:     e.Time,
+		Metadata:      meta,
+		Body:          e.Data,
+	}, nil
+}
+
+// FromBinary decodes the event from a message in the binary mode.
+func FromBinary(m *queue.M) (*Event, error) {
+	e := &Event{
+		DataContentType: m.ContentType,
+		Data:            m.Body,
+	}
+	for k, v := range m.Metadata {
+		name, ok := strings.CutPrefix(k, MetaPrefix)
+		if !ok {
+			continue
+		}
+		switch name {
+		case "specversion":
+			e.SpecVersion = v
+		case "id":
+			e.ID = v
+		case "source":
+			e.Source = v
+		case "type":
+			e.Type = v
+		case "subject":
+			e.Subject = v
+		case "dataschema":
+			e.DataSchema = v
+		case "time":
+			t, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				return nil, fmt.Errorf("%w: time: %w", ErrInvalid, err)
+			}
+			e.Time = t
+		default:
+			if e.Extensions == nil {
+				e.Extensions = map[string]string{}
+			}
+			e.Extensions[name] = v
+		}
+	}
+	return e, e.Validate()
+}
+
+// FromM decodes the event from a message in either mode.
+func FromM(m *queue.M) (*Event, error) {
+	ct, _, _ := strings.Cut(m.ContentType, ";")
+	if strings.TrimSpace(ct) == MIMEStructured {
+		return FromStructured(m)
+	}
+	return FromBinary(m)
+}
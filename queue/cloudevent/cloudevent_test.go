@@ -0,0 +1,121 @@
+package cloudevent
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/adobaai/pkg/queue"
+	"github.com/adobaai/pkg/testingz"
+)
+
+type Order struct {
+	ID     string `json:"id"`
+	Amount int    `json:"amount"`
+}
+
+func newEvent() queue.Event {
+	return queue.Event{
+		ID:        "e1",
+		Type:      "com.example.order.created",
+		EntityID:  "o1",
+		Entity:    Order{"o1", 10},
+		CreatedAt: time.Date(2024, 11, 11, 14, 0, 9, 0, time.UTC),
+	}
+}
+
+func TestValidate(t *testing.T) {
+	e := &Event{}
+	err := e.Validate()
+	require.ErrorIs(t, err, ErrInvalid)
+	assert.ErrorContains(t, err, "specversion")
+	assert.ErrorContains(t, err, "id is required")
+	assert.ErrorContains(t, err, "source is required")
+	assert.ErrorContains(t, err, "type is required")
+
+	e = &Event{SpecVersion: SpecVersion, ID: "1", Source: "/s", Type: "t"}
+	require.NoError(t, e.Validate())
+	e.Extensions = map[string]string{"Trace-ID": "x"}
+	require.ErrorIs(t, e.Validate(), ErrInvalid)
+	e.Extensions = map[string]string{"subject": "x"}
+	require.ErrorIs(t, e.Validate(), ErrInvalid)
+
+	testingz.R(FromEvent(queue.Event{ID: "1"}, "/orders")).ErrorIs(t, ErrInvalid)
+}
+
+func TestStructured(t *testing.T) {
+	ce := testingz.R(FromEvent(newEvent(), "/orders")).NoError(t).V()
+	ce.Extensions = map[string]string{"traceparent": "00-abc-01"}
+
+	m := testingz.R(ToStructured(ce)).NoError(t).V()
+	assert.Equal(t, MIMEStructured, m.ContentType)
+	assert.JSONEq(t, `{
+		"specversion": "1.0",
+		"id": "e1",
+		"source": "/orders",
+		"type": "com.example.order.created",
+		"subject": "o1",
+		"time": "2024-11-11T14:00:09Z",
+		"datacontenttype": "application/json",
+		"data": {"id": "o1", "amount": 10},
+		"traceparent": "00-abc-01"
+	}`, string(m.Body))
+
+	got := testingz.R(FromM(m)).NoError(t).V()
+	assert.Equal(t, ce, got)
+
+	e := got.ToEvent()
+	want := newEvent()
+	want.Entity = json.RawMessage(`{"id":"o1","amount":10}`)
+	assert.Equal(t, want, e)
+
+	t.Run("Base64", func(t *testing.T) {
+		ce := &Event{
+			SpecVersion:     SpecVersion,
+			ID:              "e2",
+			Source:          "/files",
+			Type:            "file.uploaded",
+			DataContentType: "application/octet-stream",
+			Data:            []byte{0, 1, 2},
+		}
+		m := testingz.R(ToStructured(ce)).NoError(t).V()
+		assert.Contains(t, string(m.Body), `"data_base64":"AAEC"`)
+		testingz.R(FromStructured(m)).NoError(t).Equal(ce)
+		assert.Equal(t, []byte{0, 1, 2}, ce.ToEvent().Entity)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		m := &queue.M{ContentType: MIMEStructured, Body: []byte(`{"specversion":"1.0","id":"1"}`)}
+		testingz.R(FromM(m)).ErrorIs(t, ErrInvalid)
+
+		m.Body = []byte(`{"specversion":"1.0","id":"1","source":"/s","type":"t","time":"now"}`)
+		testingz.R(FromM(m)).ErrorIs(t, ErrInvalid)
+	})
+}
+
+func TestBinary(t *testing.T) {
+	ce := testingz.R(FromEvent(newEvent(), "/orders")).NoError(t).V()
+	ce.Extensions = map[string]string{"partitionkey": "o1"}
+
+	m := testingz.R(ToBinary(ce)).NoError(t).V()
+	assert.Equal(t, MIMEJSON, m.ContentType)
+	assert.JSONEq(t, `{"id":"o1","amount":10}`, string(m.Body))
+	assert.Equal(t, queue.Metadata{
+		"ce_specversion":  "1.0",
+		"ce_id":           "e1",
+		"ce_source":       "/orders",
+		"ce_type":         "com.example.order.created",
+		"ce_subject":      "o1",
+		"ce_time":         "2024-11-11T14:00:09Z",
+		"ce_partitionkey": "o1",
+	}, m.Metadata)
+
+	got := testingz.R(FromM(m)).NoError(t).V()
+	assert.Equal(t, ce, got)
+
+	delete(m.Metadata, "ce_source")
+	testingz.R(FromBinary(m)).ErrorIs(t, ErrInvalid)
+}
@@ -0,0 +1,288 @@
+// Package eventbus provides a typed event bus on top of [queue.Publisher] and [queue.Consumer].
+//
+// Every [queue.EventType] is registered with its Go payload type and an optional [Schema]
+// in an [EventRegistry], then:
+//
+//   - Payloads are validated before publishing, so invalid events never reach the queue.
+//   - Payloads are decoded into the registered type when received.
+//   - Handlers are typed, see [On].
+//
+// Example:
+//
+//	reg := eventbus.NewEventRegistry()
+//	eventbus.MustRegister[OrderCreated](reg, "order.created")
+//	bus := eventbus.New(reg, broker, broker)
+//	eventbus.On(bus, func(ctx context.Context, e queue.Event, oc OrderCreated) error {
+//		return nil
+//	})
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/adobaai/pkg/queue"
+)
+
+var (
+	// ErrUnregistered is returned when the event type is not registered.
+	ErrUnregistered = errors.New("eventbus: unregistered event type")
+	// ErrInvalid is returned when the payload is invalid.
+	ErrInvalid = errors.New("eventbus: invalid payload")
+)
+
+type entry struct {
+	typ    reflect.Type
+	schema Schema
+}
+
+// EventRegistry maps event types to their payload types and schemas.
+type EventRegistry struct {
+	mu      sync.RWMutex
+	entries map[queue.EventType]entry
+	types   map[reflect.Type]queue.EventType
+}
+
+// NewEventRegistry returns an empty registry.
+func NewEventRegistry() *EventRegistry {
+	return &EventRegistry{
+		entries: make(map[queue.EventType]entry),
+		types:   make(map[reflect.Type]queue.EventType),
+	}
+}
+
+// Register registers the event type with the payload type T and an optional schema.
+//
+// A payload type can only be registered with one event type,
+// so that [On] can find the event type by the payload type.
+func Register[T any](r *EventRegistry, et queue.EventType, schema ...Schema) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	typ := reflect.TypeFor[T]()
+	if _, ok := r.entries[et]; ok {
+		return fmt.Errorf("eventbus: event type %q is already registered", et)
+	}
+	if et2, ok := r.types[typ]; ok {
+		return fmt.Errorf("eventbus: type %v is already registered as %q", typ, et2)
+	}
+
+	e := entry{typ: typ}
+	if len(schema) != 0 {
+		e.schema = schema[0]
+	}
+	r.entries[et] = e
+	r.types[typ] = et
+	return nil
+}
+
+// MustRegister is like [Register] but panics if an error occurs.
+func MustRegister[T any](r *EventRegistry, et queue.EventType, schema ...Schema) {
+	if err := Register[T](r, et, schema...); err != nil {
+		panic(err)
+	}
+}
+
+func (r *EventRegistry) get(et queue.EventType) (entry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, ok := r.entries[et]
+	if !ok {
+		return e, fmt.Errorf("%w: %q", ErrUnregistered, et)
+	}
+	return e, nil
+}
+
+// TypeOf returns the event type registered with the payload type T.
+func TypeOf[T any](r *EventRegistry) (queue.EventType, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	typ := reflect.TypeFor[T]()
+	et, ok := r.types[typ]
+	if !ok {
+		return "", fmt.Errorf("%w: type %v", ErrUnregistered, typ)
+	}
+	return et, nil
+}
+
+// Validate validates the entity of the event,
+// it should be the registered payload type, a pointer to it or [json.RawMessage].
+func (r *EventRegistry) Validate(e queue.Event) error {
+	en, err := r.get(e.Type)
+	if err != nil {
+		return err
+	}
+
+	var raw []byte
+	switch v := e.Entity.(type) {
+	case json.RawMessage:
+		raw = v
+	default:
+		typ := reflect.TypeOf(e.Entity)
+		if typ != en.typ && !(typ != nil && typ.Kind() == reflect.Pointer && typ.Elem() == en.typ) {
+			return fmt.Errorf("%w: %q expects %v, got %v", ErrInvalid, e.Type, en.typ, typ)
+		}
+		if en.schema == nil {
+			return nil
+		}
+		if raw, err = json.Marshal(e.Entity); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalid, err)
+		}
+	}
+	return r.validateRaw(e.Type, en, raw)
+}
+
+func (r *EventRegistry) validateRaw(et queue.EventType, en entry, raw []byte) error {
+	if en.schema == nil {
+		if len(raw) != 0 && !json.Valid(raw) {
+			return fmt.Errorf("%w: %q: malformed JSON", ErrInvalid, et)
+		}
+		return nil
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return fmt.Errorf("%w: %q: %w", ErrInvalid, et, err)
+	}
+	if err := en.schema.Validate(v); err != nil {
+		return fmt.Errorf("%w: %q: %w", ErrInvalid, et, err)
+	}
+	return nil
+}
+
+// Decode validates the raw payload and decodes it into the registered type,
+// the returned value is of the registered type rather than a pointer.
+func (r *EventRegistry) Decode(et queue.EventType, raw []byte) (any, error) {
+	en, err := r.get(et)
+	if err != nil {
+		return nil, err
+	}
+	if err = r.validateRaw(et, en, raw); err != nil {
+		return nil, err
+	}
+	ptr := reflect.New(en.typ)
+	if err = json.Unmarshal(raw, ptr.Interface()); err != nil {
+		return nil, fmt.Errorf("%w: %q: %w", ErrInvalid, et, err)
+	}
+	return ptr.Elem().Interface(), nil
+}
+
+// Bus publishes and consumes registered events.
+type Bus struct {
+	reg   *EventRegistry
+	pub   *queue.EventPub
+	con   queue.Consumer
+	topic func(queue.EventType) string
+
+	mu       sync.Mutex
+	handlers map[queue.EventType][]func(context.Context, queue.Event) error
+	topics   map[string]bool
+}
+
+var _ queue.Pub[queue.Event] = (*Bus)(nil)
+
+// Option is the option of [New].
+type Option func(b *Bus)
+
+// WithTopic sets the topic func, the default topic is the event type.
+func WithTopic(f func(queue.EventType) string) Option {
+	return func(b *Bus) {
+		b.topic = f
+	}
+}
+
+// New returns a bus. The consumer can be nil if the bus is only used for publishing.
+func New(reg *EventRegistry, pub queue.Publisher, con queue.Consumer, opts ...Option) *Bus {
+	b := &Bus{
+		reg:      reg,
+		con:      con,
+		topic:    func(et queue.EventType) string { return string(et) },
+		handlers: make(map[queue.EventType][]func(context.Context, queue.Event) error),
+		topics:   make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	b.pub = queue.NewEventPub(pub, func(e queue.Event) string { return b.topic(e.Type) })
+	return b
+}
+
+// Pub validates and publishes the event.
+func (b *Bus) Pub(ctx context.Context, e queue.Event) error {
+	if err := b.reg.Validate(e); err != nil {
+		return err
+	}
+	return b.pub.Pub(ctx, e)
+}
+
+// Handler handles the event with the typed payload,
+// the entity of the event is the payload as well.
+type Handler[T any] func(ctx context.Context, e queue.Event, payload T) error
+
+// On registers the typed handler for the event type registered with T.
+// It should be called before the consumer starts.
+//
+// The bus subscribes each topic once, and dispatches the events by their types,
+// so the event types mapped to the same topic by [WithTopic] share the subscription.
+//
+// The handlers of an event type run in the order of registration, and all of them
+// run even if some fail. The delivery fails if any handler fails, and the redelivered
+// event runs all the handlers again, including the succeeded ones,
+// so the handlers must be idempotent.
+func On[T any](b *Bus, h Handler[T]) error {
+	et, err := TypeOf[T](b.reg)
+	if err != nil {
+		return err
+	}
+	return b.on(et, func(ctx context.Context, e queue.Event) error {
+		return h(ctx, e, e.Entity.(T))
+	})
+}
+
+func (b *Bus) on(et queue.EventType, h func(context.Context, queue.Event) error) error {
+	if b.con == nil {
+		return errors.New("eventbus: no consumer")
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// The event types of a topic share one subscription,
+	// otherwise they compete for the messages of a consumer group.
+	if topic := b.topic(et); !b.topics[topic] {
+		if err := b.con.Subscribe(topic, b.dispatch); err != nil {
+			return err
+		}
+		b.topics[topic] = true
+	}
+	b.handlers[et] = append(b.handlers[et], h)
+	return nil
+}
+
+// dispatch dispatches the delivery to the handlers of its event type,
+// and fails if any of them fails, see [On].
+func (b *Bus) dispatch(d queue.Delivery) error {
+	e := queue.ToEvent(d.Msg())
+	b.mu.Lock()
+	hs := b.handlers[e.Type]
+	b.mu.Unlock()
+	if len(hs) == 0 {
+		// Other events of the same topic.
+		return nil
+	}
+
+	raw, _ := e.Entity.(json.RawMessage)
+	payload, err := b.reg.Decode(e.Type, raw)
+	if err != nil {
+		return err
+	}
+	e.Entity = payload
+
+	var errs []error
+	for _, h := range hs {
+		errs = append(errs, h(d, e))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,168 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/adobaai/pkg/queue"
+	"github.com/adobaai/pkg/queue/memq"
+)
+
+type OrderCreated struct {
+	ID     string `json:"id"`
+	Amount int    `json:"amount"`
+}
+
+type OrderPaid struct {
+	ID string `json:"id"`
+}
+
+var orderSchema = MustParseJSONSchema(`{
+	"type": "object",
+	"required": ["id", "amount"],
+	"properties": {
+		"id": {"type": "string", "minLength": 1},
+		"amount": {"type": "integer", "minimum": 1}
+	}
+}`)
+
+func newRegistry(t *testing.T) *EventRegistry {
+	reg := NewEventRegistry()
+	require.NoError(t, Register[OrderCreated](reg, "order.created", orderSchema))
+	require.NoError(t, Register[OrderPaid](reg, "order.paid"))
+	return reg
+}
+
+func TestRegistry(t *testing.T) {
+	reg := newRegistry(t)
+	require.Error(t, Register[OrderCreated](reg, "order.updated"))
+	require.Error(t, Register[struct{}](reg, "order.created"))
+
+	et, err := TypeOf[OrderPaid](reg)
+	require.NoError(t, err)
+	assert.Equal(t, queue.EventType("order.paid"), et)
+	_, err = TypeOf[string](reg)
+	require.ErrorIs(t, err, ErrUnregistered)
+
+	require.NoError(t, reg.Validate(queue.Event{Type: "order.created", Entity: OrderCreated{"o1", 1}}))
+	require.NoError(t, reg.Validate(queue.Event{Type: "order.created", Entity: &OrderCreated{"o1", 1}}))
+	require.NoError(t, reg.Validate(queue.Event{Type: "order.paid", Entity: json.RawMessage(`{"id":"o1"}`)}))
+	require.ErrorIs(t, reg.Validate(queue.Event{Type: "order.deleted"}), ErrUnregistered)
+	require.ErrorIs(t, reg.Validate(queue.Event{Type: "order.created", Entity: OrderPaid{"o1"}}), ErrInvalid)
+
+	err = reg.Validate(queue.Event{Type: "order.created", Entity: OrderCreated{"", 0}})
+	require.ErrorIs(t, err, ErrInvalid)
+	assert.ErrorContains(t, err, "$.id: length 0 is less than 1")
+	assert.ErrorContains(t, err, "$.amount: 0 is less than 1")
+
+	v, err := reg.Decode("order.created", []byte(`{"id":"o1","amount":10}`))
+	require.NoError(t, err)
+	assert.Equal(t, OrderCreated{"o1", 10}, v)
+	_, err = reg.Decode("order.created", []byte(`{"id":"o1"}`))
+	require.ErrorIs(t, err, ErrInvalid)
+	_, err = reg.Decode("order.paid", []byte(`{"id":1}`))
+	require.ErrorIs(t, err, ErrInvalid)
+}
+
+func TestBus(t *testing.T) {
+	ctx := context.Background()
+	broker := memq.NewBroker()
+	bus := New(newRegistry(t), broker, broker, WithTopic(func(queue.EventType) string { return "orders" }))
+
+	var (
+		mu      sync.Mutex
+		created []OrderCreated
+		paid    []string
+	)
+	require.NoError(t, On(bus, func(ctx context.Context, e queue.Event, oc OrderCreated) error {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, oc, e.Entity)
+		created = append(created, oc)
+		return nil
+	}))
+	require.NoError(t, On(bus, func(ctx context.Context, e queue.Event, op OrderPaid) error {
+		mu.Lock()
+		defer mu.Unlock()
+		paid = append(paid, e.ID+":"+op.ID)
+		return nil
+	}))
+	require.NoError(t, On(bus, func(ctx context.Context, e queue.Event, op OrderPaid) error {
+		mu.Lock()
+		defer mu.Unlock()
+		paid = append(paid, "again")
+		return errors.New("oops")
+	}))
+	require.ErrorIs(t, On(bus, func(context.Context, queue.Event, int) error { return nil }), ErrUnregistered)
+
+	exit := make(chan struct{})
+	go func() {
+		assert.NoError(t, broker.Start(ctx))
+		close(exit)
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	require.NoError(t, bus.Pub(ctx, queue.Event{ID: "e1", Type: "order.created", Entity: OrderCreated{"o1", 10}}))
+	require.NoError(t, bus.Pub(ctx, queue.Event{ID: "e2", Type: "order.paid", Entity: OrderPaid{"o1"}}))
+	require.ErrorIs(t, bus.Pub(ctx, queue.Event{ID: "e3", Type: "order.created", Entity: OrderCreated{"o2", 0}}), ErrInvalid)
+	require.ErrorIs(t, bus.Pub(ctx, queue.Event{ID: "e4", Type: "order.deleted"}), ErrUnregistered)
+	// Invalid messages from other publishers are rejected by the consumer.
+	require.NoError(t, broker.Publish(ctx, "orders", &queue.M{
+		Metadata: queue.Metadata{queue.MetaEventType: "order.created"},
+		Body:     []byte(`{"id":"o3"}`),
+	}))
+	time.Sleep(50 * time.Millisecond)
+
+	require.NoError(t, broker.Stop(ctx))
+	<-exit
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []OrderCreated{{"o1", 10}}, created)
+	assert.Equal(t, []string{"e2:o1", "again"}, paid)
+}
+
+// subscriber records the handlers of the topics.
+type subscriber struct {
+	queue.Consumer
+	handlers map[string][]queue.Handler
+}
+
+func (s *subscriber) Subscribe(topic string, h queue.Handler) error {
+	s.handlers[topic] = append(s.handlers[topic], h)
+	return nil
+}
+
+func TestBusSharedTopic(t *testing.T) {
+	ctx := context.Background()
+	con := &subscriber{handlers: map[string][]queue.Handler{}}
+	bus := New(newRegistry(t), nil, con, WithTopic(func(queue.EventType) string { return "orders" }))
+
+	var got []any
+	require.NoError(t, On(bus, func(ctx context.Context, e queue.Event, oc OrderCreated) error {
+		got = append(got, oc)
+		return nil
+	}))
+	require.NoError(t, On(bus, func(ctx context.Context, e queue.Event, op OrderPaid) error {
+		got = append(got, op)
+		return nil
+	}))
+	require.Len(t, con.handlers["orders"], 1, "the topic is subscribed once")
+
+	h := con.handlers["orders"][0]
+	for _, m := range []*queue.M{
+		{Metadata: queue.Metadata{queue.MetaEventType: "order.created"}, Body: []byte(`{"id":"o1","amount":1}`)},
+		{Metadata: queue.Metadata{queue.MetaEventType: "order.paid"}, Body: []byte(`{"id":"o1"}`)},
+		{Metadata: queue.Metadata{queue.MetaEventType: "order.shipped"}, Body: []byte(`{}`)},
+	} {
+		require.NoError(t, h(queue.NewDelivery(ctx, "orders", m)))
+	}
+	assert.Equal(t, []any{OrderCreated{"o1", 1}, OrderPaid{"o1"}}, got)
+}
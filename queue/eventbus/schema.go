@@ -0,0 +1,230 @@
+package eventbus
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"sync"
+	"unicode/utf8"
+)
+
+// Schema validates the JSON form of a payload.
+//
+// The value passed to Validate is decoded by [json.Unmarshal] into an any,
+// so it is one of nil, bool, float64, string, []any and map[string]any.
+type Schema interface {
+	Validate(v any) error
+}
+
+// SchemaFunc is a function implementing [Schema].
+type SchemaFunc func(v any) error
+
+func (f SchemaFunc) Validate(v any) error {
+	return f(v)
+}
+
+// JSONSchema is a subset of JSON Schema, which supports the keywords:
+// type, enum, const, properties, required, additionalProperties, items,
+// minimum, maximum, minLength, maxLength, pattern, minItems and maxItems.
+//
+// The schemas can be built as literals too, whose patterns are compiled on the first validation.
+//
+// See https://json-schema.org/draft/2020-12/json-schema-validation
+type JSONSchema struct {
+	Type                 typeList               `json:"type,omitempty"`
+	Enum                 []any                  `json:"enum,omitempty"`
+	Const                any                    `json:"const,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *bool                  `json:"additionalProperties,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Maximum              *float64               `json:"maximum,omitempty"`
+	MinLength            *int                   `json:"minLength,omitempty"`
+	MaxLength            *int                   `json:"maxLength,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	MinItems             *int                   `json:"minItems,omitempty"`
+	MaxItems             *int                   `json:"maxItems,omitempty"`
+
+	patternOnce sync.Once
+	pattern     *regexp.Regexp
+	patternErr  error
+}
+
+// typeList is the `type` keyword, which is either a string or an array of strings.
+type typeList []string
+
+func (tl *typeList) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*tl = typeList{s}
+		return nil
+	}
+	var ss []string
+	if err := json.Unmarshal(b, &ss); err != nil {
+		return err
+	}
+	*tl = ss
+	return nil
+}
+
+// ParseJSONSchema parses a JSON Schema document.
+func ParseJSONSchema(b []byte) (*JSONSchema, error) {
+	s := &JSONSchema{}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("unmarshal: %w", err)
+	}
+	if err := s.compile(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// MustParseJSONSchema is like [ParseJSONSchema] but panics if the document is invalid.
+func MustParseJSONSchema(s string) *JSONSchema {
+	res, err := ParseJSONSchema([]byte(s))
+	if err != nil {
+		panic("eventbus: " + err.Error())
+	}
+	return res
+}
+
+func (s *JSONSchema) compile() (err error) {
+	if _, err = s.regexp(); err != nil {
+		return err
+	}
+	for _, p := range s.Properties {
+		if err = p.compile(); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		return s.Items.compile()
+	}
+	return nil
+}
+
+// regexp returns the compiled pattern, which is nil if there is no pattern.
+func (s *JSONSchema) regexp() (*regexp.Regexp, error) {
+	s.patternOnce.Do(func() {
+		if s.Pattern == "" {
+			return
+		}
+		if s.pattern, s.patternErr = regexp.Compile(s.Pattern); s.patternErr != nil {
+			s.patternErr = fmt.Errorf("pattern: %w", s.patternErr)
+		}
+	})
+	return s.pattern, s.patternErr
+}
+
+// Validate validates the value against the schema.
+func (s *JSONSchema) Validate(v any) error {
+	return s.validate("$", v)
+}
+
+func (s *JSONSchema) validate(path string, v any) error {
+	fail := func(format string, args ...any) error {
+		return fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...))
+	}
+
+	if len(s.Type) != 0 && !slices.ContainsFunc(s.Type, func(t string) bool { return isType(v, t) }) {
+		return fail("expected type %v, got %s", []string(s.Type), typeOf(v))
+	}
+	if s.Enum != nil && !slices.ContainsFunc(s.Enum, func(e any) bool { return equal(e, v) }) {
+		return fail("value %v is not one of %v", v, s.Enum)
+	}
+	if s.Const != nil && !equal(s.Const, v) {
+		return fail("value %v is not %v", v, s.Const)
+	}
+
+	var errs []error
+	switch v := v.(type) {
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			errs = append(errs, fail("%v is less than %v", v, *s.Minimum))
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			errs = append(errs, fail("%v is greater than %v", v, *s.Maximum))
+		}
+	case string:
+		n := utf8.RuneCountInString(v)
+		if s.MinLength != nil && n < *s.MinLength {
+			errs = append(errs, fail("length %d is less than %d", n, *s.MinLength))
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			errs = append(errs, fail("length %d is greater than %d", n, *s.MaxLength))
+		}
+		if re, err := s.regexp(); err != nil {
+			errs = append(errs, fail("%v", err))
+		} else if re != nil && !re.MatchString(v) {
+			errs = append(errs, fail("%q does not match %q", v, s.Pattern))
+		}
+	case []any:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			errs = append(errs, fail("%d items are less than %d", len(v), *s.MinItems))
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			errs = append(errs, fail("%d items are more than %d", len(v), *s.MaxItems))
+		}
+		if s.Items != nil {
+			for i, it := range v {
+				errs = append(errs, s.Items.validate(fmt.Sprintf("%s[%d]", path, i), it))
+			}
+		}
+	case map[string]any:
+		for _, k := range s.Required {
+			if _, ok := v[k]; !ok {
+				errs = append(errs, fail("missing required property %q", k))
+			}
+		}
+		for k, it := range v {
+			p, ok := s.Properties[k]
+			switch {
+			case ok:
+				errs = append(errs, p.validate(path+"."+k, it))
+			case s.AdditionalProperties != nil && !*s.AdditionalProperties:
+				errs = append(errs, fail("additional property %q is not allowed", k))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func isType(v any, t string) bool {
+	switch t {
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	default:
+		return typeOf(v) == t
+	}
+}
+
+func typeOf(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// equal compares JSON values.
+func equal(a, b any) bool {
+	ab, err1 := json.Marshal(a)
+	bb, err2 := json.Marshal(b)
+	return err1 == nil && err2 == nil && string(ab) == string(bb)
+}
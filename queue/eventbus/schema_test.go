@@ -0,0 +1,78 @@
+package eventbus
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONSchema(t *testing.T) {
+	s := MustParseJSONSchema(`{
+		"type": "object",
+		"required": ["name"],
+		"additionalProperties": false,
+		"properties": {
+			"name": {"type": "string", "pattern": "^[a-z]+$", "maxLength": 5},
+			"kind": {"enum": ["a", "b"]},
+			"version": {"const": 1},
+			"note": {"type": ["string", "null"]},
+			"tags": {"type": "array", "minItems": 1, "maxItems": 2, "items": {"type": "string"}},
+			"score": {"type": "number", "maximum": 1.5}
+		}
+	}`)
+
+	cases := []struct {
+		Name string
+		In   string
+		Errs []string
+	}{
+		{"OK", `{"name":"abc","kind":"a","version":1,"note":null,"tags":["x"],"score":1.5}`, nil},
+		{"Type", `[]`, []string{"$: expected type [object], got array"}},
+		{"Required", `{}`, []string{`$: missing required property "name"`}},
+		{"Additional", `{"name":"a","age":1}`, []string{`$: additional property "age" is not allowed`}},
+		{"String", `{"name":"Abcdef"}`, []string{"$.name: length 6 is greater than 5", `$.name: "Abcdef" does not match`}},
+		{"Enum", `{"name":"a","kind":"c"}`, []string{"$.kind: value c is not one of [a b]"}},
+		{"Const", `{"name":"a","version":2}`, []string{"$.version: value 2 is not 1"}},
+		{"Union", `{"name":"a","note":1}`, []string{"$.note: expected type [string null], got number"}},
+		{"Array", `{"name":"a","tags":[]}`, []string{"$.tags: 0 items are less than 1"}},
+		{"Items", `{"name":"a","tags":["x",1,2]}`, []string{"$.tags: 3 items are more than 2", "$.tags[1]: expected type", "$.tags[2]: expected type"}},
+		{"Number", `{"name":"a","score":2}`, []string{"$.score: 2 is greater than 1.5"}},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			var v any
+			require.NoError(t, json.Unmarshal([]byte(c.In), &v))
+			err := s.Validate(v)
+			if c.Errs == nil {
+				require.NoError(t, err)
+				return
+			}
+			for _, e := range c.Errs {
+				assert.ErrorContains(t, err, e)
+			}
+		})
+	}
+
+	t.Run("Integer", func(t *testing.T) {
+		s := MustParseJSONSchema(`{"type":"integer"}`)
+		require.NoError(t, s.Validate(1.0))
+		require.Error(t, s.Validate(1.5))
+	})
+
+	t.Run("Literal", func(t *testing.T) {
+		s := &JSONSchema{Properties: map[string]*JSONSchema{"name": {Pattern: "^[a-z]+$"}}}
+		require.NoError(t, s.Validate(map[string]any{"name": "abc"}))
+		require.ErrorContains(t, s.Validate(map[string]any{"name": "ABC"}), `$.name: "ABC" does not match`)
+		require.ErrorContains(t, (&JSONSchema{Pattern: "("}).Validate("a"), "$: pattern: error parsing regexp")
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := ParseJSONSchema([]byte(`{"pattern":"("}`))
+		require.Error(t, err)
+		_, err = ParseJSONSchema([]byte(`{"type":1}`))
+		require.Error(t, err)
+		assert.Panics(t, func() { MustParseJSONSchema("{") })
+	})
+}
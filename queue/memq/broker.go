@@ -0,0 +1,162 @@
+package memq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/adobaai/pkg/middleware"
+	"github.com/adobaai/pkg/queue"
+)
+
+type envelope struct {
+	topic string
+	m     *queue.M
+}
+
+func getTopic(e envelope) string {
+	return e.topic
+}
+
+type subscription struct {
+	topic   string
+	handler queue.Handler
+}
+
+// Broker is an in-memory implementation of [queue.Broker].
+//
+// Messages are delivered at most once: a nacked message is logged and dropped.
+type Broker struct {
+	ps     queue.PubSub[string, envelope]
+	logger *slog.Logger
+	mws    []queue.Middleware
+
+	mu     sync.Mutex
+	subs   []subscription
+	cancel context.CancelFunc
+}
+
+var _ queue.Broker = (*Broker)(nil)
+
+// BrokerOption is the option of [NewBroker].
+type BrokerOption func(b *Broker)
+
+// WithBrokerMiddlewares adds middlewares to the handlers of the broker.
+func WithBrokerMiddlewares(mws ...queue.Middleware) BrokerOption {
+	return func(b *Broker) {
+		b.mws = append(b.mws, mws...)
+	}
+}
+
+// WithPubSubOptions sets the options of the underlying [NewPubSub].
+func WithPubSubOptions(opts ...Option) BrokerOption {
+	return func(b *Broker) {
+		no := newOption{logger: b.logger}
+		for _, opt := range opts {
+			opt(&no)
+		}
+		b.logger = no.logger
+		b.ps = NewPubSub(getTopic, opts...)
+	}
+}
+
+// NewBroker returns an in-memory broker, which is handy in tests.
+func NewBroker(opts ...BrokerOption) *Broker {
+	b := &Broker{
+		logger: slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.ps == nil {
+		b.ps = NewPubSub(getTopic)
+	}
+	return b
+}
+
+// Publish publishes messages to the topic.
+func (b *Broker) Publish(ctx context.Context, topic string, ms ...*queue.M) error {
+	for _, m := range ms {
+		if err := b.ps.Pub(ctx, envelope{topic: topic, m: m}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Subscribe registers the handler of the topic.
+func (b *Broker) Subscribe(topic string, h queue.Handler) error {
+	if h == nil {
+		return errors.New("memq: no handler provided")
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs = append(b.subs, subscription{topic: topic, handler: h})
+	return nil
+}
+
+// Start subscribes the registered topics and dispatches messages until the context is done
+// or the broker is stopped.
+func (b *Broker) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	b.mu.Lock()
+	subs := b.subs
+	b.cancel = cancel
+	b.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, s := range subs {
+		sub, err := b.ps.Sub(ctx, s.topic)
+		if err != nil {
+			cancel()
+			wg.Wait()
+			return fmt.Errorf("sub %s: %w", s.topic, err)
+		}
+		h := middleware.Chain(b.mws...)(s.handler)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.loop(ctx, sub, h)
+			_ = sub.Close()
+		}()
+	}
+
+	err := b.ps.Start(ctx)
+	cancel()
+	wg.Wait()
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+func (b *Broker) loop(ctx context.Context, sub queue.Subscription[envelope], h queue.Handler) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-sub.Ch():
+			d := queue.NewDelivery(ctx, e.topic, e.m)
+			if _, err := queue.Handle(d, h); err != nil {
+				b.logger.WarnContext(ctx, "message nacked",
+					"topic", e.topic, "id", e.m.ID, "err", err)
+			}
+		}
+	}
+}
+
+// Stop stops the broker.
+func (b *Broker) Stop(ctx context.Context) error {
+	if err := b.ps.Stop(ctx); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.cancel != nil {
+		b.cancel()
+	}
+	return nil
+}
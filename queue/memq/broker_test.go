@@ -0,0 +1,113 @@
+package memq
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/adobaai/pkg/queue"
+)
+
+func TestBroker(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		got   []string
+		calls []string
+		ctx   = context.Background()
+	)
+
+	mw := func(next queue.Handler) queue.Handler {
+		return func(d queue.Delivery) error {
+			mu.Lock()
+			calls = append(calls, d.Topic())
+			mu.Unlock()
+			return next(d)
+		}
+	}
+	b := NewBroker(
+		WithBrokerMiddlewares(queue.Recover(slog.Default()), mw),
+		WithPubSubOptions(WithSubCapacity(10)),
+	)
+
+	require.Error(t, b.Subscribe("orders", nil))
+	require.NoError(t, b.Subscribe("orders", func(d queue.Delivery) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, string(d.Msg().Body))
+		switch string(d.Msg().Body) {
+		case "nack":
+			d.Nack()
+		case "error":
+			return errors.New("oops")
+		case "panic":
+			panic("haha")
+		}
+		return nil
+	}))
+
+	exit := make(chan struct{})
+	go func() {
+		assert.NoError(t, b.Start(ctx))
+		close(exit)
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	for _, body := range []string{"hello", "nack", "error", "panic", "world"} {
+		require.NoError(t, b.Publish(ctx, "orders", &queue.M{Body: []byte(body)}))
+	}
+	require.NoError(t, b.Publish(ctx, "users", &queue.M{Body: []byte("ignored")}))
+	time.Sleep(50 * time.Millisecond)
+
+	require.NoError(t, b.Stop(ctx))
+	<-exit
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"hello", "nack", "error", "panic", "world"}, got)
+	assert.Len(t, calls, 5)
+	require.ErrorIs(t, b.Publish(ctx, "orders", &queue.M{}), queue.ErrStopped)
+}
+
+// failingPubSub fails to subscribe the topic "bad", and records the closed subscriptions.
+type failingPubSub struct {
+	queue.PubSub[string, envelope]
+	closed atomic.Int32
+}
+
+type closingSub struct {
+	queue.Subscription[envelope]
+	ps *failingPubSub
+}
+
+func (s closingSub) Close() error {
+	s.ps.closed.Add(1)
+	return s.Subscription.Close()
+}
+
+func (ps *failingPubSub) Sub(ctx context.Context, topic string) (queue.Subscription[envelope], error) {
+	if topic == "bad" {
+		return nil, errors.New("oops")
+	}
+	sub, err := ps.PubSub.Sub(ctx, topic)
+	return closingSub{sub, ps}, err
+}
+
+func TestBrokerSubError(t *testing.T) {
+	ps := &failingPubSub{PubSub: NewPubSub(getTopic)}
+	b := NewBroker()
+	b.ps = ps
+	h := func(queue.Delivery) error { return nil }
+	require.NoError(t, b.Subscribe("a", h))
+	require.NoError(t, b.Subscribe("b", h))
+	require.NoError(t, b.Subscribe("bad", h))
+
+	require.EqualError(t, b.Start(context.Background()), "sub bad: oops")
+	assert.EqualValues(t, 2, ps.closed.Load(), "the started loops are stopped")
+}
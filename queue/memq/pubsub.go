@@ -167,7 +167,9 @@ func (ps *pubSub[K, E]) Start(ctx context.Context) error {
 			return ctx.Err()
 		case e := <-ps.events:
 			key := ps.getKey(e)
+			ps.mu.Lock()
 			subMap, ok := ps.subs[key]
+			ps.mu.Unlock()
 			if !ok {
 				continue
 			}
@@ -0,0 +1,326 @@
+// Package outbox implements the transactional outbox pattern.
+//
+// Events are written to the outbox table in the same transaction as the business data,
+// and a [Relay] publishes them to the message queue afterwards.
+//
+// See https://microservices.io/patterns/data/transactional-outbox.html
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+
+	"github.com/adobaai/pkg/dbz/bunrepo"
+	"github.com/adobaai/pkg/queue"
+)
+
+// Record is a row of the outbox table.
+type Record struct {
+	bun.BaseModel `bun:"table:outbox,alias:ob"`
+
+	ID          int64 `bun:",pk,autoincrement"`
+	EventID     string
+	EventType   string
+	AggregateID string `bun:",notnull"`
+	Payload     json.RawMessage
+	CreatedAt   time.Time
+	Attempts    int       `bun:",notnull"`
+	NextAt      time.Time `bun:",notnull"`
+	SentAt      time.Time `bun:",nullzero"`
+	FailedAt    time.Time `bun:",nullzero"`
+	LastError   string
+}
+
+func (r *Record) event() queue.Event {
+	return queue.Event{
+		ID:        r.EventID,
+		Type:      queue.EventType(r.EventType),
+		EntityID:  r.AggregateID,
+		Entity:    r.Payload,
+		CreatedAt: r.CreatedAt,
+	}
+}
+
+// CreateTable creates the outbox table if not exists.
+func CreateTable(ctx context.Context, db bun.IDB) error {
+	_, err := db.NewCreateTable().Model((*Record)(nil)).IfNotExists().Exec(ctx)
+	return err
+}
+
+// Add writes the events to the outbox inside the transaction.
+//
+// The [queue.Event.EntityID] is used as the aggregate ID,
+// events of the same aggregate are published in the order they are added.
+func Add(ctx context.Context, tx bun.Tx, es ...queue.Event) error {
+	if len(es) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	rs := make([]*Record, len(es))
+	for i, e := range es {
+		payload, err := json.Marshal(e.Entity)
+		if err != nil {
+			return fmt.Errorf("marshal entity: %w", err)
+		}
+		createdAt := e.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = now
+		}
+		rs[i] = &Record{
+			EventID:     e.ID,
+			EventType:   string(e.Type),
+			AggregateID: e.EntityID,
+			Payload:     payload,
+			CreatedAt:   createdAt,
+			NextAt:      now,
+		}
+	}
+	_, err := bunrepo.New[Record](tx).Addm(ctx, rs)
+	return err
+}
+
+// Relay polls the outbox table and publishes the pending events.
+//
+// Multiple relays can run concurrently, since rows are claimed with
+// `FOR UPDATE SKIP LOCKED` on Postgres.
+type Relay struct {
+	db     bun.IDB
+	repo   *bunrepo.Repo[Record]
+	pub    queue.Pub[queue.Event]
+	logger *slog.Logger
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+
+	interval    time.Duration
+	batchSize   int
+	maxAttempts int
+	backoff     func(attempts int) time.Duration
+	retention   time.Duration
+}
+
+var _ queue.Server = (*Relay)(nil)
+
+// Option is the option of [NewRelay].
+type Option func(r *Relay)
+
+// WithLogger sets the logger.
+func WithLogger(l *slog.Logger) Option {
+	return func(r *Relay) {
+		r.logger = l.With("component", "outbox")
+	}
+}
+
+// WithInterval sets the polling interval, default to 1 second.
+func WithInterval(d time.Duration) Option {
+	return func(r *Relay) {
+		r.interval = d
+	}
+}
+
+// WithBatchSize sets the number of rows claimed per poll, default to 100.
+func WithBatchSize(n int) Option {
+	return func(r *Relay) {
+		r.batchSize = n
+	}
+}
+
+// WithMaxAttempts sets the max publishing attempts of an event,
+// the event is marked as failed once exceeded. Zero means no limit.
+func WithMaxAttempts(n int) Option {
+	return func(r *Relay) {
+		r.maxAttempts = n
+	}
+}
+
+// WithBackoff sets the delay before the next attempt.
+func WithBackoff(f func(attempts int) time.Duration) Option {
+	return func(r *Relay) {
+		r.backoff = f
+	}
+}
+
+// WithRetention sets how long the sent events are kept, default to 7 days.
+// Negative means forever.
+func WithRetention(d time.Duration) Option {
+	return func(r *Relay) {
+		r.retention = d
+	}
+}
+
+// ExpBackoff returns an exponential backoff func capped by max.
+func ExpBackoff(base, max time.Duration) func(attempts int) time.Duration {
+	return func(attempts int) time.Duration {
+		d := base
+		for range attempts - 1 {
+			d *= 2
+			if d >= max {
+				return max
+			}
+		}
+		return d
+	}
+}
+
+// NewRelay returns a relay which publishes the events via pub.
+func NewRelay(db bun.IDB, pub queue.Pub[queue.Event], opts ...Option) *Relay {
+	r := &Relay{
+		db:        db,
+		repo:      bunrepo.New[Record](db),
+		pub:       pub,
+		logger:    slog.Default().With("component", "outbox"),
+		interval:  time.Second,
+		batchSize: 100,
+		backoff:   ExpBackoff(time.Second, 5*time.Minute),
+		retention: 7 * 24 * time.Hour,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Start polls the outbox until the context is done or the relay is stopped.
+func (r *Relay) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	r.mu.Lock()
+	r.cancel = cancel
+	r.mu.Unlock()
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	lastCleanup := time.Time{}
+	for {
+		n, err := r.Relay(ctx)
+		if err != nil && ctx.Err() == nil {
+			r.logger.ErrorContext(ctx, "relay error", "err", err)
+		}
+		if r.retention >= 0 && time.Since(lastCleanup) > time.Hour {
+			if _, err := r.Cleanup(ctx); err != nil && ctx.Err() == nil {
+				r.logger.ErrorContext(ctx, "cleanup error", "err", err)
+			}
+			lastCleanup = time.Now()
+		}
+		if err == nil && n == r.batchSize {
+			// There may be more pending events.
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.Canceled) {
+				return nil
+			}
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop stops the relay.
+func (r *Relay) Stop(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cancel != nil {
+		r.cancel()
+	}
+	return nil
+}
+
+// Relay claims a batch of the pending events and publishes them,
+// it returns the number of claimed events, which is 0 if the transaction fails.
+//
+// Only the earliest pending event of each aggregate is claimed,
+// so the events of an aggregate are published in order.
+func (r *Relay) Relay(ctx context.Context) (n int, err error) {
+	err = r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var rs []*Record
+		now := time.Now()
+		q := tx.NewSelect().Model(&rs).
+			Where("ob.sent_at IS NULL").
+			Where("ob.failed_at IS NULL").
+			Where("ob.next_at <= ?", now).
+			Where("ob.aggregate_id = '' OR NOT EXISTS (?)",
+				tx.NewSelect().TableExpr("outbox AS ob2").ColumnExpr("1").
+					Where("ob2.aggregate_id = ob.aggregate_id").
+					Where("ob2.sent_at IS NULL").
+					Where("ob2.failed_at IS NULL").
+					Where("ob2.id < ob.id"),
+			).
+			Order("ob.id").
+			Limit(r.batchSize)
+		if tx.Dialect().Name() == dialect.PG {
+			q.For("UPDATE SKIP LOCKED")
+		}
+		if err := q.Scan(ctx); err != nil {
+			return fmt.Errorf("claim: %w", err)
+		}
+
+		n = len(rs)
+		var sent []int64
+		for _, rec := range rs {
+			if err := r.pub.Pub(ctx, rec.event()); err != nil {
+				if err := r.retry(ctx, tx, rec, err); err != nil {
+					return fmt.Errorf("retry: %w", err)
+				}
+				continue
+			}
+			sent = append(sent, rec.ID)
+		}
+		if len(sent) == 0 {
+			return nil
+		}
+
+		repo := bunrepo.New[Record](tx)
+		_, err := repo.Updf(ctx, &Record{}, func(q *bun.UpdateQuery) *bun.UpdateQuery {
+			return q.Set("sent_at = ?", time.Now()).
+				Set("last_error = ''").
+				Where("id IN (?)", bun.In(sent))
+		})
+		if err != nil {
+			return fmt.Errorf("mark sent: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (r *Relay) retry(ctx context.Context, tx bun.Tx, rec *Record, pubErr error) error {
+	r.logger.WarnContext(ctx, "publish failed",
+		"id", rec.ID, "eventID", rec.EventID, "attempts", rec.Attempts+1, "err", pubErr)
+
+	rec.Attempts++
+	rec.LastError = pubErr.Error()
+	rec.NextAt = time.Now().Add(r.backoff(rec.Attempts))
+	cols := []string{"attempts", "last_error", "next_at"}
+	if r.maxAttempts > 0 && rec.Attempts >= r.maxAttempts {
+		rec.FailedAt = time.Now()
+		cols = append(cols, "failed_at")
+	}
+	_, err := bunrepo.New[Record](tx).Upd(ctx, rec, bunrepo.Columns(cols...))
+	return err
+}
+
+// Cleanup deletes the events sent before the retention period.
+func (r *Relay) Cleanup(ctx context.Context) (n int64, err error) {
+	res, err := r.repo.Delf(ctx, &Record{}, func(q *bun.DeleteQuery) *bun.DeleteQuery {
+		return q.Where("sent_at < ?", time.Now().Add(-r.retention))
+	})
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,187 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+	"github.com/uptrace/bun/driver/sqliteshim"
+
+	"github.com/adobaai/pkg/queue"
+	"github.com/adobaai/pkg/testingz"
+)
+
+func newDB(t *testing.T) *bun.DB {
+	sqldb, err := sql.Open(sqliteshim.ShimName, "file::memory:")
+	require.NoError(t, err)
+	sqldb.SetMaxOpenConns(1)
+	db := bun.NewDB(sqldb, sqlitedialect.New())
+	t.Cleanup(func() { _ = db.Close() })
+	require.NoError(t, CreateTable(context.Background(), db))
+	return db
+}
+
+type fakePub struct {
+	mu   sync.Mutex
+	es   []queue.Event
+	fail func(queue.Event) bool
+}
+
+func (p *fakePub) Pub(ctx context.Context, e queue.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.fail != nil && p.fail(e) {
+		return errors.New("broker down")
+	}
+	p.es = append(p.es, e)
+	return nil
+}
+
+func (p *fakePub) ids() (res []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, e := range p.es {
+		res = append(res, e.ID)
+	}
+	return
+}
+
+type Order struct {
+	ID     string `json:"id"`
+	Amount int    `json:"amount"`
+}
+
+func addEvents(t *testing.T, db *bun.DB, es ...queue.Event) {
+	err := db.RunInTx(context.Background(), nil, func(ctx context.Context, tx bun.Tx) error {
+		return Add(ctx, tx, es...)
+	})
+	require.NoError(t, err)
+}
+
+func TestRelay(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Rollback", func(t *testing.T) {
+		db := newDB(t)
+		err := db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+			require.NoError(t, Add(ctx, tx, queue.Event{ID: "e1", EntityID: "o1"}))
+			return errors.New("business failed")
+		})
+		require.Error(t, err)
+		testingz.R(db.NewSelect().Model((*Record)(nil)).Count(ctx)).NoError(t).Equal(0)
+	})
+
+	t.Run("Order", func(t *testing.T) {
+		db := newDB(t)
+		addEvents(t, db,
+			queue.Event{ID: "e1", Type: "order.created", EntityID: "o1", Entity: Order{"o1", 10}},
+			queue.Event{ID: "e2", Type: "order.created", EntityID: "o2", Entity: Order{"o2", 20}},
+			queue.Event{ID: "e3", Type: "order.paid", EntityID: "o1", Entity: Order{"o1", 10}},
+		)
+
+		pub := &fakePub{}
+		r := NewRelay(db, pub)
+		testingz.R(r.Relay(ctx)).NoError(t).Equal(2)
+		assert.Equal(t, []string{"e1", "e2"}, pub.ids())
+		testingz.R(r.Relay(ctx)).NoError(t).Equal(1)
+		testingz.R(r.Relay(ctx)).NoError(t).Equal(0)
+		assert.Equal(t, []string{"e1", "e2", "e3"}, pub.ids())
+
+		var o Order
+		require.NoError(t, json.Unmarshal(pub.es[0].Entity.(json.RawMessage), &o))
+		assert.Equal(t, Order{"o1", 10}, o)
+		assert.Equal(t, queue.EventType("order.created"), pub.es[0].Type)
+	})
+
+	t.Run("Retry", func(t *testing.T) {
+		db := newDB(t)
+		addEvents(t, db,
+			queue.Event{ID: "e1", EntityID: "o1"},
+			queue.Event{ID: "e2", EntityID: "o1"},
+			queue.Event{ID: "e3", EntityID: "o2"},
+		)
+
+		failing := true
+		pub := &fakePub{fail: func(e queue.Event) bool { return failing && e.ID == "e1" }}
+		r := NewRelay(db, pub, WithBackoff(func(int) time.Duration { return 0 }), WithMaxAttempts(3))
+		testingz.R(r.Relay(ctx)).NoError(t).Equal(2)
+		assert.Equal(t, []string{"e3"}, pub.ids())
+
+		got := &Record{ID: 1}
+		require.NoError(t, db.NewSelect().Model(got).WherePK().Scan(ctx))
+		assert.Equal(t, 1, got.Attempts)
+		assert.Equal(t, "broker down", got.LastError)
+
+		failing = false
+		testingz.R(r.Relay(ctx)).NoError(t).Equal(1)
+		testingz.R(r.Relay(ctx)).NoError(t).Equal(1)
+		assert.Equal(t, []string{"e3", "e1", "e2"}, pub.ids())
+	})
+
+	t.Run("MaxAttempts", func(t *testing.T) {
+		db := newDB(t)
+		addEvents(t, db,
+			queue.Event{ID: "e1", EntityID: "o1"},
+			queue.Event{ID: "e2", EntityID: "o1"},
+		)
+
+		pub := &fakePub{fail: func(e queue.Event) bool { return e.ID == "e1" }}
+		r := NewRelay(db, pub, WithBackoff(func(int) time.Duration { return 0 }), WithMaxAttempts(2))
+		testingz.R(r.Relay(ctx)).NoError(t).Equal(1)
+		testingz.R(r.Relay(ctx)).NoError(t).Equal(1)
+		// e1 has failed, so e2 is unblocked.
+		testingz.R(r.Relay(ctx)).NoError(t).Equal(1)
+		assert.Equal(t, []string{"e2"}, pub.ids())
+	})
+
+	t.Run("MarkFailed", func(t *testing.T) {
+		db := newDB(t)
+		addEvents(t, db, queue.Event{ID: "e1"})
+
+		ctx, cancel := context.WithCancel(ctx)
+		pub := &fakePub{fail: func(queue.Event) bool {
+			cancel()
+			return false
+		}}
+		r := NewRelay(db, pub, WithBatchSize(1))
+		n, err := r.Relay(ctx)
+		require.Error(t, err)
+		assert.Zero(t, n, "the batch is rolled back")
+		assert.Equal(t, []string{"e1"}, pub.ids())
+	})
+
+	t.Run("Cleanup", func(t *testing.T) {
+		db := newDB(t)
+		addEvents(t, db, queue.Event{ID: "e1"}, queue.Event{ID: "e2"})
+
+		r := NewRelay(db, &fakePub{}, WithRetention(0))
+		testingz.R(r.Relay(ctx)).NoError(t).Equal(2)
+		testingz.R(r.Cleanup(ctx)).NoError(t).Equal(2)
+	})
+
+	t.Run("Server", func(t *testing.T) {
+		db := newDB(t)
+		pub := &fakePub{}
+		r := NewRelay(db, pub, WithInterval(10*time.Millisecond))
+
+		exit := make(chan struct{})
+		go func() {
+			assert.NoError(t, r.Start(ctx))
+			close(exit)
+		}()
+
+		addEvents(t, db, queue.Event{ID: "e1"})
+		time.Sleep(50 * time.Millisecond)
+		require.NoError(t, r.Stop(ctx))
+		<-exit
+		assert.Equal(t, []string{"e1"}, pub.ids())
+	})
+}
@@ -0,0 +1,134 @@
+package redisq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/adobaai/pkg/middleware"
+	"github.com/adobaai/pkg/queue"
+)
+
+// Broker adapts the Redis Stream to [queue.Broker].
+//
+// Every topic is a stream consumed by the same group.
+// A nacked or failed message is not acknowledged, so it stays in the pending list
+// and is redelivered when the pending entries are read again,
+// which is every minute by default, see [WithRedelivery].
+type Broker struct {
+	*Consumer
+	group      string
+	redelivery time.Duration
+	mws        []queue.Middleware
+	copts      []Option
+}
+
+var _ queue.Broker = (*Broker)(nil)
+
+// BrokerOption is the option of [NewBroker].
+type BrokerOption func(b *Broker)
+
+// WithBrokerMiddlewares adds middlewares to the handlers of the broker.
+func WithBrokerMiddlewares(mws ...queue.Middleware) BrokerOption {
+	return func(b *Broker) {
+		b.mws = append(b.mws, mws...)
+	}
+}
+
+// WithRedelivery sets the interval of redelivering the pending messages,
+// see [Route.RetryPending].
+func WithRedelivery(d time.Duration) BrokerOption {
+	return func(b *Broker) {
+		b.redelivery = d
+	}
+}
+
+// WithConsumerOptions sets the options of the underlying [Consumer].
+func WithConsumerOptions(opts ...Option) BrokerOption {
+	return func(b *Broker) {
+		b.copts = append(b.copts, opts...)
+	}
+}
+
+// NewBroker returns a broker which consumes the streams with the group.
+func NewBroker(c *redis.Client, l *slog.Logger, group string, opts ...BrokerOption) *Broker {
+	b := &Broker{
+		group:      group,
+		redelivery: time.Minute,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	b.Consumer = NewConsumer(c, l, b.copts...)
+	return b
+}
+
+// Publish publishes messages to the stream,
+// the IDs of the messages are set to the IDs generated by Redis.
+func (b *Broker) Publish(ctx context.Context, stream string, ms ...*queue.M) error {
+	cmds := make([]*redis.StringCmd, len(ms))
+	_, err := b.client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for i, m := range ms {
+			if m.CreatedAt.IsZero() {
+				m.CreatedAt = time.Now()
+			}
+			values, err := toRedisValues(m)
+			if err != nil {
+				return fmt.Errorf("to redis values: %w", err)
+			}
+			cmds[i] = p.XAdd(ctx, &redis.XAddArgs{
+				Stream: stream,
+				Values: values,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("xadd: %w", err)
+	}
+	for i, cmd := range cmds {
+		ms[i].ID = cmd.Val()
+	}
+	return nil
+}
+
+// Subscribe registers the handler of the stream.
+func (b *Broker) Subscribe(stream string, h queue.Handler) error {
+	if h == nil {
+		return errors.New("redisq: no handler provided")
+	}
+
+	h = middleware.Chain(b.mws...)(h)
+	return b.AddRoute(&Route{
+		Stream:       stream,
+		Group:        b.group,
+		RetryPending: b.redelivery,
+		Handler: func(ctx Context) error {
+			m, err := toM(ctx.Msg())
+			if err != nil {
+				return fmt.Errorf("to m: %w", err)
+			}
+			acked, err := queue.Handle(queue.NewDelivery(ctx, stream, m), h)
+			if acked {
+				ctx.Ack(m.ID)
+			}
+			return err
+		},
+	})
+}
+
+// Start creates the consumer groups if they do not exist and starts consuming.
+func (b *Broker) Start(ctx context.Context) error {
+	for _, r := range b.routes {
+		err := b.client.XGroupCreateMkStream(ctx, r.Stream, r.Group, "0").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return fmt.Errorf("create group: %w", err)
+		}
+	}
+	return b.Consumer.Start(ctx)
+}
@@ -0,0 +1,67 @@
+package redisq
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/adobaai/pkg/queue"
+)
+
+func TestBroker(t *testing.T) {
+	var (
+		l      = slog.Default()
+		ctx    = context.Background()
+		stream = testKeyPrefix + "broker"
+		rdb    = redis.NewClient(&redis.Options{
+			Addr: "localhost:6379",
+		})
+	)
+
+	t.Cleanup(func() {
+		require.NoError(t, rdb.Del(ctx, stream).Err())
+	})
+
+	var got []string
+	b := NewBroker(rdb, l, group, WithBrokerMiddlewares(queue.Recover(l)),
+		WithRedelivery(100*time.Millisecond))
+	require.Error(t, b.Subscribe(stream, nil))
+	require.NoError(t, b.Subscribe(stream, func(d queue.Delivery) error {
+		got = append(got, string(d.Msg().Body))
+		assert.Equal(t, "bar", d.Msg().Metadata["foo"])
+		if string(d.Msg().Body) == "nack" {
+			d.Nack()
+		}
+		return nil
+	}))
+
+	ms := []*queue.M{
+		{ContentType: "text/plain", Body: []byte("hello"), Metadata: queue.Metadata{"foo": "bar"}},
+		{ContentType: "text/plain", Body: []byte("nack"), Metadata: queue.Metadata{"foo": "bar"}},
+	}
+	require.NoError(t, b.Publish(ctx, stream, ms...))
+	assert.NotEmpty(t, ms[0].ID)
+	assert.NotEmpty(t, ms[1].ID)
+
+	exit := make(chan struct{})
+	go func() {
+		assert.NoError(t, b.Start(ctx))
+		close(exit)
+	}()
+	time.Sleep(time.Second)
+	require.NoError(t, b.Stop(ctx))
+	<-exit
+
+	// The nacked message is redelivered.
+	require.Greater(t, len(got), 2)
+	assert.Equal(t, []string{"hello", "nack", "nack"}, got[:3])
+
+	infoCmd := rdb.XInfoGroups(ctx, stream)
+	require.NoError(t, infoCmd.Err())
+	assert.Equal(t, int64(1), infoCmd.Val()[0].Pending)
+}
@@ -65,26 +65,31 @@ func NewM[T any](t T) *M[T] {
 
 func (m *M[T]) toRedisValues() (res []any, err error) {
 	var body []byte
-	var meta []byte
 	switch m.ContentType {
 	default:
 		return nil, fmt.Errorf("%w: %s", errors.ErrUnsupported, m.ContentType)
 	case "", MIMEJSON:
-		meta, err = json.Marshal(m.Metadata)
-		if err != nil {
-			return nil, fmt.Errorf("marshal metadata: %w", err)
-		}
 		body, err = json.Marshal(m.T)
 		if err != nil {
 			return nil, fmt.Errorf("marshal body: %w", err)
 		}
 	}
+	qm := m.M
+	qm.Body = body
+	return toRedisValues(&qm)
+}
+
+func toRedisValues(m *queue.M) (res []any, err error) {
+	meta, err := json.Marshal(m.Metadata)
+	if err != nil {
+		return nil, fmt.Errorf("marshal metadata: %w", err)
+	}
 	return []any{
 		"ct", m.ContentType,
-		"cl", len(body),
+		"cl", len(m.Body),
 		"ca", m.CreatedAt.Format(time.RFC3339Nano),
 		"mt", meta,
-		"bd", body,
+		"bd", m.Body,
 	}, nil
 }
 
@@ -92,7 +97,7 @@ func (m *M[T]) toRedisValues() (res []any, err error) {
 // and potentially large data (e.g., JSON-encoded body),
 // returning a pointer (*M[T]) is the better choice for efficiency and consistency.
 
-func toM2[T any](m RM) (res *M[T], err error) {
+func toM(m RM) (res *queue.M, err error) {
 	createdAt, err := time.Parse(time.RFC3339Nano, m.GetStr("ca"))
 	if err != nil {
 		return nil, fmt.Errorf("parse createdAt: %w", err)
@@ -102,31 +107,37 @@ func toM2[T any](m RM) (res *M[T], err error) {
 		return nil, fmt.Errorf("parse contentLength: %w", err)
 	}
 
-	var t T
 	meta := queue.Metadata{}
-	ct := m.GetStr("ct")
-	metaStr := m.GetStr("mt")
-	bodyStr := m.GetStr("bd")
-	switch ct {
+	if err = json.Unmarshal([]byte(m.GetStr("mt")), &meta); err != nil {
+		return nil, fmt.Errorf("unmarshal metadata: %w", err)
+	}
+	return &queue.M{
+		ID:            m.ID,
+		ContentType:   m.GetStr("ct"),
+		ContentLength: cl,
+		CreatedAt:     createdAt,
+		Metadata:      meta,
+		Body:          []byte(m.GetStr("bd")),
+	}, nil
+}
+
+func toM2[T any](m RM) (res *M[T], err error) {
+	qm, err := toM(m)
+	if err != nil {
+		return nil, err
+	}
+
+	var t T
+	switch qm.ContentType {
 	default:
-		return nil, fmt.Errorf("%w: %s", errors.ErrUnsupported, ct)
+		return nil, fmt.Errorf("%w: %s", errors.ErrUnsupported, qm.ContentType)
 	case "", MIMEJSON:
-		if err = json.Unmarshal([]byte(metaStr), &meta); err != nil {
-			return nil, fmt.Errorf("unmarshal metadata: %w", err)
-		}
-		if err = json.Unmarshal([]byte(bodyStr), &t); err != nil {
+		if err = json.Unmarshal(qm.Body, &t); err != nil {
 			return nil, fmt.Errorf("unmarshal body: %w", err)
 		}
 	}
 	return &M[T]{
-		M: queue.M{
-			ID:            m.ID,
-			ContentType:   ct,
-			ContentLength: cl,
-			CreatedAt:     createdAt,
-			Metadata:      meta,
-			Body:          []byte(bodyStr),
-		},
+		M: *qm,
 		T: t,
 	}, nil
 }
@@ -218,6 +229,12 @@ type Route struct {
 	NoPending bool    // NoPending ignores the pending messages
 	BatchSize int64   // BatchSize specifies the number of messages fetched per batch
 	MaxLen    int64   // MaxLen specifies the max length of current stream
+	// RetryPending re-reads the pending messages from the start at the interval
+	// after they are all read, so the failed and nacked messages are redelivered.
+	// Zero means they are only read again after restarting.
+	RetryPending time.Duration
+
+	pendingDoneAt time.Time
 }
 
 // SpanName is the name of the span for tracing.
@@ -285,9 +302,10 @@ func (c *Consumer) Stop(ctx context.Context) error {
 	}
 }
 
-func (c *Consumer) MustAddRoute(r *Route) {
+// AddRoute adds the route, it returns an error if the route has no handler.
+func (c *Consumer) AddRoute(r *Route) error {
 	if r.Handler == nil {
-		panic("redisq: no handler provide")
+		return errors.New("redisq: no handler provided")
 	}
 
 	if r.PendingID == "" {
@@ -300,6 +318,14 @@ func (c *Consumer) MustAddRoute(r *Route) {
 		r.MaxLen = MaxLen
 	}
 	c.routes = append(c.routes, r)
+	return nil
+}
+
+// MustAddRoute is like [Consumer.AddRoute] but panics if an error occurs.
+func (c *Consumer) MustAddRoute(r *Route) {
+	if err := c.AddRoute(r); err != nil {
+		panic(err)
+	}
 }
 
 func MustAddHandler[T any](
@@ -348,7 +374,11 @@ func (c *Consumer) loopRoute(ctx context.Context, r *Route) {
 		}
 		if errors.Is(err, redis.Nil) {
 			l.DebugContext(ctx, "no message", "func", "loopRoute")
-			time.Sleep(time.Minute)
+			d := time.Minute
+			if r.RetryPending > 0 {
+				d = min(d, r.RetryPending)
+			}
+			time.Sleep(d)
 		} else {
 			l.ErrorContext(ctx, err.Error(), "func", "loopRoute")
 			time.Sleep(3 * time.Second)
@@ -374,12 +404,17 @@ func (c *Consumer) handleRoute(ctx context.Context, r *Route) (err error) {
 	myCtx := newContext(ctx, r, ms...)
 	h := Chain(c.mws...)(r.Handler)
 	err = h(myCtx)
+	// The nacked messages are left pending without an error.
+	nacked := errors.Is(err, queue.ErrNacked)
+	if nacked {
+		err = nil
+	}
 	if ids := myCtx.getAckIDs(); len(ids) != 0 {
 		err = errors.Join(
 			err,
 			c.client.XAck(ctx, r.Stream, r.Group, ids...).Err(),
 		)
-	} else if err == nil {
+	} else if err == nil && !nacked {
 		ids = collections.Map(ms, getID)
 		err = c.client.XAck(ctx, r.Stream, r.Group, ids...).Err()
 	}
@@ -428,6 +463,10 @@ func (c *Consumer) read(ctx context.Context, r *Route) (ms []RM, err error) {
 	readCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
 	defer cancel()
 
+	if r.NoPending && r.RetryPending > 0 && !r.pendingDoneAt.IsZero() &&
+		time.Since(r.pendingDoneAt) >= r.RetryPending {
+		r.NoPending, r.PendingID = false, "0"
+	}
 	if !r.NoPending {
 		// Use any other ID (besides '>') to return all entries that are pending.
 		// See https://redis.io/commands/xreadgroup/.
@@ -443,7 +482,9 @@ func (c *Consumer) read(ctx context.Context, r *Route) (ms []RM, err error) {
 		// If no pending entries, xss is "[{stream []}]".
 		// See TestXReadGroup for details.
 		xms = xss[0].Messages
-		r.NoPending = len(xms) < int(r.BatchSize)
+		if r.NoPending = len(xms) < int(r.BatchSize); r.NoPending {
+			r.pendingDoneAt = time.Now()
+		}
 	}
 	if len(xms) != 0 {
 		// The last item has the biggest id.
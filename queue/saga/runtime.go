@@ -0,0 +1,369 @@
+package saga
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/adobaai/pkg/queue"
+)
+
+// Runtime drives the registered sagas with the events from a [queue.PubSub].
+//
+// The events of different types and the timeouts are handled concurrently,
+// and the versions of the instances are checked by the [Store], so only one of
+// the concurrent changes of an instance is persisted and the others get [ErrConflict].
+// The expired instances are claimed before running the compensations.
+type Runtime struct {
+	ps     queue.PubSub[queue.EventType, queue.Event]
+	store  Store
+	logger *slog.Logger
+	now    func() time.Time
+	cancel context.CancelFunc
+
+	interval   time.Duration
+	batchSize  int
+	retryDelay time.Duration
+
+	// mu guards the sagas and the cancel func.
+	mu    sync.Mutex
+	sagas []*Saga
+}
+
+var _ queue.Server = (*Runtime)(nil)
+
+// Option is the option of [New].
+type Option func(r *Runtime)
+
+// WithLogger sets the logger.
+func WithLogger(l *slog.Logger) Option {
+	return func(r *Runtime) {
+		r.logger = l.With("component", "saga")
+	}
+}
+
+// WithInterval sets the interval checking the timeouts, default to 1 second.
+func WithInterval(d time.Duration) Option {
+	return func(r *Runtime) {
+		r.interval = d
+	}
+}
+
+// WithBatchSize sets the number of the expired instances handled per check, default to 100.
+func WithBatchSize(n int) Option {
+	return func(r *Runtime) {
+		r.batchSize = n
+	}
+}
+
+// WithRetryDelay sets the delay before retrying a failed compensation, default to 10 seconds.
+func WithRetryDelay(d time.Duration) Option {
+	return func(r *Runtime) {
+		r.retryDelay = d
+	}
+}
+
+// WithClock sets the func returning the current time, default to [time.Now].
+func WithClock(now func() time.Time) Option {
+	return func(r *Runtime) {
+		r.now = now
+	}
+}
+
+// New returns a runtime. The pubsub should be keyed by [queue.Event.Type],
+// and it is started by the caller.
+//
+// Example:
+//
+//	ps := memq.NewPubSub(func(e queue.Event) queue.EventType { return e.Type })
+func New(ps queue.PubSub[queue.EventType, queue.Event], store Store, opts ...Option) *Runtime {
+	r := &Runtime{
+		ps:         ps,
+		store:      store,
+		logger:     slog.Default().With("component", "saga"),
+		now:        time.Now,
+		interval:   time.Second,
+		batchSize:  100,
+		retryDelay: 10 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Register registers the saga, it should be called before the runtime starts.
+func (r *Runtime) Register(s *Saga) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if slices.ContainsFunc(r.sagas, func(it *Saga) bool { return it.Name == s.Name }) {
+		return fmt.Errorf("saga %s: already registered", s.Name)
+	}
+	r.sagas = append(r.sagas, s)
+	return nil
+}
+
+// Start subscribes the events of the registered sagas and checks the timeouts
+// until the context is done or the runtime is stopped.
+func (r *Runtime) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var ets []queue.EventType
+	r.mu.Lock()
+	r.cancel = cancel
+	for _, s := range r.sagas {
+		for _, et := range s.eventTypes() {
+			if !slices.Contains(ets, et) {
+				ets = append(ets, et)
+			}
+		}
+	}
+	r.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, et := range ets {
+		sub, err := r.ps.Sub(ctx, et)
+		if err != nil {
+			cancel()
+			wg.Wait()
+			return fmt.Errorf("sub %s: %w", et, err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.loop(ctx, sub)
+		}()
+	}
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			if errors.Is(ctx.Err(), context.Canceled) {
+				return nil
+			}
+			return ctx.Err()
+		case <-ticker.C:
+			if _, err := r.CheckTimeouts(ctx); err != nil && ctx.Err() == nil {
+				r.logger.ErrorContext(ctx, "check timeouts error", "err", err)
+			}
+		}
+	}
+}
+
+func (r *Runtime) loop(ctx context.Context, sub queue.Subscription[queue.Event]) {
+	defer sub.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-sub.Ch():
+			if !ok {
+				return
+			}
+			if err := r.Handle(ctx, e); err != nil {
+				r.logger.ErrorContext(ctx, "handle event error",
+					"eventID", e.ID, "eventType", e.Type, "err", err)
+			}
+		}
+	}
+}
+
+// Stop stops the runtime.
+func (r *Runtime) Stop(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cancel != nil {
+		r.cancel()
+	}
+	return nil
+}
+
+// Handle starts or advances the saga instances with the event.
+func (r *Runtime) Handle(ctx context.Context, e queue.Event) error {
+	var errs []error
+	for _, s := range r.registered() {
+		if err := r.handle(ctx, s, e); err != nil {
+			errs = append(errs, fmt.Errorf("saga %s: %w", s.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *Runtime) registered() []*Saga {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.sagas
+}
+
+func (r *Runtime) handle(ctx context.Context, s *Saga, e queue.Event) error {
+	key := s.key(e)
+	st, err := r.store.Find(ctx, s.Name, key)
+	if errors.Is(err, ErrNotFound) {
+		if e.Type != s.Start {
+			return nil
+		}
+		return r.start(ctx, s, key, e)
+	}
+	if err != nil {
+		return fmt.Errorf("find: %w", err)
+	}
+	if st.Status != StatusRunning {
+		return nil
+	}
+
+	step := s.Steps[st.Step]
+	switch e.Type {
+	case step.Done:
+		st.Step++
+		return r.advance(ctx, s, st, e)
+	case step.Failed:
+		return r.compensate(ctx, s, st, e, fmt.Errorf("step %s failed by %s", step.Name, e.Type))
+	}
+	return nil
+}
+
+func (r *Runtime) start(ctx context.Context, s *Saga, key string, e queue.Event) error {
+	var data json.RawMessage
+	switch v := e.Entity.(type) {
+	case nil:
+	case json.RawMessage:
+		data = v
+	default:
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			return fmt.Errorf("marshal entity: %w", err)
+		}
+	}
+
+	id := e.ID
+	if id == "" {
+		id = strconv.FormatInt(r.now().UnixNano(), 36)
+	}
+	now := r.now()
+	st := &State{
+		ID:        s.Name + ":" + key + ":" + id,
+		Saga:      s.Name,
+		Key:       key,
+		Status:    StatusRunning,
+		Data:      data,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := r.store.Create(ctx, st); err != nil {
+		return fmt.Errorf("create: %w", err)
+	}
+	return r.advance(ctx, s, st, e)
+}
+
+// advance runs the actions from the current step until a step waits for its done event.
+func (r *Runtime) advance(ctx context.Context, s *Saga, st *State, e queue.Event) error {
+	for ; st.Step < len(s.Steps); st.Step++ {
+		step := s.Steps[st.Step]
+		if step.Action != nil {
+			if err := step.Action(ctx, &Context{State: st, Event: e}); err != nil {
+				return r.compensate(ctx, s, st, e, fmt.Errorf("step %s: %w", step.Name, err))
+			}
+		}
+		if step.Done != "" {
+			st.Deadline = time.Time{}
+			if step.Timeout > 0 {
+				st.Deadline = r.now().Add(step.Timeout)
+			}
+			return r.update(ctx, st)
+		}
+	}
+
+	st.Status = StatusCompleted
+	st.Deadline = time.Time{}
+	return r.update(ctx, st)
+}
+
+// compensate runs the compensations of the completed steps in reverse order.
+// If a compensation fails, it is retried after the retry delay.
+func (r *Runtime) compensate(ctx context.Context, s *Saga, st *State, e queue.Event, cause error) error {
+	r.fail(ctx, st, cause)
+
+	for ; st.Step > 0; st.Step-- {
+		step := s.Steps[st.Step-1]
+		if step.Compensate == nil {
+			continue
+		}
+		if err := step.Compensate(ctx, &Context{State: st, Event: e}); err != nil {
+			st.Error = fmt.Sprintf("compensate %s: %v", step.Name, err)
+			st.Deadline = r.now().Add(r.retryDelay)
+			return errors.Join(err, r.update(ctx, st))
+		}
+	}
+
+	st.Status = StatusCompensated
+	st.Deadline = time.Time{}
+	return r.update(ctx, st)
+}
+
+// fail marks the running instance as compensating by the cause.
+func (r *Runtime) fail(ctx context.Context, st *State, cause error) {
+	if st.Status == StatusRunning {
+		r.logger.WarnContext(ctx, "compensating", "id", st.ID, "cause", cause)
+		st.Status = StatusCompensating
+		st.Error = cause.Error()
+	}
+}
+
+func (r *Runtime) update(ctx context.Context, st *State) error {
+	st.UpdatedAt = r.now()
+	if err := r.store.Update(ctx, st); err != nil {
+		return fmt.Errorf("update: %w", err)
+	}
+	return nil
+}
+
+// CheckTimeouts compensates the instances whose current step times out,
+// and retries the failed compensations. It returns the number of handled instances.
+//
+// The instances are claimed by updating their deadlines to the retry delay later
+// before compensating, and the instances changed concurrently are skipped.
+func (r *Runtime) CheckTimeouts(ctx context.Context) (n int, err error) {
+	now := r.now()
+	sts, err := r.store.Expired(ctx, now, r.batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("expired: %w", err)
+	}
+
+	sagas := r.registered()
+	var errs []error
+	for _, st := range sts {
+		i := slices.IndexFunc(sagas, func(s *Saga) bool { return s.Name == st.Saga })
+		if i < 0 {
+			continue
+		}
+		s := sagas[i]
+		if st.Status == StatusRunning {
+			r.fail(ctx, st, fmt.Errorf("step %s: %w", s.Steps[st.Step].Name, ErrTimeout))
+		}
+		st.Deadline = now.Add(r.retryDelay)
+		if err := r.update(ctx, st); err != nil {
+			if !errors.Is(err, ErrConflict) {
+				errs = append(errs, fmt.Errorf("saga %s: claim: %w", s.Name, err))
+			}
+			continue
+		}
+		if err := r.compensate(ctx, s, st, queue.Event{}, nil); err != nil {
+			errs = append(errs, fmt.Errorf("saga %s: %w", s.Name, err))
+		}
+		n++
+	}
+	return n, errors.Join(errs...)
+}
@@ -0,0 +1,194 @@
+// Package saga implements a saga (process manager) runtime on top of [queue.Event]s.
+//
+// A [Saga] is a sequence of [Step]s started by an event. Each step runs its action,
+// then waits for the done event, the failed event or the timeout:
+//
+//   - On the done event, the saga advances to the next step.
+//   - On the failed event, an action error or the timeout,
+//     the compensations of the completed steps run in reverse order.
+//
+// The state of every saga instance is persisted through a [Store],
+// see [NewMemStore] and [NewBunStore].
+//
+// Example:
+//
+//	rt := saga.New(ps, saga.NewBunStore(db))
+//	rt.Register(&saga.Saga{
+//		Name:  "order",
+//		Start: "order.created",
+//		Steps: []saga.Step{
+//			{Name: "reserve", Action: reserve, Done: "inventory.reserved", Failed: "inventory.failed", Compensate: release},
+//			{Name: "charge", Action: charge, Done: "payment.charged", Failed: "payment.failed", Timeout: time.Minute},
+//			{Name: "ship", Action: ship},
+//		},
+//	})
+//	go rt.Start(ctx)
+package saga
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"github.com/adobaai/pkg/queue"
+)
+
+var (
+	// ErrNotFound is returned when the saga instance does not exist.
+	ErrNotFound = errors.New("saga: not found")
+	// ErrConflict is returned when the saga instance is modified concurrently.
+	ErrConflict = errors.New("saga: conflict")
+	// ErrTimeout is the cause of the compensation when a step times out.
+	ErrTimeout = errors.New("saga: step timeout")
+)
+
+// Status is the status of a saga instance.
+type Status string
+
+const (
+	StatusRunning      Status = "running"
+	StatusCompleted    Status = "completed"
+	StatusCompensating Status = "compensating"
+	StatusCompensated  Status = "compensated"
+)
+
+// Active reports whether the saga instance is still in progress.
+func (s Status) Active() bool {
+	return s == StatusRunning || s == StatusCompensating
+}
+
+// State is the persisted state of a saga instance.
+type State struct {
+	bun.BaseModel `bun:"table:sagas,alias:sg"`
+
+	ID     string `bun:",pk"`
+	Saga   string `bun:",notnull"`
+	Key    string `bun:",notnull"`
+	Status Status `bun:",notnull"`
+	// Step is the index of the current step while running,
+	// or the number of the steps left to compensate while compensating.
+	Step int `bun:",notnull"`
+	Data json.RawMessage
+	// Error is the cause of the compensation or the last compensation error.
+	Error string
+	// Deadline is when the current step times out or the failed compensation is retried.
+	Deadline  time.Time `bun:",nullzero"`
+	Version   int       `bun:",notnull"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (s *State) clone() *State {
+	res := *s
+	res.Data = append(json.RawMessage(nil), s.Data...)
+	return &res
+}
+
+// Store persists the saga instances.
+type Store interface {
+	// Create creates the saga instance.
+	Create(ctx context.Context, s *State) error
+	// Get returns the saga instance by ID, or [ErrNotFound].
+	Get(ctx context.Context, id string) (*State, error)
+	// Find returns the active saga instance by the saga name and the correlation key,
+	// or [ErrNotFound].
+	Find(ctx context.Context, saga, key string) (*State, error)
+	// Update updates the saga instance if its version is not changed,
+	// and increases the version. It returns [ErrConflict] otherwise.
+	Update(ctx context.Context, s *State) error
+	// Expired returns the active saga instances whose deadline is before now.
+	Expired(ctx context.Context, now time.Time, limit int) ([]*State, error)
+}
+
+// Context is passed to the actions and compensations.
+type Context struct {
+	State *State
+	// Event is the event triggering the action, it is zero for timeouts.
+	Event queue.Event
+}
+
+// Bind decodes the data of the saga instance into v.
+func (c *Context) Bind(v any) error {
+	if len(c.State.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(c.State.Data, v)
+}
+
+// Set encodes v as the data of the saga instance, which is persisted after the action.
+func (c *Context) Set(v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("marshal data: %w", err)
+	}
+	c.State.Data = b
+	return nil
+}
+
+// Action is an action or a compensation of a step.
+type Action func(ctx context.Context, sc *Context) error
+
+// Step is a step of a saga.
+type Step struct {
+	Name string
+	// Action is run when the step starts, usually sends a command.
+	Action Action
+	// Done is the event completing the step.
+	// The step completes right after the action if it is empty.
+	Done queue.EventType
+	// Failed is the event failing the step.
+	Failed queue.EventType
+	// Compensate undoes the step after it is completed.
+	Compensate Action
+	// Timeout is the max duration waiting for the done event, zero means no limit.
+	Timeout time.Duration
+}
+
+// Saga defines a saga.
+type Saga struct {
+	Name string
+	// Start is the event starting a saga instance, its entity is the initial data.
+	Start queue.EventType
+	// Key returns the correlation key of the event, default to [queue.Event.EntityID].
+	// There is at most one active instance for each key.
+	Key   func(queue.Event) string
+	Steps []Step
+}
+
+func (s *Saga) key(e queue.Event) string {
+	if s.Key != nil {
+		return s.Key(e)
+	}
+	return e.EntityID
+}
+
+func (s *Saga) validate() error {
+	if s.Name == "" {
+		return errors.New("saga: name is required")
+	}
+	if s.Start == "" {
+		return fmt.Errorf("saga %s: start event is required", s.Name)
+	}
+	if len(s.Steps) == 0 {
+		return fmt.Errorf("saga %s: steps are required", s.Name)
+	}
+	return nil
+}
+
+// eventTypes returns the event types the saga listens on.
+func (s *Saga) eventTypes() []queue.EventType {
+	res := []queue.EventType{s.Start}
+	for _, st := range s.Steps {
+		if st.Done != "" {
+			res = append(res, st.Done)
+		}
+		if st.Failed != "" {
+			res = append(res, st.Failed)
+		}
+	}
+	return res
+}
@@ -0,0 +1,250 @@
+package saga
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+	"github.com/uptrace/bun/driver/sqliteshim"
+
+	"github.com/adobaai/pkg/queue"
+	"github.com/adobaai/pkg/queue/memq"
+	"github.com/adobaai/pkg/testingz"
+)
+
+func newBunStore(t *testing.T) Store {
+	sqldb, err := sql.Open(sqliteshim.ShimName, "file::memory:")
+	require.NoError(t, err)
+	sqldb.SetMaxOpenConns(1)
+	db := bun.NewDB(sqldb, sqlitedialect.New())
+	t.Cleanup(func() { _ = db.Close() })
+	require.NoError(t, CreateTable(context.Background(), db))
+	return NewBunStore(db)
+}
+
+var stores = map[string]func(t *testing.T) Store{
+	"Mem": func(*testing.T) Store { return NewMemStore() },
+	"Bun": newBunStore,
+}
+
+type Order struct {
+	ID     string `json:"id"`
+	Amount int    `json:"amount"`
+	Charge string `json:"charge,omitempty"`
+}
+
+// recorder records the actions and compensations.
+type recorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *recorder) action(name string, err error) Action {
+	return func(ctx context.Context, sc *Context) error {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.calls = append(r.calls, name)
+		return err
+	}
+}
+
+func (r *recorder) get() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.calls...)
+}
+
+func newOrderSaga(rec *recorder) *Saga {
+	return &Saga{
+		Name:  "order",
+		Start: "order.created",
+		Steps: []Step{
+			{
+				Name:       "reserve",
+				Action:     rec.action("reserve", nil),
+				Done:       "inventory.reserved",
+				Failed:     "inventory.failed",
+				Compensate: rec.action("release", nil),
+			},
+			{
+				Name: "charge",
+				Action: func(ctx context.Context, sc *Context) error {
+					var o Order
+					if err := sc.Bind(&o); err != nil {
+						return err
+					}
+					o.Charge = "c-" + o.ID
+					return errors.Join(sc.Set(o), rec.action("charge", nil)(ctx, sc))
+				},
+				Done:       "payment.charged",
+				Failed:     "payment.failed",
+				Compensate: rec.action("refund", nil),
+				Timeout:    time.Hour,
+			},
+			{Name: "ship", Action: rec.action("ship", nil)},
+		},
+	}
+}
+
+func event(id string, et queue.EventType) queue.Event {
+	return queue.Event{ID: id, Type: et, EntityID: "o1", Entity: Order{ID: "o1", Amount: 10}}
+}
+
+func TestRuntime(t *testing.T) {
+	ctx := context.Background()
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			t.Run("Completed", func(t *testing.T) {
+				rec := &recorder{}
+				store := newStore(t)
+				rt := New(nil, store)
+				require.NoError(t, rt.Register(newOrderSaga(rec)))
+				require.Error(t, rt.Register(newOrderSaga(rec)))
+
+				require.NoError(t, rt.Handle(ctx, event("e1", "order.created")))
+				// Duplicated start events are ignored.
+				require.NoError(t, rt.Handle(ctx, event("e1", "order.created")))
+				// Unexpected events are ignored.
+				require.NoError(t, rt.Handle(ctx, event("e2", "payment.charged")))
+				require.NoError(t, rt.Handle(ctx, event("e3", "inventory.reserved")))
+
+				st := testingz.R(store.Find(ctx, "order", "o1")).NoError(t).V()
+				assert.Equal(t, StatusRunning, st.Status)
+				assert.Equal(t, 1, st.Step)
+				assert.JSONEq(t, `{"id":"o1","amount":10,"charge":"c-o1"}`, string(st.Data))
+				assert.WithinDuration(t, time.Now().Add(time.Hour), st.Deadline, time.Minute)
+
+				require.NoError(t, rt.Handle(ctx, event("e4", "payment.charged")))
+				testingz.R(store.Find(ctx, "order", "o1")).ErrorIs(t, ErrNotFound)
+				st = testingz.R(store.Get(ctx, st.ID)).NoError(t).V()
+				assert.Equal(t, StatusCompleted, st.Status)
+				assert.Equal(t, 3, st.Step)
+				assert.Equal(t, []string{"reserve", "charge", "ship"}, rec.get())
+			})
+
+			t.Run("Failed", func(t *testing.T) {
+				rec := &recorder{}
+				store := newStore(t)
+				rt := New(nil, store)
+				require.NoError(t, rt.Register(newOrderSaga(rec)))
+
+				require.NoError(t, rt.Handle(ctx, event("e1", "order.created")))
+				require.NoError(t, rt.Handle(ctx, event("e2", "inventory.reserved")))
+				require.NoError(t, rt.Handle(ctx, event("e3", "payment.failed")))
+				st := testingz.R(store.Get(ctx, "order:o1:e1")).NoError(t).V()
+				assert.Equal(t, StatusCompensated, st.Status)
+				assert.Equal(t, "step charge failed by payment.failed", st.Error)
+				assert.Equal(t, []string{"reserve", "charge", "release"}, rec.get())
+			})
+
+			t.Run("ActionError", func(t *testing.T) {
+				rec := &recorder{}
+				store := newStore(t)
+				rt := New(nil, store)
+				s := newOrderSaga(rec)
+				s.Steps[2].Action = rec.action("ship", errors.New("no courier"))
+				require.NoError(t, rt.Register(s))
+
+				require.NoError(t, rt.Handle(ctx, event("e1", "order.created")))
+				require.NoError(t, rt.Handle(ctx, event("e2", "inventory.reserved")))
+				require.NoError(t, rt.Handle(ctx, event("e3", "payment.charged")))
+				st := testingz.R(store.Get(ctx, "order:o1:e1")).NoError(t).V()
+				assert.Equal(t, StatusCompensated, st.Status)
+				assert.Equal(t, "step ship: no courier", st.Error)
+				assert.Equal(t, []string{"reserve", "charge", "ship", "refund", "release"}, rec.get())
+			})
+
+			t.Run("Timeout", func(t *testing.T) {
+				rec := &recorder{}
+				store := newStore(t)
+				now := time.Now()
+				rt := New(nil, store, WithRetryDelay(0), WithClock(func() time.Time { return now }))
+				s := newOrderSaga(rec)
+				s.Steps[1].Timeout = time.Minute
+				failing := true
+				s.Steps[0].Compensate = func(ctx context.Context, sc *Context) error {
+					if failing {
+						return errors.New("inventory down")
+					}
+					return rec.action("release", nil)(ctx, sc)
+				}
+				require.NoError(t, rt.Register(s))
+
+				require.NoError(t, rt.Handle(ctx, event("e1", "order.created")))
+				require.NoError(t, rt.Handle(ctx, event("e2", "inventory.reserved")))
+				testingz.R(rt.CheckTimeouts(ctx)).NoError(t).Equal(0)
+				now = now.Add(time.Minute)
+
+				n, err := rt.CheckTimeouts(ctx)
+				require.ErrorContains(t, err, "inventory down")
+				assert.Equal(t, 1, n)
+				st := testingz.R(store.Get(ctx, "order:o1:e1")).NoError(t).V()
+				assert.Equal(t, StatusCompensating, st.Status)
+				assert.Equal(t, "compensate reserve: inventory down", st.Error)
+
+				// Events are ignored while compensating.
+				require.NoError(t, rt.Handle(ctx, event("e3", "payment.charged")))
+				failing = false
+				testingz.R(rt.CheckTimeouts(ctx)).NoError(t).Equal(1)
+				st = testingz.R(store.Get(ctx, "order:o1:e1")).NoError(t).V()
+				assert.Equal(t, StatusCompensated, st.Status)
+				assert.Equal(t, []string{"reserve", "charge", "release"}, rec.get())
+				testingz.R(rt.CheckTimeouts(ctx)).NoError(t).Equal(0)
+			})
+
+			t.Run("Conflict", func(t *testing.T) {
+				store := newStore(t)
+				st := &State{ID: "s1", Saga: "order", Key: "o1", Status: StatusRunning}
+				require.NoError(t, store.Create(ctx, st))
+				st2 := testingz.R(store.Get(ctx, "s1")).NoError(t).V()
+				require.NoError(t, store.Update(ctx, st))
+				assert.Equal(t, 1, st.Version)
+				require.ErrorIs(t, store.Update(ctx, st2), ErrConflict)
+				assert.Equal(t, 0, st2.Version)
+				testingz.R(store.Get(ctx, "s2")).ErrorIs(t, ErrNotFound)
+			})
+		})
+	}
+}
+
+func TestRuntimeServer(t *testing.T) {
+	ctx := context.Background()
+	ps := memq.NewPubSub(func(e queue.Event) queue.EventType { return e.Type })
+	go func() { _ = ps.Start(ctx) }()
+	defer ps.Stop(ctx)
+
+	rec := &recorder{}
+	store := NewMemStore()
+	rt := New(ps, store, WithInterval(time.Millisecond))
+	require.Error(t, rt.Register(&Saga{Name: "order"}))
+	require.NoError(t, rt.Register(newOrderSaga(rec)))
+
+	exit := make(chan struct{})
+	go func() {
+		assert.NoError(t, rt.Start(ctx))
+		close(exit)
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	for _, e := range []queue.Event{
+		event("e1", "order.created"),
+		event("e2", "inventory.reserved"),
+		event("e3", "payment.charged"),
+	} {
+		require.NoError(t, ps.Pub(ctx, e))
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.NoError(t, rt.Stop(ctx))
+	<-exit
+
+	st := testingz.R(store.Get(ctx, "order:o1:e1")).NoError(t).V()
+	assert.Equal(t, StatusCompleted, st.Status)
+	assert.Equal(t, []string{"reserve", "charge", "ship"}, rec.get())
+}
@@ -0,0 +1,179 @@
+package saga
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"github.com/adobaai/pkg/dbz/bunrepo"
+)
+
+// ##################### Memory #####################
+
+// MemStore is an in-memory [Store], which is useful for tests and single-process services.
+type MemStore struct {
+	mu  sync.Mutex
+	sts map[string]*State
+}
+
+var _ Store = (*MemStore)(nil)
+
+// NewMemStore returns an empty memory store.
+func NewMemStore() *MemStore {
+	return &MemStore{sts: make(map[string]*State)}
+}
+
+func (ms *MemStore) Create(ctx context.Context, s *State) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if _, ok := ms.sts[s.ID]; ok {
+		return fmt.Errorf("%w: %s already exists", ErrConflict, s.ID)
+	}
+	ms.sts[s.ID] = s.clone()
+	return nil
+}
+
+func (ms *MemStore) Get(ctx context.Context, id string) (*State, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	s, ok := ms.sts[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return s.clone(), nil
+}
+
+func (ms *MemStore) Find(ctx context.Context, saga, key string) (*State, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for _, s := range ms.sts {
+		if s.Saga == saga && s.Key == key && s.Status.Active() {
+			return s.clone(), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (ms *MemStore) Update(ctx context.Context, s *State) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	cur, ok := ms.sts[s.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if cur.Version != s.Version {
+		return fmt.Errorf("%w: version %d, got %d", ErrConflict, cur.Version, s.Version)
+	}
+	s.Version++
+	ms.sts[s.ID] = s.clone()
+	return nil
+}
+
+func (ms *MemStore) Expired(ctx context.Context, now time.Time, limit int) (res []*State, err error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for _, s := range ms.sts {
+		if s.Status.Active() && !s.Deadline.IsZero() && !s.Deadline.After(now) {
+			res = append(res, s.clone())
+		}
+	}
+	slices.SortFunc(res, func(a, b *State) int { return a.Deadline.Compare(b.Deadline) })
+	if limit > 0 && len(res) > limit {
+		res = res[:limit]
+	}
+	return
+}
+
+// ##################### Bun #####################
+
+// BunStore is a [Store] backed by the sagas table.
+type BunStore struct {
+	db   bun.IDB
+	repo *bunrepo.Repo[State]
+}
+
+var _ Store = (*BunStore)(nil)
+
+// NewBunStore returns a store using db.
+func NewBunStore(db bun.IDB) *BunStore {
+	return &BunStore{db: db, repo: bunrepo.New[State](db)}
+}
+
+// CreateTable creates the sagas table if not exists.
+func CreateTable(ctx context.Context, db bun.IDB) error {
+	_, err := db.NewCreateTable().Model((*State)(nil)).IfNotExists().Exec(ctx)
+	return err
+}
+
+var activeStatuses = bun.In([]Status{StatusRunning, StatusCompensating})
+
+func (bs *BunStore) Create(ctx context.Context, s *State) error {
+	_, err := bs.repo.Add(ctx, s)
+	return err
+}
+
+func (bs *BunStore) Get(ctx context.Context, id string) (*State, error) {
+	s := &State{ID: id}
+	if err := bs.repo.Get(ctx, s); err != nil {
+		return nil, notFound(err)
+	}
+	return s, nil
+}
+
+func (bs *BunStore) Find(ctx context.Context, saga, key string) (*State, error) {
+	s := &State{}
+	err := bs.repo.Getf(ctx, s, func(q *bun.SelectQuery) *bun.SelectQuery {
+		return q.Where("sg.saga = ?", saga).
+			Where("sg.key = ?", key).
+			Where("sg.status IN (?)", activeStatuses).
+			Order("sg.created_at DESC").
+			Limit(1)
+	})
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return s, nil
+}
+
+func (bs *BunStore) Update(ctx context.Context, s *State) error {
+	old := s.Version
+	s.Version++
+	res, err := bs.repo.Updf(ctx, s, func(q *bun.UpdateQuery) *bun.UpdateQuery {
+		return q.WherePK().Where("version = ?", old)
+	})
+	if err == nil {
+		var n int64
+		if n, err = res.RowsAffected(); err == nil && n == 0 {
+			err = fmt.Errorf("%w: version %d is outdated", ErrConflict, old)
+		}
+	}
+	if err != nil {
+		s.Version = old
+	}
+	return err
+}
+
+func (bs *BunStore) Expired(ctx context.Context, now time.Time, limit int) ([]*State, error) {
+	var res []*State
+	q := bs.db.NewSelect().Model(&res).
+		Where("sg.status IN (?)", activeStatuses).
+		Where("sg.deadline <= ?", now).
+		Order("sg.deadline")
+	if limit > 0 {
+		q.Limit(limit)
+	}
+	return res, q.Scan(ctx)
+}
+
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}